@@ -3,10 +3,15 @@ package main
 import (
 	"context"
 
+	"gemini-web-to-api/internal/cache"
+	"gemini-web-to-api/internal/coalesce"
 	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/contextwindow"
+	"gemini-web-to-api/internal/ephemeral"
 	"gemini-web-to-api/internal/handlers"
 	"gemini-web-to-api/internal/providers"
 	"gemini-web-to-api/internal/providers/gemini"
+	"gemini-web-to-api/internal/routing"
 	"gemini-web-to-api/internal/server"
 	"gemini-web-to-api/pkg/logger"
 
@@ -21,22 +26,47 @@ import (
 // @description 🚀 High-performance WebAI-to-API gateway. Seamlessly bridge Google Gemini into standardized OpenAI, Anthropic (Claude), and Google Native REST APIs.
 // @host localhost:4981
 // @BasePath /
+// @securityDefinitions.apikey AdminKey
+// @in header
+// @name Authorization
 func main() {
 	fx.New(
 		fx.Provide(
 			config.New,
+			config.NewStore,
 			func(cfg *config.Config) (*zap.Logger, error) {
 				return logger.New(cfg.LogLevel)
 			},
 			providers.NewProviderManager,
 			gemini.NewClient,
+			ephemeral.NewManager,
+			cache.New,
+			coalesce.NewGroup,
+			contextwindow.NewManager,
+			routing.NewRouter,
 			handlers.NewGeminiHandler,
 			handlers.NewOpenAIHandler,
 			handlers.NewClaudeHandler,
+			handlers.NewAdminHandler,
 		),
 		fx.Invoke(
 			server.New,
 		),
+		fx.Invoke(func(store *config.Store, c *gemini.Client, router *routing.Router, em *ephemeral.Manager, rc *cache.Cache, window *contextwindow.Manager, log *zap.Logger) {
+			// Apply reloaded settings to the running components
+			store.Subscribe(func(cfg *config.Config) {
+				if err := logger.SetLevel(cfg.LogLevel); err != nil {
+					log.Warn("Invalid log level in reloaded config", zap.Error(err))
+				}
+				if err := router.Reload(cfg.Routing.Rules); err != nil {
+					log.Error("Failed to reload routing rules", zap.Error(err))
+				}
+				em.SetPolicy(cfg.Ephemeral)
+				rc.SetPolicy(cfg.Cache)
+				window.SetPolicy(cfg.Context)
+				c.ApplyConfig(cfg)
+			})
+		}),
 		fx.Invoke(func(pm *providers.ProviderManager, c *gemini.Client, log *zap.Logger) {
 			pm.Register("gemini", c)
 			// Initialize all providers (non-blocking, logs warnings on failure)
@@ -0,0 +1,221 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+	"time"
+
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/providers"
+
+	"go.uber.org/zap"
+)
+
+// HeaderName reports how the cache served a request
+const HeaderName = "X-Cache"
+
+// Status is the value of the X-Cache header
+type Status string
+
+const (
+	StatusHit    Status = "HIT"
+	StatusMiss   Status = "MISS"
+	StatusBypass Status = "BYPASS" // asked by the client, or excluded by policy
+)
+
+// Entry is a cached response
+type Entry struct {
+	Response *providers.Response `json:"response"`
+	Stored   time.Time           `json:"stored"`
+	Expires  time.Time           `json:"expires"`
+}
+
+// Backend stores entries by key, evicting the least recently used beyond its capacity
+type Backend interface {
+	Get(key string) (Entry, bool)
+	Put(key string, entry Entry)
+	Delete(key string)
+}
+
+// Cache serves responses to identical prompts without asking Gemini again.
+// Deep Research and requests that want varied answers are never cached.
+type Cache struct {
+	backend Backend
+	log     *zap.Logger
+
+	mu             sync.Mutex // guards the policy fields
+	enabled        bool
+	apiKeys        map[string]bool
+	ttl            time.Duration
+	maxTemperature float64
+}
+
+// New creates the cache with the configured backend; the backend is only chosen at startup
+func New(cfg *config.Config, log *zap.Logger) (*Cache, error) {
+	var backend Backend
+	switch cfg.Cache.Backend {
+	case "disk":
+		disk, err := NewDisk(cfg.Cache.Dir, cfg.Cache.MaxEntries)
+		if err != nil {
+			return nil, err
+		}
+		backend = disk
+	default:
+		backend = NewMemory(cfg.Cache.MaxEntries)
+	}
+	return newCache(cfg.Cache, backend, log), nil
+}
+
+func newCache(cfg config.CacheConfig, backend Backend, log *zap.Logger) *Cache {
+	c := &Cache{backend: backend, log: log}
+	c.SetPolicy(cfg)
+	return c
+}
+
+// SetPolicy updates which requests are cached and for how long
+func (c *Cache) SetPolicy(cfg config.CacheConfig) {
+	apiKeys := make(map[string]bool, len(cfg.APIKeys))
+	for _, key := range cfg.APIKeys {
+		apiKeys[key] = true
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.enabled = cfg.Enabled
+	c.apiKeys = apiKeys
+	c.ttl = time.Duration(cfg.TTL) * time.Second
+	c.maxTemperature = cfg.MaxTemperature
+}
+
+// Request is what a cache lookup is decided on
+type Request struct {
+	Prompt       string
+	Options      []providers.GenerateOption
+	APIKey       string
+	CacheControl string // the request's Cache-Control header
+	Ephemeral    bool   // the request's conversation is deleted, so its reply must not be kept
+}
+
+// Lookup is the cache's answer to one request
+type Lookup struct {
+	Status   Status              // empty when caching does not apply to the request
+	Response *providers.Response // the cached response on a hit
+	Age      time.Duration       // since the response was cached
+
+	cache *Cache
+	key   string // where a fresh response is stored, empty when it must not be
+}
+
+// Lookup finds the cached response for a request. The API key and Cache-Control header
+// decide whether caching applies: "no-cache" skips the cached response and stores the
+// fresh one, "no-store" skips the cache altogether, as do ephemeral requests.
+func (c *Cache) Lookup(req Request) *Lookup {
+	c.mu.Lock()
+	enabled := c.enabled || (req.APIKey != "" && c.apiKeys[req.APIKey])
+	maxTemperature := c.maxTemperature
+	c.mu.Unlock()
+
+	if !enabled {
+		return &Lookup{}
+	}
+
+	var gen providers.GenerateConfig
+	for _, opt := range req.Options {
+		opt(&gen)
+	}
+	if gen.DeepResearch || gen.Temperature > maxTemperature {
+		return &Lookup{Status: StatusBypass}
+	}
+
+	noCache, noStore := cacheControl(req.CacheControl)
+	if noStore || req.Ephemeral {
+		return &Lookup{Status: StatusBypass}
+	}
+
+	lookup := &Lookup{Status: StatusMiss, cache: c, key: requestKey(req.Prompt, gen)}
+	if noCache {
+		lookup.Status = StatusBypass
+		return lookup
+	}
+
+	entry, ok := c.backend.Get(lookup.key)
+	if !ok {
+		return lookup
+	}
+	if time.Now().After(entry.Expires) {
+		c.backend.Delete(lookup.key)
+		return lookup
+	}
+	lookup.Status = StatusHit
+	lookup.Response = entry.Response
+	lookup.Age = time.Since(entry.Stored)
+	return lookup
+}
+
+// Hit reports whether the response came from the cache
+func (l *Lookup) Hit() bool {
+	return l.Status == StatusHit
+}
+
+// Store caches a fresh response for the request, if it may be cached
+func (l *Lookup) Store(response *providers.Response) {
+	if l.key == "" || l.Hit() || response == nil {
+		return
+	}
+	l.cache.mu.Lock()
+	ttl := l.cache.ttl
+	l.cache.mu.Unlock()
+
+	now := time.Now()
+	l.cache.backend.Put(l.key, Entry{Response: response, Stored: now, Expires: now.Add(ttl)})
+	l.cache.log.Debug("Response cached", zap.String("key", l.key[:12]))
+}
+
+// Key identifies a request by its prompt and options, the same way the cache does
+func Key(prompt string, opts []providers.GenerateOption) string {
+	var gen providers.GenerateConfig
+	for _, opt := range opts {
+		opt(&gen)
+	}
+	return requestKey(prompt, gen)
+}
+
+// requestKey identifies a request by its normalized prompt and the options that shape the answer
+func requestKey(prompt string, gen providers.GenerateConfig) string {
+	data, _ := json.Marshal(struct {
+		Prompt       string   `json:"prompt"`
+		Model        string   `json:"model"`
+		Files        []string `json:"files,omitempty"`
+		Temperature  float64  `json:"temperature"`
+		MaxTokens    int      `json:"max_tokens"`
+		DeepResearch bool     `json:"deep_research"`
+		GemID        string   `json:"gem,omitempty"`
+	}{normalize(prompt), gen.Model, gen.Files, gen.Temperature, gen.MaxTokens, gen.DeepResearch, gen.GemID})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// normalize makes prompts that differ only in line endings or surrounding whitespace equal
+func normalize(prompt string) string {
+	lines := strings.Split(strings.ReplaceAll(prompt, "\r\n", "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// cacheControl reads the no-cache and no-store directives of a Cache-Control header
+func cacheControl(header string) (noCache, noStore bool) {
+	for _, directive := range strings.Split(header, ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache":
+			noCache = true
+		case "no-store":
+			noStore = true
+		}
+	}
+	return noCache, noStore
+}
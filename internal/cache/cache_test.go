@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/providers"
+
+	"go.uber.org/zap/zaptest"
+)
+
+func TestBackendsEvictLeastRecentlyUsed(t *testing.T) {
+	disk, err := NewDisk(t.TempDir(), 2)
+	if err != nil {
+		t.Fatalf("new disk: %v", err)
+	}
+	for name, backend := range map[string]Backend{"memory": NewMemory(2), "disk": disk} {
+		t.Run(name, func(t *testing.T) {
+			entry := func(text string) Entry {
+				return Entry{Response: &providers.Response{Text: text}, Expires: time.Now().Add(time.Hour)}
+			}
+			backend.Put("a", entry("A"))
+			time.Sleep(10 * time.Millisecond) // disk recency comes from modification times
+			backend.Put("b", entry("B"))
+			time.Sleep(10 * time.Millisecond)
+			if got, ok := backend.Get("a"); !ok || got.Response.Text != "A" {
+				t.Fatalf("get a = %+v, %v", got, ok)
+			}
+			time.Sleep(10 * time.Millisecond)
+			backend.Put("c", entry("C"))
+
+			if _, ok := backend.Get("b"); ok {
+				t.Error("b should have been evicted as least recently used")
+			}
+			for _, key := range []string{"a", "c"} {
+				if _, ok := backend.Get(key); !ok {
+					t.Errorf("%s should still be cached", key)
+				}
+			}
+		})
+	}
+}
+
+func TestLookupPolicy(t *testing.T) {
+	c := newCache(config.CacheConfig{APIKeys: []string{"ci"}, TTL: 60}, NewMemory(10), zaptest.NewLogger(t))
+	opts := []providers.GenerateOption{providers.WithModel("gemini-2.5-pro")}
+
+	if l := c.Lookup(Request{Prompt: "hi", Options: opts}); l.Status != "" {
+		t.Errorf("disabled cache looked up: %q", l.Status)
+	}
+
+	miss := c.Lookup(Request{Prompt: "hi", Options: opts, APIKey: "ci"})
+	if miss.Status != StatusMiss {
+		t.Fatalf("status = %q, want MISS", miss.Status)
+	}
+	miss.Store(&providers.Response{Text: "hello"})
+
+	if l := c.Lookup(Request{Prompt: " hi\n", Options: opts, APIKey: "ci"}); !l.Hit() || l.Response.Text != "hello" {
+		t.Errorf("lookup = %+v, want a hit", l)
+	}
+	if l := c.Lookup(Request{Prompt: "hi", Options: opts, APIKey: "ci", CacheControl: "no-store"}); l.Status != StatusBypass {
+		t.Errorf("no-store status = %q", l.Status)
+	}
+	if l := c.Lookup(Request{Prompt: "hi", Options: opts, APIKey: "ci", Ephemeral: true}); l.Status != StatusBypass || l.Hit() {
+		t.Errorf("ephemeral lookup = %+v, want a bypass", l)
+	}
+	ephemeral := c.Lookup(Request{Prompt: "ephemeral", Options: opts, APIKey: "ci", Ephemeral: true})
+	ephemeral.Store(&providers.Response{Text: "secret"})
+	if l := c.Lookup(Request{Prompt: "ephemeral", Options: opts, APIKey: "ci"}); l.Hit() {
+		t.Error("reply to an ephemeral request was stored")
+	}
+	research := append(opts, providers.WithDeepResearch(true))
+	if l := c.Lookup(Request{Prompt: "hi", Options: research, APIKey: "ci"}); l.Status != StatusBypass {
+		t.Errorf("deep research status = %q", l.Status)
+	}
+
+	c.SetPolicy(config.CacheConfig{APIKeys: []string{"ci"}, TTL: -1})
+	expiring := c.Lookup(Request{Prompt: "bye", Options: opts, APIKey: "ci"})
+	expiring.Store(&providers.Response{Text: "goodbye"})
+	if l := c.Lookup(Request{Prompt: "bye", Options: opts, APIKey: "ci"}); l.Hit() {
+		t.Error("expired response served")
+	}
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Disk keeps one JSON file per entry in a directory, so cached responses survive restarts
+// and can be shared by CI runs. A file's modification time is its last use.
+type Disk struct {
+	mu         sync.Mutex
+	dir        string
+	maxEntries int
+}
+
+// NewDisk creates a disk backend in dir holding up to maxEntries responses
+func NewDisk(dir string, maxEntries int) (*Disk, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory %s: %w", dir, err)
+	}
+	return &Disk{dir: dir, maxEntries: maxEntries}, nil
+}
+
+func (d *Disk) path(key string) string {
+	return filepath.Join(d.dir, key+".json")
+}
+
+func (d *Disk) Get(key string) (Entry, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	data, err := os.ReadFile(d.path(key))
+	if err != nil {
+		return Entry{}, false
+	}
+	var entry Entry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Response == nil {
+		_ = os.Remove(d.path(key))
+		return Entry{}, false
+	}
+	now := time.Now()
+	_ = os.Chtimes(d.path(key), now, now)
+	return entry, true
+}
+
+func (d *Disk) Put(key string, entry Entry) {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// Write then rename, so a crash never leaves a truncated entry
+	tmp := d.path(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, d.path(key)); err != nil {
+		_ = os.Remove(tmp)
+		return
+	}
+	d.evict()
+}
+
+func (d *Disk) Delete(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_ = os.Remove(d.path(key))
+}
+
+// evict removes the least recently used entries beyond the capacity
+func (d *Disk) evict() {
+	dirEntries, err := os.ReadDir(d.dir)
+	if err != nil {
+		return
+	}
+	type file struct {
+		name string
+		used time.Time
+	}
+	var files []file
+	for _, e := range dirEntries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".json") {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			files = append(files, file{e.Name(), info.ModTime()})
+		}
+	}
+	if len(files) <= d.maxEntries {
+		return
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].used.Before(files[j].used) })
+	for _, f := range files[:len(files)-d.maxEntries] {
+		_ = os.Remove(filepath.Join(d.dir, f.name))
+	}
+}
@@ -0,0 +1,90 @@
+package coalesce
+
+import (
+	"context"
+	"sync"
+
+	"gemini-web-to-api/internal/providers"
+)
+
+// Group shares one generation between concurrent identical requests, like singleflight.
+// The generation outlives the caller that started it: it is only cancelled once every
+// caller waiting for it has gone.
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+type call struct {
+	done     chan struct{}
+	response *providers.Response
+	err      error
+	waiters  int
+	owned    bool // the result has been handed to its owner
+	cancel   context.CancelFunc
+}
+
+// NewGroup creates an empty group
+func NewGroup() *Group {
+	return &Group{calls: make(map[string]*call)}
+}
+
+// Do returns the result of fn for key, running fn only if no call for key is in flight.
+// fn runs with the values and deadline of the first caller's ctx. Owner is true for
+// exactly one caller that receives a successful response; that caller handles its side
+// effects, such as deleting the conversation. Shared reports that the call was joined.
+func (g *Group) Do(ctx context.Context, key string, fn func(ctx context.Context) (*providers.Response, error)) (response *providers.Response, owner, shared bool, err error) {
+	g.mu.Lock()
+	c, shared := g.calls[key]
+	if !shared {
+		var (
+			callCtx context.Context
+			cancel  context.CancelFunc
+		)
+		if deadline, ok := ctx.Deadline(); ok {
+			callCtx, cancel = context.WithDeadline(context.WithoutCancel(ctx), deadline)
+		} else {
+			callCtx, cancel = context.WithCancel(context.WithoutCancel(ctx))
+		}
+		c = &call{done: make(chan struct{}), cancel: cancel}
+		g.calls[key] = c
+		go g.run(callCtx, key, c, fn)
+	}
+	c.waiters++
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			// Nobody wants the result any more; later requests start afresh
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return nil, false, shared, ctx.Err()
+	}
+
+	g.mu.Lock()
+	if c.err == nil && !c.owned {
+		c.owned, owner = true, true
+	}
+	g.mu.Unlock()
+	return c.response, owner, shared, c.err
+}
+
+func (g *Group) run(ctx context.Context, key string, c *call, fn func(ctx context.Context) (*providers.Response, error)) {
+	c.response, c.err = fn(ctx)
+	c.cancel()
+
+	g.mu.Lock()
+	if g.calls[key] == c {
+		delete(g.calls, key)
+	}
+	g.mu.Unlock()
+	close(c.done)
+}
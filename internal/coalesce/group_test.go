@@ -0,0 +1,115 @@
+package coalesce
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gemini-web-to-api/internal/providers"
+)
+
+func TestConcurrentCallsShareOneGeneration(t *testing.T) {
+	g := NewGroup()
+	release := make(chan struct{})
+	var calls atomic.Int32
+	fn := func(ctx context.Context) (*providers.Response, error) {
+		calls.Add(1)
+		<-release
+		return &providers.Response{Text: "shared"}, nil
+	}
+
+	const callers = 10
+	var wg sync.WaitGroup
+	var owners, joined atomic.Int32
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			response, owner, shared, err := g.Do(context.Background(), "k", fn)
+			if err != nil || response.Text != "shared" {
+				t.Errorf("Do = %v, %v", response, err)
+			}
+			if owner {
+				owners.Add(1)
+			}
+			if shared {
+				joined.Add(1)
+			}
+		}()
+	}
+	for g.waiters("k") < callers {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls.Load() != 1 || owners.Load() != 1 || joined.Load() != callers-1 {
+		t.Errorf("calls = %d, owners = %d, joined = %d", calls.Load(), owners.Load(), joined.Load())
+	}
+}
+
+func TestGenerationOutlivesItsFirstCaller(t *testing.T) {
+	g := NewGroup()
+	started := make(chan struct{})
+	release := make(chan struct{})
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (*providers.Response, error) {
+		close(started)
+		select {
+		case <-release:
+			return &providers.Response{Text: "done"}, nil
+		case <-ctx.Done():
+			close(cancelled)
+			return nil, ctx.Err()
+		}
+	}
+
+	first, cancelFirst := context.WithCancel(context.Background())
+	firstDone := make(chan error, 1)
+	go func() {
+		_, _, _, err := g.Do(first, "k", fn)
+		firstDone <- err
+	}()
+	<-started
+
+	second, cancelSecond := context.WithCancel(context.Background())
+	secondDone := make(chan *providers.Response, 1)
+	go func() {
+		response, owner, _, _ := g.Do(second, "k", fn)
+		if !owner {
+			t.Error("the only caller left should own the response")
+		}
+		secondDone <- response
+	}()
+	for g.waiters("k") < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancelFirst()
+	if err := <-firstDone; err != context.Canceled {
+		t.Errorf("first caller err = %v", err)
+	}
+	close(release)
+	if response := <-secondDone; response == nil || response.Text != "done" {
+		t.Errorf("second caller got %v", response)
+	}
+	cancelSecond()
+
+	select {
+	case <-cancelled:
+		t.Error("generation cancelled while a caller still waited")
+	default:
+	}
+}
+
+// waiters returns the number of callers waiting for key
+func (g *Group) waiters(key string) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if c, ok := g.calls[key]; ok {
+		return c.waiters
+	}
+	return 0
+}
@@ -1,19 +1,35 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
+	"go.uber.org/zap/zapcore"
+	"go.yaml.in/yaml/v3"
 )
 
 type Config struct {
-	Gemini GeminiConfig
-	Claude ClaudeConfig
-	OpenAI OpenAIConfig
-	Server ServerConfig
-	LogLevel string
+	Gemini      GeminiConfig
+	Claude      ClaudeConfig
+	OpenAI      OpenAIConfig
+	Server      ServerConfig
+	Ephemeral   EphemeralConfig
+	Routing     RoutingConfig
+	Limits      LimitsConfig
+	Admin       AdminConfig
+	CookieCache CookieCacheConfig
+	Queue       QueueConfig
+	Cache       CacheConfig
+	Context     ContextConfig
+	LogLevel    string
+
+	// File is the config file the values were loaded from, empty when none was found
+	File string
 }
 
 type GeminiConfig struct {
@@ -22,23 +38,110 @@ type GeminiConfig struct {
 	Secure1PSIDCC   string
 	RefreshInterval int
 	MaxRetries      int
-	Cookies         string
+	Cookies         string // imported cookies: Cookie header, Netscape cookies.txt or export JSON
+	CookiesFile     string // file with imported cookies in any of the same formats
+	ModelsFile      string // YAML overlay of model aliases and capabilities
+	ModelsRefresh   int    // minutes between model discovery refreshes
+	TokenRefresh    int    // minutes between session token (SNlM0e) refreshes
+	RetryBaseDelay  int    // milliseconds before the first retry, doubled for each further one
+	RetryMaxDelay   int    // milliseconds a single retry may wait at most
+	RetryBudget     int    // retries allowed as a percentage of requests
+	Concurrency     int    // requests sent to the account at once
+	MaxQueue        int    // requests allowed to wait for a slot, 0 for no limit
+	QueueTimeout    int    // seconds a request may wait for a slot, 0 for no limit
+	BaseURL         string // serves all upstream endpoints instead of Google's hosts, e.g. a fake server
+	RecordMode      string // upstream exchanges to record: off, failures or all
+	RecordDir       string // directory recordings are written to
+	APIKeys         []string
+	Account         string // label of the account the cookies belong to
 }
 
 type ClaudeConfig struct {
-	APIKey  string
-	Model   string
-	Cookies string
+	APIKeys []string // accepted API keys, empty means no authentication
+	Model   string   // model used when a request does not name one
 }
 
 type OpenAIConfig struct {
-	APIKey  string
-	Model   string
-	Cookies string
+	APIKeys []string // accepted API keys, empty means no authentication
+	Model   string   // model used when a request does not name one
 }
 
 type ServerConfig struct {
-	Port     string
+	Port string
+}
+
+// AdminConfig protects the /admin routes; with no keys the admin API is disabled
+type AdminConfig struct {
+	APIKeys []string
+}
+
+// QueueConfig assigns request priorities and how free slots are shared between them
+type QueueConfig struct {
+	BatchAPIKeys      []string // API keys whose requests are queued as batch
+	ResearchAPIKeys   []string // API keys whose requests are queued as research
+	InteractiveWeight int
+	BatchWeight       int
+	ResearchWeight    int
+}
+
+// CookieCacheConfig controls where rotated cookies are persisted between restarts.
+// Setting Key or KeyFile encrypts the cache with AES-GCM.
+type CookieCacheConfig struct {
+	Dir     string
+	Key     string // hex/base64 encoded 32-byte key, or a passphrase
+	KeyFile string // file holding the key; generated on first use when missing
+}
+
+// LimitsConfig bounds the work a single request can cause
+type LimitsConfig struct {
+	RequestTimeout int // seconds a generation request may take
+	MaxPromptChars int // 0 disables the check
+}
+
+// EphemeralConfig controls deletion of upstream conversations after each request
+type EphemeralConfig struct {
+	Enabled       bool     // delete for every request unless overridden by header
+	APIKeys       []string // API keys whose requests are always ephemeral
+	SweepInterval int      // seconds between retries of failed deletions
+	MaxAttempts   int      // deletion attempts before giving up on a conversation
+}
+
+// CacheConfig controls the cache of responses to identical prompts
+type CacheConfig struct {
+	Enabled        bool     // cache every eligible request unless overridden by header
+	APIKeys        []string // API keys whose eligible requests are always cached
+	Backend        string   // memory or disk
+	Dir            string   // directory of the disk backend
+	MaxEntries     int      // responses kept before the least recently used is evicted
+	TTL            int      // seconds a cached response is served
+	MaxTemperature float64  // requests asking for a higher temperature want varied answers and are not cached
+}
+
+// ContextConfig controls what happens to conversations longer than the model's context window
+type ContextConfig struct {
+	Strategy     string // reject, drop_oldest, keep_last or summarize
+	MaxTokens    int    // limit for models without a known context window, 0 for none
+	KeepLast     int    // messages kept besides system messages by keep_last and summarize
+	SummaryModel string // model that summarizes the older turns
+}
+
+// RoutingConfig maps incoming model names to Gemini models and default options
+type RoutingConfig struct {
+	File     string      `yaml:"-"`
+	Template string      `yaml:"-"` // prompt template of routes that do not name one; transcript when empty
+	Rules    []RouteRule `yaml:"routes"`
+}
+
+// RouteRule matches an incoming model name for one API flavor (or all when Flavor is empty)
+type RouteRule struct {
+	Flavor       string `yaml:"flavor" toml:"flavor"` // "openai", "claude", "gemini" or empty for all
+	Match        string `yaml:"match" toml:"match"`   // "exact" (default), "prefix" or "regex"
+	Pattern      string `yaml:"pattern" toml:"pattern"`
+	Target       string `yaml:"target" toml:"target"` // Gemini model; regex rules may reference groups ($1)
+	DeepResearch *bool  `yaml:"deep_research" toml:"deep_research"`
+	Gem          string `yaml:"gem" toml:"gem"` // Gem name or ID
+	SystemPrompt string `yaml:"system_prompt" toml:"system_prompt"`
+	Template     string `yaml:"template" toml:"template"` // prompt template: transcript, xml or instruction
 }
 
 const (
@@ -46,26 +149,66 @@ const (
 	defaultGeminiRefreshInterval = 5
 	defaultGeminiMaxRetries      = 3
 	defaultLogLevel              = "info"
+	defaultGeminiModelsFile      = "models.yaml"
+	defaultGeminiModelsRefresh   = 60
+	defaultGeminiTokenRefresh    = 15
+	defaultGeminiRetryBaseDelay  = 500
+	defaultGeminiRetryMaxDelay   = 10000
+	defaultGeminiRetryBudget     = 20
+	defaultGeminiConcurrency     = 2
+	defaultGeminiMaxQueue        = 32
+	defaultGeminiQueueTimeout    = 120
+	defaultGeminiRecordMode      = "off"
+	defaultGeminiRecordDir       = "recordings"
+	defaultRoutesFile            = "routes.yaml"
+	defaultEphemeralSweep        = 60
+	defaultEphemeralMaxAttempts  = 5
+	defaultRequestTimeout        = 300
+	defaultCookieCacheDir        = ".cookies"
+	defaultInteractiveWeight     = 6
+	defaultBatchWeight           = 3
+	defaultResearchWeight        = 1
+	defaultCacheBackend          = "memory"
+	defaultCacheDir              = ".cache"
+	defaultCacheMaxEntries       = 1000
+	defaultCacheTTL              = 86400
+	defaultContextStrategy       = "reject"
+	defaultContextKeepLast       = 10
+	defaultContextSummaryModel   = "gemini-2.5-flash"
 )
 
+// defaultConfigFiles are tried in order when CONFIG_FILE is not set
+var defaultConfigFiles = []string{"config.yaml", "config.yml", "config.toml"}
+
 func New() (*Config, error) {
 	// Load .env file if it exists
 	_ = godotenv.Load()
 
-	var cfg Config
+	return Load()
+}
 
-	// Server
-	cfg.Server.Port = getEnv("PORT", defaultServerPort)
-	
-	// General
-	cfg.LogLevel = getEnv("LOG_LEVEL", defaultLogLevel)
+// Load builds the configuration from defaults, the config file and environment variables,
+// in increasing order of priority, then validates it.
+func Load() (*Config, error) {
+	cfg := defaults()
 
-	// Gemini
-	cfg.Gemini.Secure1PSID = os.Getenv("GEMINI_1PSID")
-	cfg.Gemini.Secure1PSIDTS = os.Getenv("GEMINI_1PSIDTS")
-	cfg.Gemini.Cookies = os.Getenv("GEMINI_COOKIES")
-	cfg.Gemini.RefreshInterval = getEnvInt("GEMINI_REFRESH_INTERVAL", defaultGeminiRefreshInterval)
-	cfg.Gemini.MaxRetries = getEnvInt("GEMINI_MAX_RETRIES", defaultGeminiMaxRetries)
+	path, err := configFilePath()
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		if err := loadFile(path, &cfg); err != nil {
+			return nil, err
+		}
+		cfg.File = path
+	}
+
+	applyEnv(&cfg)
+
+	// Model routing: rules from the routes file are checked after the config file's
+	if err := loadRoutes(&cfg.Routing); err != nil {
+		return nil, err
+	}
 
 	// Validate configuration
 	if err := cfg.Validate(); err != nil {
@@ -75,16 +218,151 @@ func New() (*Config, error) {
 	return &cfg, nil
 }
 
+func defaults() Config {
+	var cfg Config
+	cfg.Server.Port = defaultServerPort
+	cfg.LogLevel = defaultLogLevel
+	cfg.Gemini.RefreshInterval = defaultGeminiRefreshInterval
+	cfg.Gemini.MaxRetries = defaultGeminiMaxRetries
+	cfg.Gemini.ModelsFile = defaultGeminiModelsFile
+	cfg.Gemini.ModelsRefresh = defaultGeminiModelsRefresh
+	cfg.Gemini.TokenRefresh = defaultGeminiTokenRefresh
+	cfg.Gemini.RetryBaseDelay = defaultGeminiRetryBaseDelay
+	cfg.Gemini.RetryMaxDelay = defaultGeminiRetryMaxDelay
+	cfg.Gemini.RetryBudget = defaultGeminiRetryBudget
+	cfg.Gemini.Concurrency = defaultGeminiConcurrency
+	cfg.Gemini.MaxQueue = defaultGeminiMaxQueue
+	cfg.Gemini.QueueTimeout = defaultGeminiQueueTimeout
+	cfg.Gemini.RecordMode = defaultGeminiRecordMode
+	cfg.Gemini.RecordDir = defaultGeminiRecordDir
+	cfg.Ephemeral.SweepInterval = defaultEphemeralSweep
+	cfg.Ephemeral.MaxAttempts = defaultEphemeralMaxAttempts
+	cfg.Routing.File = defaultRoutesFile
+	cfg.Limits.RequestTimeout = defaultRequestTimeout
+	cfg.CookieCache.Dir = defaultCookieCacheDir
+	cfg.Queue.InteractiveWeight = defaultInteractiveWeight
+	cfg.Queue.BatchWeight = defaultBatchWeight
+	cfg.Queue.ResearchWeight = defaultResearchWeight
+	cfg.Cache.Backend = defaultCacheBackend
+	cfg.Cache.Dir = defaultCacheDir
+	cfg.Cache.MaxEntries = defaultCacheMaxEntries
+	cfg.Cache.TTL = defaultCacheTTL
+	cfg.Context.Strategy = defaultContextStrategy
+	cfg.Context.KeepLast = defaultContextKeepLast
+	cfg.Context.SummaryModel = defaultContextSummaryModel
+	return cfg
+}
+
+// configFilePath returns CONFIG_FILE, or the first default config file that exists
+func configFilePath() (string, error) {
+	if path, ok := os.LookupEnv("CONFIG_FILE"); ok {
+		if path == "" {
+			return "", nil
+		}
+		if _, err := os.Stat(path); err != nil {
+			return "", fmt.Errorf("config file %s: %w", path, err)
+		}
+		return path, nil
+	}
+	for _, path := range defaultConfigFiles {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		}
+	}
+	return "", nil
+}
+
+// applyEnv overrides values with the environment variables that are set
+func applyEnv(cfg *Config) {
+	// Server
+	overrideString(&cfg.Server.Port, "PORT")
+
+	// General
+	overrideString(&cfg.LogLevel, "LOG_LEVEL")
+
+	// Gemini
+	overrideString(&cfg.Gemini.Secure1PSID, "GEMINI_1PSID")
+	overrideString(&cfg.Gemini.Secure1PSIDTS, "GEMINI_1PSIDTS")
+	overrideString(&cfg.Gemini.Secure1PSIDCC, "GEMINI_1PSIDCC")
+	overrideString(&cfg.Gemini.Cookies, "GEMINI_COOKIES")
+	overrideString(&cfg.Gemini.CookiesFile, "GEMINI_COOKIES_FILE")
+	overrideInt(&cfg.Gemini.RefreshInterval, "GEMINI_REFRESH_INTERVAL")
+	overrideInt(&cfg.Gemini.MaxRetries, "GEMINI_MAX_RETRIES")
+	overrideString(&cfg.Gemini.ModelsFile, "GEMINI_MODELS_FILE")
+	overrideInt(&cfg.Gemini.ModelsRefresh, "GEMINI_MODELS_REFRESH_INTERVAL")
+	overrideInt(&cfg.Gemini.TokenRefresh, "GEMINI_TOKEN_REFRESH_INTERVAL")
+	overrideInt(&cfg.Gemini.RetryBaseDelay, "GEMINI_RETRY_BASE_DELAY")
+	overrideInt(&cfg.Gemini.RetryMaxDelay, "GEMINI_RETRY_MAX_DELAY")
+	overrideInt(&cfg.Gemini.RetryBudget, "GEMINI_RETRY_BUDGET")
+	overrideInt(&cfg.Gemini.Concurrency, "GEMINI_CONCURRENCY")
+	overrideInt(&cfg.Gemini.MaxQueue, "GEMINI_MAX_QUEUE")
+	overrideInt(&cfg.Gemini.QueueTimeout, "GEMINI_QUEUE_TIMEOUT")
+	overrideString(&cfg.Gemini.BaseURL, "GEMINI_BASE_URL")
+	overrideString(&cfg.Gemini.RecordMode, "GEMINI_RECORD")
+	overrideString(&cfg.Gemini.RecordDir, "GEMINI_RECORD_DIR")
+
+	// API keys and default models
+	overrideList(&cfg.OpenAI.APIKeys, "OPENAI_API_KEYS")
+	overrideString(&cfg.OpenAI.Model, "OPENAI_DEFAULT_MODEL")
+	overrideList(&cfg.Claude.APIKeys, "CLAUDE_API_KEYS")
+	overrideString(&cfg.Claude.Model, "CLAUDE_DEFAULT_MODEL")
+	overrideList(&cfg.Gemini.APIKeys, "GEMINI_API_KEYS")
+	overrideList(&cfg.Admin.APIKeys, "ADMIN_API_KEYS")
+
+	// Cookie cache
+	overrideString(&cfg.CookieCache.Dir, "COOKIE_CACHE_DIR")
+	overrideString(&cfg.CookieCache.Key, "COOKIE_CACHE_KEY")
+	overrideString(&cfg.CookieCache.KeyFile, "COOKIE_CACHE_KEY_FILE")
+
+	// Limits
+	overrideInt(&cfg.Limits.RequestTimeout, "REQUEST_TIMEOUT")
+	overrideInt(&cfg.Limits.MaxPromptChars, "MAX_PROMPT_CHARS")
+
+	// Ephemeral conversations
+	overrideBool(&cfg.Ephemeral.Enabled, "GEMINI_EPHEMERAL")
+	overrideList(&cfg.Ephemeral.APIKeys, "GEMINI_EPHEMERAL_API_KEYS")
+	overrideInt(&cfg.Ephemeral.SweepInterval, "GEMINI_EPHEMERAL_SWEEP_INTERVAL")
+	overrideInt(&cfg.Ephemeral.MaxAttempts, "GEMINI_EPHEMERAL_MAX_ATTEMPTS")
+
+	// Request priorities
+	overrideList(&cfg.Queue.BatchAPIKeys, "QUEUE_BATCH_API_KEYS")
+	overrideList(&cfg.Queue.ResearchAPIKeys, "QUEUE_RESEARCH_API_KEYS")
+	overrideInt(&cfg.Queue.InteractiveWeight, "QUEUE_WEIGHT_INTERACTIVE")
+	overrideInt(&cfg.Queue.BatchWeight, "QUEUE_WEIGHT_BATCH")
+	overrideInt(&cfg.Queue.ResearchWeight, "QUEUE_WEIGHT_RESEARCH")
+
+	// Response cache
+	overrideBool(&cfg.Cache.Enabled, "CACHE_ENABLED")
+	overrideList(&cfg.Cache.APIKeys, "CACHE_API_KEYS")
+	overrideString(&cfg.Cache.Backend, "CACHE_BACKEND")
+	overrideString(&cfg.Cache.Dir, "CACHE_DIR")
+	overrideInt(&cfg.Cache.MaxEntries, "CACHE_MAX_ENTRIES")
+	overrideInt(&cfg.Cache.TTL, "CACHE_TTL")
+	overrideFloat(&cfg.Cache.MaxTemperature, "CACHE_MAX_TEMPERATURE")
+
+	// Context window
+	overrideString(&cfg.Context.Strategy, "CONTEXT_STRATEGY")
+	overrideInt(&cfg.Context.MaxTokens, "CONTEXT_MAX_TOKENS")
+	overrideInt(&cfg.Context.KeepLast, "CONTEXT_KEEP_LAST")
+	overrideString(&cfg.Context.SummaryModel, "CONTEXT_SUMMARY_MODEL")
+
+	// Model routing
+	overrideString(&cfg.Routing.File, "ROUTES_FILE")
+	overrideString(&cfg.Routing.Template, "PROMPT_TEMPLATE")
+}
+
 // Validate checks if the configuration has required values
 func (c *Config) Validate() error {
 	var missingVars []string
 
-	// Check Gemini configuration - at least one of these should be present
-	if c.Gemini.Secure1PSID == "" {
+	// Check Gemini configuration - at least one of these should be present.
+	// Imported cookies are only checked for __Secure-1PSID once they have been parsed.
+	imported := c.Gemini.Cookies != "" || c.Gemini.CookiesFile != ""
+	if c.Gemini.Secure1PSID == "" && !imported {
 		missingVars = append(missingVars, "GEMINI_1PSID")
 	}
 
-	if c.Gemini.Secure1PSID != "" {
+	if c.Gemini.Secure1PSID != "" && !imported {
 		// If PSID is present, we need at least one of these
 		if c.Gemini.Secure1PSIDTS == "" {
 			missingVars = append(missingVars, "GEMINI_1PSIDTS")
@@ -100,30 +378,170 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("invalid PORT value: %q (must be a number)", c.Server.Port)
 	}
 
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		return fmt.Errorf("invalid LOG_LEVEL value: %q", c.LogLevel)
+	}
+
+	if c.Gemini.BaseURL != "" {
+		if u, err := url.Parse(c.Gemini.BaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid GEMINI_BASE_URL value: %q (must be an http or https URL)", c.Gemini.BaseURL)
+		}
+	}
+
+	switch c.Gemini.RecordMode {
+	case "off", "failures", "all":
+	default:
+		return fmt.Errorf("invalid GEMINI_RECORD value: %q (must be off, failures or all)", c.Gemini.RecordMode)
+	}
+
+	if c.Limits.RequestTimeout <= 0 {
+		return fmt.Errorf("invalid request timeout: %d (must be positive)", c.Limits.RequestTimeout)
+	}
+
+	if c.Gemini.MaxRetries < 0 || c.Gemini.RetryBaseDelay < 0 || c.Gemini.RetryMaxDelay < 0 || c.Gemini.RetryBudget < 0 {
+		return fmt.Errorf("invalid retry settings: retries, delays and budget must be non-negative")
+	}
+
+	if c.Gemini.Concurrency < 1 {
+		return fmt.Errorf("invalid concurrency: %d (must be at least 1)", c.Gemini.Concurrency)
+	}
+
+	if c.Gemini.MaxQueue < 0 || c.Gemini.QueueTimeout < 0 {
+		return fmt.Errorf("invalid queue settings: depth and timeout must be non-negative")
+	}
+
+	if c.Queue.InteractiveWeight < 1 || c.Queue.BatchWeight < 1 || c.Queue.ResearchWeight < 1 {
+		return fmt.Errorf("invalid queue weights: each must be at least 1")
+	}
+
+	switch c.Cache.Backend {
+	case "memory", "disk":
+	default:
+		return fmt.Errorf("invalid CACHE_BACKEND value: %q (must be memory or disk)", c.Cache.Backend)
+	}
+
+	if c.Cache.MaxEntries < 1 || c.Cache.TTL < 1 || c.Cache.MaxTemperature < 0 {
+		return fmt.Errorf("invalid cache settings: entries and TTL must be at least 1, max temperature non-negative")
+	}
+
+	switch c.Context.Strategy {
+	case "reject", "drop_oldest", "keep_last", "summarize":
+	default:
+		return fmt.Errorf("invalid CONTEXT_STRATEGY value: %q (must be reject, drop_oldest, keep_last or summarize)", c.Context.Strategy)
+	}
+
+	if c.Context.MaxTokens < 0 || c.Context.KeepLast < 1 {
+		return fmt.Errorf("invalid context settings: max tokens must be non-negative, keep last at least 1")
+	}
+
+	if c.Limits.MaxPromptChars < 0 {
+		return fmt.Errorf("invalid max prompt chars: %d (must be non-negative)", c.Limits.MaxPromptChars)
+	}
+
+	if c.Routing.Template != "" && !validTemplate(c.Routing.Template) {
+		return fmt.Errorf("invalid PROMPT_TEMPLATE value: %q (must be transcript, xml or instruction)", c.Routing.Template)
+	}
+
+	for i, r := range c.Routing.Rules {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("route %d: %w", i, err)
+		}
+	}
+
 	if len(missingVars) > 0 {
-		return fmt.Errorf("missing required environment variables: %v. Please set them before running the application", missingVars)
+		return fmt.Errorf("missing required settings: %v. Set them in the config file or as environment variables", missingVars)
 	}
 
 	return nil
 }
 
-func getEnv(key, defaultValue string) string {
-	if value, exists := os.LookupEnv(key); exists {
-		return value
+func (r RouteRule) validate() error {
+	switch r.Flavor {
+	case "", "openai", "claude", "gemini":
+	default:
+		return fmt.Errorf("unknown flavor %q", r.Flavor)
+	}
+	switch r.Match {
+	case "", "exact", "prefix", "regex":
+	default:
+		return fmt.Errorf("unknown match type %q", r.Match)
+	}
+	if r.Pattern == "" {
+		return errors.New("pattern is required")
 	}
-	return defaultValue
+	if r.Template != "" && !validTemplate(r.Template) {
+		return fmt.Errorf("unknown prompt template %q", r.Template)
+	}
+	return nil
 }
 
-func getEnvInt(key string, defaultValue int) int {
-	valueStr := os.Getenv(key)
-	if valueStr == "" {
-		return defaultValue
+// validTemplate reports whether name is one of the prompt templates
+func validTemplate(name string) bool {
+	switch name {
+	case "transcript", "xml", "instruction":
+		return true
+	}
+	return false
+}
+
+// loadRoutes reads the routing table file; a missing file means no extra routing rules
+func loadRoutes(routing *RoutingConfig) error {
+	if routing.File == "" {
+		return nil
+	}
+	data, err := os.ReadFile(routing.File)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
 	}
-	value, err := strconv.Atoi(valueStr)
 	if err != nil {
-		return defaultValue
+		return fmt.Errorf("failed to read routes file %s: %w", routing.File, err)
+	}
+
+	var file RoutingConfig
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid routes file %s: %w", routing.File, err)
 	}
-	return value
+	routing.Rules = append(routing.Rules, file.Rules...)
+	return nil
 }
 
+// Empty variables are ignored so a blank line in .env does not erase a value from the config file
 
+func overrideString(field *string, key string) {
+	if value := os.Getenv(key); value != "" {
+		*field = value
+	}
+}
+
+func overrideInt(field *int, key string) {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		*field = value
+	}
+}
+
+func overrideFloat(field *float64, key string) {
+	if value, err := strconv.ParseFloat(os.Getenv(key), 64); err == nil {
+		*field = value
+	}
+}
+
+func overrideBool(field *bool, key string) {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		*field = value
+	}
+}
+
+// overrideList reads a comma-separated list, dropping empty entries
+func overrideList(field *[]string, key string) {
+	value := os.Getenv(key)
+	if value == "" {
+		return
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*field = list
+}
@@ -0,0 +1,266 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"go.yaml.in/yaml/v3"
+)
+
+// fileConfig is the schema of the YAML/TOML config file.
+// Pointer fields distinguish "not set" from zero values so the defaults survive.
+type fileConfig struct {
+	Server struct {
+		Port *int `yaml:"port" toml:"port"`
+	} `yaml:"server" toml:"server"`
+
+	Logging struct {
+		Level *string `yaml:"level" toml:"level"`
+	} `yaml:"logging" toml:"logging"`
+
+	Accounts []fileAccount `yaml:"accounts" toml:"accounts"`
+
+	Gemini struct {
+		RefreshInterval       *int     `yaml:"refresh_interval" toml:"refresh_interval"`
+		MaxRetries            *int     `yaml:"max_retries" toml:"max_retries"`
+		ModelsFile            *string  `yaml:"models_file" toml:"models_file"`
+		ModelsRefreshInterval *int     `yaml:"models_refresh_interval" toml:"models_refresh_interval"`
+		TokenRefreshInterval  *int     `yaml:"token_refresh_interval" toml:"token_refresh_interval"`
+		RetryBaseDelay        *int     `yaml:"retry_base_delay" toml:"retry_base_delay"`
+		RetryMaxDelay         *int     `yaml:"retry_max_delay" toml:"retry_max_delay"`
+		RetryBudget           *int     `yaml:"retry_budget" toml:"retry_budget"`
+		Concurrency           *int     `yaml:"concurrency" toml:"concurrency"`
+		MaxQueue              *int     `yaml:"max_queue" toml:"max_queue"`
+		QueueTimeout          *int     `yaml:"queue_timeout" toml:"queue_timeout"`
+		BaseURL               *string  `yaml:"base_url" toml:"base_url"`
+		RecordMode            *string  `yaml:"record_mode" toml:"record_mode"`
+		RecordDir             *string  `yaml:"record_dir" toml:"record_dir"`
+		APIKeys               []string `yaml:"api_keys" toml:"api_keys"`
+	} `yaml:"gemini" toml:"gemini"`
+
+	OpenAI fileFlavor `yaml:"openai" toml:"openai"`
+	Claude fileFlavor `yaml:"claude" toml:"claude"`
+
+	Admin struct {
+		APIKeys []string `yaml:"api_keys" toml:"api_keys"`
+	} `yaml:"admin" toml:"admin"`
+
+	CookieCache struct {
+		Dir     *string `yaml:"dir" toml:"dir"`
+		Key     *string `yaml:"key" toml:"key"`
+		KeyFile *string `yaml:"key_file" toml:"key_file"`
+	} `yaml:"cookie_cache" toml:"cookie_cache"`
+
+	Limits struct {
+		RequestTimeout *int `yaml:"request_timeout" toml:"request_timeout"`
+		MaxPromptChars *int `yaml:"max_prompt_chars" toml:"max_prompt_chars"`
+	} `yaml:"limits" toml:"limits"`
+
+	Ephemeral struct {
+		Enabled       *bool    `yaml:"enabled" toml:"enabled"`
+		APIKeys       []string `yaml:"api_keys" toml:"api_keys"`
+		SweepInterval *int     `yaml:"sweep_interval" toml:"sweep_interval"`
+		MaxAttempts   *int     `yaml:"max_attempts" toml:"max_attempts"`
+	} `yaml:"ephemeral" toml:"ephemeral"`
+
+	Queue struct {
+		BatchAPIKeys    []string `yaml:"batch_api_keys" toml:"batch_api_keys"`
+		ResearchAPIKeys []string `yaml:"research_api_keys" toml:"research_api_keys"`
+		Weights         struct {
+			Interactive *int `yaml:"interactive" toml:"interactive"`
+			Batch       *int `yaml:"batch" toml:"batch"`
+			Research    *int `yaml:"research" toml:"research"`
+		} `yaml:"weights" toml:"weights"`
+	} `yaml:"queue" toml:"queue"`
+
+	Cache struct {
+		Enabled        *bool    `yaml:"enabled" toml:"enabled"`
+		APIKeys        []string `yaml:"api_keys" toml:"api_keys"`
+		Backend        *string  `yaml:"backend" toml:"backend"`
+		Dir            *string  `yaml:"dir" toml:"dir"`
+		MaxEntries     *int     `yaml:"max_entries" toml:"max_entries"`
+		TTL            *int     `yaml:"ttl" toml:"ttl"`
+		MaxTemperature *float64 `yaml:"max_temperature" toml:"max_temperature"`
+	} `yaml:"cache" toml:"cache"`
+
+	Context struct {
+		Strategy     *string `yaml:"strategy" toml:"strategy"`
+		MaxTokens    *int    `yaml:"max_tokens" toml:"max_tokens"`
+		KeepLast     *int    `yaml:"keep_last" toml:"keep_last"`
+		SummaryModel *string `yaml:"summary_model" toml:"summary_model"`
+	} `yaml:"context" toml:"context"`
+
+	RoutesFile     *string     `yaml:"routes_file" toml:"routes_file"`
+	PromptTemplate *string     `yaml:"prompt_template" toml:"prompt_template"`
+	Routes         []RouteRule `yaml:"routes" toml:"routes"`
+}
+
+type fileAccount struct {
+	Name          string `yaml:"name" toml:"name"`
+	Secure1PSID   string `yaml:"secure_1psid" toml:"secure_1psid"`
+	Secure1PSIDTS string `yaml:"secure_1psidts" toml:"secure_1psidts"`
+	Secure1PSIDCC string `yaml:"secure_1psidcc" toml:"secure_1psidcc"`
+	Cookies       string `yaml:"cookies" toml:"cookies"`
+	CookiesFile   string `yaml:"cookies_file" toml:"cookies_file"`
+}
+
+type fileFlavor struct {
+	APIKeys []string `yaml:"api_keys" toml:"api_keys"`
+	Model   *string  `yaml:"model" toml:"model"`
+}
+
+// loadFile decodes the config file at path over cfg.
+// Unknown keys are rejected so typos do not silently fall back to defaults.
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	var file fileConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	case ".toml":
+		md, err := toml.Decode(string(data), &file)
+		if err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+		if undecoded := md.Undecoded(); len(undecoded) > 0 {
+			keys := make([]string, 0, len(undecoded))
+			for _, key := range undecoded {
+				keys = append(keys, key.String())
+			}
+			return fmt.Errorf("invalid config file %s: unknown keys %s", path, strings.Join(keys, ", "))
+		}
+	default:
+		return fmt.Errorf("unsupported config file format %q (use .yaml, .yml or .toml)", filepath.Ext(path))
+	}
+
+	if err := file.apply(cfg); err != nil {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// apply copies the values set in the file into cfg
+func (f *fileConfig) apply(cfg *Config) error {
+	if f.Server.Port != nil {
+		cfg.Server.Port = strconv.Itoa(*f.Server.Port)
+	}
+	setString(&cfg.LogLevel, f.Logging.Level)
+
+	// Only one account is served at a time; the first one is active
+	if len(f.Accounts) > 0 {
+		account := f.Accounts[0]
+		for i, a := range f.Accounts {
+			if a.Secure1PSID == "" && a.Cookies == "" && a.CookiesFile == "" {
+				return fmt.Errorf("accounts[%d]: secure_1psid, cookies or cookies_file is required", i)
+			}
+		}
+		cfg.Gemini.Account = account.Name
+		cfg.Gemini.Secure1PSID = account.Secure1PSID
+		cfg.Gemini.Secure1PSIDTS = account.Secure1PSIDTS
+		cfg.Gemini.Secure1PSIDCC = account.Secure1PSIDCC
+		cfg.Gemini.Cookies = account.Cookies
+		cfg.Gemini.CookiesFile = account.CookiesFile
+	}
+
+	setInt(&cfg.Gemini.RefreshInterval, f.Gemini.RefreshInterval)
+	setInt(&cfg.Gemini.MaxRetries, f.Gemini.MaxRetries)
+	setString(&cfg.Gemini.ModelsFile, f.Gemini.ModelsFile)
+	setInt(&cfg.Gemini.ModelsRefresh, f.Gemini.ModelsRefreshInterval)
+	setInt(&cfg.Gemini.TokenRefresh, f.Gemini.TokenRefreshInterval)
+	setInt(&cfg.Gemini.RetryBaseDelay, f.Gemini.RetryBaseDelay)
+	setInt(&cfg.Gemini.RetryMaxDelay, f.Gemini.RetryMaxDelay)
+	setInt(&cfg.Gemini.RetryBudget, f.Gemini.RetryBudget)
+	setInt(&cfg.Gemini.Concurrency, f.Gemini.Concurrency)
+	setInt(&cfg.Gemini.MaxQueue, f.Gemini.MaxQueue)
+	setInt(&cfg.Gemini.QueueTimeout, f.Gemini.QueueTimeout)
+	setString(&cfg.Gemini.BaseURL, f.Gemini.BaseURL)
+	setString(&cfg.Gemini.RecordMode, f.Gemini.RecordMode)
+	setString(&cfg.Gemini.RecordDir, f.Gemini.RecordDir)
+	setList(&cfg.Gemini.APIKeys, f.Gemini.APIKeys)
+
+	setList(&cfg.OpenAI.APIKeys, f.OpenAI.APIKeys)
+	setString(&cfg.OpenAI.Model, f.OpenAI.Model)
+	setList(&cfg.Claude.APIKeys, f.Claude.APIKeys)
+	setString(&cfg.Claude.Model, f.Claude.Model)
+	setList(&cfg.Admin.APIKeys, f.Admin.APIKeys)
+
+	setString(&cfg.CookieCache.Dir, f.CookieCache.Dir)
+	setString(&cfg.CookieCache.Key, f.CookieCache.Key)
+	setString(&cfg.CookieCache.KeyFile, f.CookieCache.KeyFile)
+
+	setInt(&cfg.Limits.RequestTimeout, f.Limits.RequestTimeout)
+	setInt(&cfg.Limits.MaxPromptChars, f.Limits.MaxPromptChars)
+
+	if f.Ephemeral.Enabled != nil {
+		cfg.Ephemeral.Enabled = *f.Ephemeral.Enabled
+	}
+	setList(&cfg.Ephemeral.APIKeys, f.Ephemeral.APIKeys)
+	setInt(&cfg.Ephemeral.SweepInterval, f.Ephemeral.SweepInterval)
+	setInt(&cfg.Ephemeral.MaxAttempts, f.Ephemeral.MaxAttempts)
+
+	setList(&cfg.Queue.BatchAPIKeys, f.Queue.BatchAPIKeys)
+	setList(&cfg.Queue.ResearchAPIKeys, f.Queue.ResearchAPIKeys)
+	setInt(&cfg.Queue.InteractiveWeight, f.Queue.Weights.Interactive)
+	setInt(&cfg.Queue.BatchWeight, f.Queue.Weights.Batch)
+	setInt(&cfg.Queue.ResearchWeight, f.Queue.Weights.Research)
+
+	if f.Cache.Enabled != nil {
+		cfg.Cache.Enabled = *f.Cache.Enabled
+	}
+	setList(&cfg.Cache.APIKeys, f.Cache.APIKeys)
+	setString(&cfg.Cache.Backend, f.Cache.Backend)
+	setString(&cfg.Cache.Dir, f.Cache.Dir)
+	setInt(&cfg.Cache.MaxEntries, f.Cache.MaxEntries)
+	setInt(&cfg.Cache.TTL, f.Cache.TTL)
+	if f.Cache.MaxTemperature != nil {
+		cfg.Cache.MaxTemperature = *f.Cache.MaxTemperature
+	}
+
+	setString(&cfg.Context.Strategy, f.Context.Strategy)
+	setInt(&cfg.Context.MaxTokens, f.Context.MaxTokens)
+	setInt(&cfg.Context.KeepLast, f.Context.KeepLast)
+	setString(&cfg.Context.SummaryModel, f.Context.SummaryModel)
+
+	setString(&cfg.Routing.File, f.RoutesFile)
+	setString(&cfg.Routing.Template, f.PromptTemplate)
+	for i, r := range f.Routes {
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("routes[%d]: %w", i, err)
+		}
+	}
+	cfg.Routing.Rules = append(cfg.Routing.Rules, f.Routes...)
+	return nil
+}
+
+func setString(field *string, value *string) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+func setInt(field *int, value *int) {
+	if value != nil {
+		*field = *value
+	}
+}
+
+func setList(field *[]string, value []string) {
+	if value != nil {
+		*field = value
+	}
+}
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"context"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const defaultWatchIntervalSeconds = 5
+
+// Store holds the live configuration and reloads it when the config or routes file changes.
+// Components that can apply settings at runtime subscribe to it; the server port is only
+// read at startup.
+type Store struct {
+	mu          sync.RWMutex
+	current     *Config
+	subscribers []func(*Config)
+	modTimes    map[string]time.Time
+	interval    time.Duration
+	log         *zap.Logger
+	stop        chan struct{}
+}
+
+// NewStore wraps the startup configuration and ties the file watcher to the app lifecycle
+func NewStore(lc fx.Lifecycle, cfg *Config, log *zap.Logger) *Store {
+	interval := defaultWatchIntervalSeconds
+	overrideInt(&interval, "CONFIG_WATCH_INTERVAL")
+
+	s := &Store{
+		current:  cfg,
+		interval: time.Duration(interval) * time.Second,
+		log:      log,
+		stop:     make(chan struct{}),
+	}
+	s.modTimes = s.watchedModTimes(cfg)
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			if s.interval > 0 {
+				go s.watch()
+			}
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(s.stop)
+			return nil
+		},
+	})
+
+	return s
+}
+
+// Current returns the configuration in effect. Callers must not modify it.
+func (s *Store) Current() *Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.current
+}
+
+// Subscribe registers fn to be called with the new configuration after each successful reload
+func (s *Store) Subscribe(fn func(*Config)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subscribers = append(s.subscribers, fn)
+}
+
+// Reload re-reads the configuration; on error the current configuration stays in effect
+func (s *Store) Reload() error {
+	cfg, err := Load()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	if cfg.Server.Port != s.current.Server.Port {
+		s.log.Warn("Server port changed, restart to apply", zap.String("port", cfg.Server.Port))
+	}
+	s.current = cfg
+	s.modTimes = s.watchedModTimes(cfg)
+	subscribers := append([]func(*Config){}, s.subscribers...)
+	s.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(cfg)
+	}
+	s.log.Info("Configuration reloaded", zap.String("file", cfg.File))
+	return nil
+}
+
+// watch polls the modification times of the config and routes files
+func (s *Store) watch() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !s.changed() {
+				continue
+			}
+			if err := s.Reload(); err != nil {
+				s.log.Error("Configuration reload failed, keeping current settings", zap.Error(err))
+				// Do not retry the same broken file on every tick
+				s.mu.Lock()
+				s.modTimes = s.watchedModTimes(s.current)
+				s.mu.Unlock()
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+func (s *Store) changed() bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	current := s.watchedModTimes(s.current)
+	if len(current) != len(s.modTimes) {
+		return true
+	}
+	for path, modTime := range current {
+		if !s.modTimes[path].Equal(modTime) {
+			return true
+		}
+	}
+	return false
+}
+
+// watchedModTimes returns the modification times of the files cfg was built from.
+// A missing file is recorded with a zero time so that creating it triggers a reload.
+func (s *Store) watchedModTimes(cfg *Config) map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, path := range append([]string{cfg.File, cfg.Routing.File}, defaultConfigFiles...) {
+		if path == "" {
+			continue
+		}
+		var modTime time.Time
+		if info, err := os.Stat(path); err == nil {
+			modTime = info.ModTime()
+		}
+		modTimes[path] = modTime
+	}
+	return modTimes
+}
@@ -0,0 +1,250 @@
+package contextwindow
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/ephemeral"
+	"gemini-web-to-api/internal/models"
+	"gemini-web-to-api/internal/providers"
+	"gemini-web-to-api/internal/providers/gemini"
+
+	"go.uber.org/zap"
+)
+
+// What to do with a conversation longer than the model's context window
+const (
+	StrategyReject     = "reject"      // fail with context_length_exceeded
+	StrategyDropOldest = "drop_oldest" // leave out the oldest turns until the rest fits
+	StrategyKeepLast   = "keep_last"   // keep the system messages and the last turns
+	StrategySummarize  = "summarize"   // replace the turns keep_last leaves out with a summary
+)
+
+// summaryInstruction asks for the summary that stands in for the older turns
+const summaryInstruction = "Summarize the following conversation in a few short paragraphs. " +
+	"Keep the facts, decisions and open questions needed to continue it. Reply with the summary only.\n\n"
+
+// Generator answers summary requests and knows the context window of each model
+type Generator interface {
+	GenerateContent(ctx context.Context, prompt string, options ...providers.GenerateOption) (*providers.Response, error)
+	GetModel(id string) (providers.ModelInfo, bool)
+}
+
+// Manager fits conversations into the context window of the model they are sent to
+type Manager struct {
+	generator Generator
+	release   func(conversationID string) // deletes the conversations of summary requests
+	tokenizer Tokenizer
+	log       *zap.Logger
+
+	mu           sync.Mutex // guards the policy fields
+	strategy     string
+	maxTokens    int
+	keepLast     int
+	summaryModel string
+}
+
+// NewManager creates the context manager
+func NewManager(cfg *config.Config, client *gemini.Client, ephemeralManager *ephemeral.Manager, log *zap.Logger) *Manager {
+	return newManager(cfg.Context, client, ephemeralManager.Release, log)
+}
+
+func newManager(cfg config.ContextConfig, generator Generator, release func(string), log *zap.Logger) *Manager {
+	m := &Manager{generator: generator, release: release, tokenizer: Estimator{}, log: log}
+	m.SetPolicy(cfg)
+	return m
+}
+
+// SetPolicy updates the strategy and limits
+func (m *Manager) SetPolicy(cfg config.ContextConfig) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.strategy = cfg.Strategy
+	m.maxTokens = cfg.MaxTokens
+	m.keepLast = cfg.KeepLast
+	m.summaryModel = cfg.SummaryModel
+}
+
+// Count measures text in tokens
+func (m *Manager) Count(text string) int {
+	return m.tokenizer.Count(text)
+}
+
+// Limit returns the context window of a model, falling back to the configured maximum
+// for models whose window is unknown. Zero means no limit.
+func (m *Manager) Limit(model string) int {
+	if info, ok := m.generator.GetModel(model); ok && info.ContextWindow > 0 {
+		return info.ContextWindow
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.maxTokens
+}
+
+// Result is a prompt that fits the context window, and how the conversation was shortened
+type Result struct {
+	Prompt     string
+	Tokens     int
+	Limit      int    // zero when the model has no limit
+	Strategy   string // the strategy that shortened the conversation, empty when it fit as is
+	Dropped    int    // messages left out
+	Summarized int    // messages replaced by a summary
+}
+
+// Truncated reports whether the prompt leaves part of the conversation out
+func (r *Result) Truncated() bool {
+	return r.Strategy != ""
+}
+
+// Fit builds the prompt for a conversation with build, shortening the conversation by the
+// configured strategy when the prompt is over the model's context window. System messages
+// and the last message are always kept; when they alone are over, or the strategy is
+// reject, Fit fails with a context_length_exceeded error.
+func (m *Manager) Fit(ctx context.Context, model string, messages []models.Message, build func([]models.Message) string) (*Result, error) {
+	m.mu.Lock()
+	strategy, keepLast, summaryModel := m.strategy, m.keepLast, m.summaryModel
+	m.mu.Unlock()
+
+	result := &Result{Prompt: build(messages), Limit: m.Limit(model)}
+	result.Tokens = m.Count(result.Prompt)
+	if result.Limit == 0 || result.Tokens <= result.Limit {
+		return result, nil
+	}
+	if strategy == StrategyReject || len(messages) == 0 {
+		return nil, exceeded(result.Tokens, result.Limit)
+	}
+
+	// Turns before the last message may be left out, oldest first
+	var older []int
+	for i, msg := range messages[:len(messages)-1] {
+		if !isSystem(msg) {
+			older = append(older, i)
+		}
+	}
+	keep := make([]bool, len(messages))
+	for i := range keep {
+		keep[i] = true
+	}
+
+	var summary string
+	if strategy == StrategyKeepLast || strategy == StrategySummarize {
+		cut := older[:max(0, len(older)-(keepLast-1))]
+		for _, i := range cut {
+			keep[i] = false
+		}
+		older = older[len(cut):]
+
+		if strategy == StrategySummarize && len(cut) > 0 {
+			text, err := m.summarize(ctx, summaryModel, pick(messages, cut))
+			if err != nil {
+				m.log.Warn("Failed to summarize older turns, leaving them out", zap.Error(err))
+				strategy = StrategyKeepLast
+			} else {
+				summary = text
+			}
+		}
+		if summary != "" {
+			result.Summarized = len(cut)
+		} else {
+			result.Dropped = len(cut)
+		}
+	}
+	result.Strategy = strategy
+
+	for {
+		result.Prompt = build(compose(messages, keep, summary))
+		result.Tokens = m.Count(result.Prompt)
+		if result.Tokens <= result.Limit {
+			return result, nil
+		}
+
+		// Leave out about as many turns as the prompt is over, then measure again
+		over := result.Tokens - result.Limit
+		switch {
+		case len(older) > 0:
+			for over > 0 && len(older) > 0 {
+				over -= m.Count(messages[older[0]].Content)
+				keep[older[0]] = false
+				older = older[1:]
+				result.Dropped++
+			}
+		case summary != "":
+			summary = ""
+			result.Dropped += result.Summarized
+			result.Summarized = 0
+		default:
+			return nil, exceeded(result.Tokens, result.Limit)
+		}
+	}
+}
+
+// summarize asks the summary model to sum up the turns that no longer fit
+func (m *Manager) summarize(ctx context.Context, model string, messages []models.Message) (string, error) {
+	var b strings.Builder
+	b.WriteString(summaryInstruction)
+	for _, msg := range messages {
+		role := "User"
+		if strings.EqualFold(msg.Role, "assistant") || strings.EqualFold(msg.Role, "model") {
+			role = "Model"
+		}
+		fmt.Fprintf(&b, "%s: %s\n", role, msg.Content)
+	}
+
+	var opts []providers.GenerateOption
+	if model != "" {
+		opts = append(opts, providers.WithModel(model))
+	}
+	response, err := m.generator.GenerateContent(ctx, b.String(), opts...)
+	if err != nil {
+		return "", err
+	}
+
+	// The summary request is not a conversation the client knows about
+	cid := response.ConversationID
+	if cid == "" {
+		cid, _ = response.Metadata["cid"].(string)
+	}
+	m.release(cid)
+
+	text := strings.TrimSpace(response.Text)
+	if text == "" {
+		return "", fmt.Errorf("empty summary")
+	}
+	return text, nil
+}
+
+// compose returns the kept messages, with the summary after the leading system messages
+func compose(messages []models.Message, keep []bool, summary string) []models.Message {
+	out := make([]models.Message, 0, len(messages)+1)
+	placed := summary == ""
+	for i, msg := range messages {
+		if !placed && !isSystem(msg) {
+			out = append(out, models.Message{Role: "system", Content: "Summary of the earlier conversation: " + summary})
+			placed = true
+		}
+		if keep[i] {
+			out = append(out, msg)
+		}
+	}
+	return out
+}
+
+func pick(messages []models.Message, indexes []int) []models.Message {
+	out := make([]models.Message, len(indexes))
+	for i, index := range indexes {
+		out[i] = messages[index]
+	}
+	return out
+}
+
+func isSystem(msg models.Message) bool {
+	return strings.EqualFold(msg.Role, "system")
+}
+
+func exceeded(tokens, limit int) error {
+	return providers.NewError(providers.ErrContextExceeded,
+		fmt.Sprintf("the conversation is about %d tokens, more than the model's context window of %d", tokens, limit), nil)
+}
@@ -0,0 +1,183 @@
+package contextwindow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/models"
+	"gemini-web-to-api/internal/providers"
+
+	"go.uber.org/zap/zaptest"
+)
+
+type fakeGenerator struct {
+	windows  map[string]int
+	summary  string
+	err      error
+	prompts  []string
+	released []string
+}
+
+func (g *fakeGenerator) GenerateContent(ctx context.Context, prompt string, options ...providers.GenerateOption) (*providers.Response, error) {
+	g.prompts = append(g.prompts, prompt)
+	if g.err != nil {
+		return nil, g.err
+	}
+	return &providers.Response{Text: g.summary, ConversationID: "c_summary"}, nil
+}
+
+func (g *fakeGenerator) GetModel(id string) (providers.ModelInfo, bool) {
+	window, ok := g.windows[id]
+	return providers.ModelInfo{ID: id, ContextWindow: window}, ok
+}
+
+// build renders a message as its content, so a test can count tokens by words
+func build(messages []models.Message) string {
+	var lines []string
+	for _, msg := range messages {
+		lines = append(lines, msg.Content)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// conversation is a system message and n turns of four one-token words each
+func conversation(n int) []models.Message {
+	messages := []models.Message{{Role: "system", Content: "sys"}}
+	for i := 0; i < n; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages = append(messages, models.Message{Role: role, Content: fmt.Sprintf("t%d aa bb cc", i)})
+	}
+	return messages
+}
+
+func newTestManager(t *testing.T, strategy string, g *fakeGenerator) *Manager {
+	t.Helper()
+	cfg := config.ContextConfig{Strategy: strategy, MaxTokens: 10, KeepLast: 2, SummaryModel: "summarizer"}
+	return newManager(cfg, g, func(cid string) { g.released = append(g.released, cid) }, zaptest.NewLogger(t))
+}
+
+func TestFitWithinWindow(t *testing.T) {
+	m := newTestManager(t, StrategyReject, &fakeGenerator{})
+	result, err := m.Fit(context.Background(), "unknown", conversation(2), build)
+	if err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+	if result.Truncated() || result.Prompt != build(conversation(2)) || result.Tokens != 9 {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestFitUsesModelWindow(t *testing.T) {
+	m := newTestManager(t, StrategyReject, &fakeGenerator{windows: map[string]int{"big": 100}})
+	if _, err := m.Fit(context.Background(), "big", conversation(6), build); err != nil {
+		t.Errorf("Fit within the model's own window: %v", err)
+	}
+	if _, err := m.Fit(context.Background(), "small", conversation(6), build); err == nil {
+		t.Error("Fit over the configured maximum succeeded")
+	}
+}
+
+func TestFitReject(t *testing.T) {
+	m := newTestManager(t, StrategyReject, &fakeGenerator{})
+	_, err := m.Fit(context.Background(), "", conversation(6), build)
+	var perr *providers.Error
+	if !errors.As(err, &perr) || perr.Kind != providers.ErrContextExceeded {
+		t.Fatalf("err = %v, want context_length_exceeded", err)
+	}
+}
+
+func TestFitDropOldest(t *testing.T) {
+	m := newTestManager(t, StrategyDropOldest, &fakeGenerator{})
+	result, err := m.Fit(context.Background(), "", conversation(6), build)
+	if err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+	if want := "sys\nt4 aa bb cc\nt5 aa bb cc"; result.Prompt != want {
+		t.Errorf("prompt = %q, want %q", result.Prompt, want)
+	}
+	if result.Strategy != StrategyDropOldest || result.Dropped != 4 || result.Tokens > result.Limit {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestFitKeepLast(t *testing.T) {
+	m := newTestManager(t, StrategyKeepLast, &fakeGenerator{})
+	m.SetPolicy(config.ContextConfig{Strategy: StrategyKeepLast, MaxTokens: 20, KeepLast: 2})
+	result, err := m.Fit(context.Background(), "", conversation(6), build)
+	if err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+	// Only the last two turns are kept, even though a third would fit
+	if want := "sys\nt4 aa bb cc\nt5 aa bb cc"; result.Prompt != want {
+		t.Errorf("prompt = %q, want %q", result.Prompt, want)
+	}
+	if result.Dropped != 4 {
+		t.Errorf("dropped = %d, want 4", result.Dropped)
+	}
+}
+
+func TestFitSummarize(t *testing.T) {
+	g := &fakeGenerator{summary: "they met"}
+	m := newTestManager(t, StrategySummarize, g)
+	m.SetPolicy(config.ContextConfig{Strategy: StrategySummarize, MaxTokens: 30, KeepLast: 2})
+	result, err := m.Fit(context.Background(), "", conversation(10), build)
+	if err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+	if want := "sys\nSummary of the earlier conversation: they met\nt8 aa bb cc\nt9 aa bb cc"; result.Prompt != want {
+		t.Errorf("prompt = %q, want %q", result.Prompt, want)
+	}
+	if result.Summarized != 8 || result.Dropped != 0 {
+		t.Errorf("result = %+v", result)
+	}
+	if len(g.prompts) != 1 || !strings.Contains(g.prompts[0], "User: t0 aa bb cc\nModel: t1 aa bb cc") {
+		t.Errorf("summary prompts = %q", g.prompts)
+	}
+	if len(g.released) != 1 || g.released[0] != "c_summary" {
+		t.Errorf("released = %v", g.released)
+	}
+}
+
+func TestFitSummarizeFailureDrops(t *testing.T) {
+	m := newTestManager(t, StrategySummarize, &fakeGenerator{err: errors.New("upstream down")})
+	result, err := m.Fit(context.Background(), "", conversation(6), build)
+	if err != nil {
+		t.Fatalf("Fit: %v", err)
+	}
+	if result.Strategy != StrategyKeepLast || result.Dropped != 4 || result.Summarized != 0 {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestFitLastMessageTooLong(t *testing.T) {
+	m := newTestManager(t, StrategyDropOldest, &fakeGenerator{})
+	messages := append(conversation(2), models.Message{Role: "user", Content: strings.Repeat("x ", 20)})
+	if _, err := m.Fit(context.Background(), "", messages, build); err == nil {
+		t.Error("Fit succeeded although the last message alone is over the window")
+	}
+}
+
+func TestEstimator(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hi there", 3},
+		{"internationalization", 5},
+		{"Hello, world!", 6},
+		{"你好世界", 4},
+	}
+	for _, tt := range tests {
+		if got := (Estimator{}).Count(tt.text); got != tt.want {
+			t.Errorf("Count(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
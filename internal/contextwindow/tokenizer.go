@@ -0,0 +1,41 @@
+package contextwindow
+
+import (
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenizer measures text in model tokens
+type Tokenizer interface {
+	Count(text string) int
+}
+
+// Estimator approximates Gemini's tokenizer without a vocabulary: a word takes a token
+// per four bytes, punctuation a token per mark, and CJK text a token per character.
+// It errs on the high side, so a prompt it accepts fits.
+type Estimator struct{}
+
+// Count estimates the number of tokens in text
+func (Estimator) Count(text string) int {
+	tokens, word := 0, 0
+	flush := func() {
+		tokens += (word + 3) / 4
+		word = 0
+	}
+	for _, r := range text {
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			flush()
+			tokens++
+		case unicode.IsPunct(r) || unicode.IsSymbol(r):
+			flush()
+			tokens++
+		default:
+			word += utf8.RuneLen(r)
+		}
+	}
+	flush()
+	return tokens
+}
@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"gemini-web-to-api/internal/handlers"
+)
+
+// AdminController registers the account management endpoints and contains Swagger annotations.
+type AdminController struct {
+	handler *handlers.AdminHandler
+}
+
+func NewAdminController(h *handlers.AdminHandler) *AdminController {
+	return &AdminController{handler: h}
+}
+
+// HandleStatus reports the session state of each account
+// @Summary Account status
+// @Description Cookie age, last rotation result and session token (SNlM0e) status of each account
+// @Tags Admin
+// @Produce json
+// @Security AdminKey
+// @Success 200 {object} models.AdminStatusResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Router /admin/status [get]
+func (a *AdminController) HandleStatus(ctx *fiber.Ctx) error {
+	return a.handler.HandleStatus(ctx)
+}
+
+// HandleUpdateCookies applies new session cookies to the running client
+// @Summary Update cookies
+// @Description Replaces __Secure-1PSID / __Secure-1PSIDTS and starts a new session with them
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Security AdminKey
+// @Param request body models.AdminCookiesRequest true "New cookies"
+// @Success 200 {object} models.AdminAccountStatus
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
+// @Router /admin/cookies [put]
+func (a *AdminController) HandleUpdateCookies(ctx *fiber.Ctx) error {
+	return a.handler.HandleUpdateCookies(ctx)
+}
+
+// HandleImportCookies applies an exported cookie set
+// @Summary Import cookies
+// @Description Accepts a Cookie header string, a Netscape cookies.txt or the JSON of cookie-export extensions, as the body or a multipart "file". All google.com cookies are applied to the running client.
+// @Tags Admin
+// @Accept plain
+// @Accept json
+// @Accept mpfd
+// @Produce json
+// @Security AdminKey
+// @Param file formData file false "Cookie file"
+// @Success 200 {object} models.AdminCookieImportResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 502 {object} models.ErrorResponse
+// @Router /admin/cookies/import [post]
+func (a *AdminController) HandleImportCookies(ctx *fiber.Ctx) error {
+	return a.handler.HandleImportCookies(ctx)
+}
+
+// HandleRotate forces a cookie rotation
+// @Summary Rotate cookies
+// @Description Forces a __Secure-1PSIDTS rotation
+// @Tags Admin
+// @Produce json
+// @Security AdminKey
+// @Success 200 {object} models.AdminAccountStatus
+// @Failure 502 {object} models.ErrorResponse
+// @Router /admin/cookies/rotate [post]
+func (a *AdminController) HandleRotate(ctx *fiber.Ctx) error {
+	return a.handler.HandleRotate(ctx)
+}
+
+// HandleClearCookieCache deletes the cached cookies
+// @Summary Clear cookie cache
+// @Description Deletes the cached cookies of the current account
+// @Tags Admin
+// @Security AdminKey
+// @Success 204
+// @Router /admin/cookies/cache [delete]
+func (a *AdminController) HandleClearCookieCache(ctx *fiber.Ctx) error {
+	return a.handler.HandleClearCookieCache(ctx)
+}
+
+// HandleReinit re-initializes the session
+// @Summary Re-initialize session
+// @Description Fetches a new session token, rotating cookies first if needed
+// @Tags Admin
+// @Produce json
+// @Security AdminKey
+// @Success 200 {object} models.AdminAccountStatus
+// @Failure 502 {object} models.ErrorResponse
+// @Router /admin/reinit [post]
+func (a *AdminController) HandleReinit(ctx *fiber.Ctx) error {
+	return a.handler.HandleReinit(ctx)
+}
+
+// Register registers the admin routes onto the provided group
+func (a *AdminController) Register(group fiber.Router) {
+	group.Get("/status", a.HandleStatus)
+	group.Put("/cookies", a.HandleUpdateCookies)
+	group.Post("/cookies/import", a.HandleImportCookies)
+	group.Post("/cookies/rotate", a.HandleRotate)
+	group.Delete("/cookies/cache", a.HandleClearCookieCache)
+	group.Post("/reinit", a.HandleReinit)
+}
@@ -27,6 +27,19 @@ func (g *GeminiController) HandleV1BetaModels(ctx *fiber.Ctx) error {
 	return g.handler.HandleV1BetaModels(ctx)
 }
 
+// HandleV1BetaGetModel returns a single model in Gemini format
+// @Summary Get Gemini Model (v1beta)
+// @Description Returns a model, alias or Gem by ID
+// @Tags Gemini v1beta
+// @Produce json
+// @Param model path string true "Model name"
+// @Success 200 {object} models.GeminiModel
+// @Failure 404 {object} models.ErrorResponse
+// @Router /gemini/v1beta/models/{model} [get]
+func (g *GeminiController) HandleV1BetaGetModel(ctx *fiber.Ctx) error {
+	return g.handler.HandleV1BetaGetModel(ctx)
+}
+
 // HandleV1BetaGenerateContent handles the official Gemini generateContent endpoint
 // @Summary Generate Content (v1beta)
 // @Description Compatible with official Google Gemini API
@@ -56,20 +69,74 @@ func (g *GeminiController) HandleV1BetaStreamGenerateContent(ctx *fiber.Ctx) err
 
 // HandleRetrieveDeepResearch fetches existing deep research content
 // @Summary Retrieve Deep Research Content
-// @Description Fetches report text and references for a given conversation
+// @Description Fetches the structured report (sections, tables, research steps and references) for a given conversation
 // @Tags Gemini
 // @Produce json
 // @Param conversationID path string true "Conversation ID"
-// @Success 200 {object} providers.Response
+// @Success 200 {object} providers.ResearchReport
 // @Router /gemini/v1beta/conversations/{conversationID}/research [get]
 func (g *GeminiController) HandleRetrieveDeepResearch(ctx *fiber.Ctx) error {
 	return g.handler.HandleRetrieveDeepResearch(ctx)
 }
 
+// HandleListConversations lists recent conversations
+// @Summary List Conversations
+// @Description Lists the most recent conversations in the Gemini account history
+// @Tags Gemini
+// @Produce json
+// @Param limit query int false "Maximum number of conversations"
+// @Success 200 {object} models.ConversationListResponse
+// @Router /gemini/v1beta/conversations [get]
+func (g *GeminiController) HandleListConversations(ctx *fiber.Ctx) error {
+	return g.handler.HandleListConversations(ctx)
+}
+
+// HandleGetConversation returns a conversation's turns
+// @Summary Get Conversation
+// @Description Returns the prompt/reply turns of a conversation, oldest first
+// @Tags Gemini
+// @Produce json
+// @Param conversationID path string true "Conversation ID"
+// @Param limit query int false "Maximum number of turns"
+// @Success 200 {object} models.ConversationResponse
+// @Router /gemini/v1beta/conversations/{conversationID} [get]
+func (g *GeminiController) HandleGetConversation(ctx *fiber.Ctx) error {
+	return g.handler.HandleGetConversation(ctx)
+}
+
+// HandleUpdateConversation renames and/or pins a conversation
+// @Summary Update Conversation
+// @Description Renames and/or pins a conversation
+// @Tags Gemini
+// @Accept json
+// @Param conversationID path string true "Conversation ID"
+// @Param request body models.ConversationUpdateRequest true "Fields to update"
+// @Success 204
+// @Router /gemini/v1beta/conversations/{conversationID} [patch]
+func (g *GeminiController) HandleUpdateConversation(ctx *fiber.Ctx) error {
+	return g.handler.HandleUpdateConversation(ctx)
+}
+
+// HandleDeleteConversation deletes a conversation
+// @Summary Delete Conversation
+// @Description Removes a conversation from the Gemini account history
+// @Tags Gemini
+// @Param conversationID path string true "Conversation ID"
+// @Success 204
+// @Router /gemini/v1beta/conversations/{conversationID} [delete]
+func (g *GeminiController) HandleDeleteConversation(ctx *fiber.Ctx) error {
+	return g.handler.HandleDeleteConversation(ctx)
+}
+
 // Register registers the Gemini routes on the provided router (typically a group)
 func (g *GeminiController) Register(group fiber.Router) {
 	group.Get("/models", g.HandleV1BetaModels)
+	group.Get("/models/:model", g.HandleV1BetaGetModel)
 	group.Post("/models/:model\\:generateContent", g.HandleV1BetaGenerateContent)
 	group.Post("/models/:model\\:streamGenerateContent", g.HandleV1BetaStreamGenerateContent)
+	group.Get("/conversations", g.HandleListConversations)
+	group.Get("/conversations/:conversationID", g.HandleGetConversation)
+	group.Patch("/conversations/:conversationID", g.HandleUpdateConversation)
+	group.Delete("/conversations/:conversationID", g.HandleDeleteConversation)
 	group.Get("/conversations/:conversationID/research", g.HandleRetrieveDeepResearch)
 }
\ No newline at end of file
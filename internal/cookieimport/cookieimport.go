@@ -0,0 +1,243 @@
+// Package cookieimport reads browser cookies from the formats users can export them in:
+// a Cookie header string, a Netscape cookies.txt file, or the JSON produced by
+// cookie-export browser extensions.
+package cookieimport
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Format identifies how imported cookies were encoded
+type Format string
+
+const (
+	FormatHeader   Format = "header"
+	FormatNetscape Format = "netscape"
+	FormatJSON     Format = "json"
+)
+
+// GoogleDomain is the domain the Gemini session cookies belong to
+const GoogleDomain = ".google.com"
+
+var ErrNoCookies = errors.New("no cookies found")
+
+// Parse detects the format of data and decodes the cookies it contains
+func Parse(data []byte) ([]*http.Cookie, Format, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return nil, "", ErrNoCookies
+	}
+
+	switch {
+	case trimmed[0] == '[' || trimmed[0] == '{':
+		cookies, err := ParseJSON(trimmed)
+		return cookies, FormatJSON, err
+	case isNetscape(trimmed):
+		cookies, err := ParseNetscape(trimmed)
+		return cookies, FormatNetscape, err
+	default:
+		cookies := ParseHeader(string(trimmed))
+		if len(cookies) == 0 {
+			return nil, FormatHeader, ErrNoCookies
+		}
+		return cookies, FormatHeader, nil
+	}
+}
+
+// ReadFile parses the cookie file at path
+func ReadFile(path string) ([]*http.Cookie, Format, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read cookie file %s: %w", path, err)
+	}
+	cookies, format, err := Parse(data)
+	if err != nil {
+		return nil, format, fmt.Errorf("invalid cookie file %s: %w", path, err)
+	}
+	return cookies, format, nil
+}
+
+// ParseHeader reads "name=value; name2=value2", with or without a leading "Cookie:"
+func ParseHeader(header string) []*http.Cookie {
+	header = strings.TrimSpace(header)
+	if len(header) > 7 && strings.EqualFold(header[:7], "cookie:") {
+		header = header[7:]
+	}
+
+	var cookies []*http.Cookie
+	for _, part := range strings.Split(header, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			continue
+		}
+		cookies = append(cookies, &http.Cookie{
+			Name:   name,
+			Value:  strings.Trim(strings.TrimSpace(value), `"`),
+			Domain: GoogleDomain,
+			Path:   "/",
+		})
+	}
+	return cookies
+}
+
+// ParseNetscape reads the tab-separated cookies.txt format:
+// domain, include-subdomains, path, secure, expiry, name, value
+func ParseNetscape(data []byte) ([]*http.Cookie, error) {
+	var cookies []*http.Cookie
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		httpOnly := false
+		if strings.HasPrefix(line, "#HttpOnly_") {
+			line = strings.TrimPrefix(line, "#HttpOnly_")
+			httpOnly = true
+		}
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Split(line, "\t")
+		if len(fields) != 7 {
+			fields = strings.Fields(line)
+		}
+		if len(fields) < 6 {
+			return nil, fmt.Errorf("line %d: expected 7 tab-separated fields, got %d", lineNo, len(fields))
+		}
+		value := ""
+		if len(fields) > 6 {
+			value = fields[6]
+		}
+
+		cookie := &http.Cookie{
+			Domain:   fields[0],
+			Path:     fields[2],
+			Secure:   strings.EqualFold(fields[3], "TRUE"),
+			Name:     fields[5],
+			Value:    value,
+			HttpOnly: httpOnly,
+		}
+		if expiry, err := strconv.ParseInt(fields[4], 10, 64); err == nil && expiry > 0 {
+			cookie.Expires = time.Unix(expiry, 0)
+		}
+		cookies = append(cookies, cookie)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(cookies) == 0 {
+		return nil, ErrNoCookies
+	}
+	return cookies, nil
+}
+
+// jsonCookie covers the fields used by the common export extensions
+// (EditThisCookie, Cookie-Editor) and by Playwright/Puppeteer storage state
+type jsonCookie struct {
+	Name           string   `json:"name"`
+	Value          string   `json:"value"`
+	Domain         string   `json:"domain"`
+	Path           string   `json:"path"`
+	Secure         bool     `json:"secure"`
+	HTTPOnly       bool     `json:"httpOnly"`
+	ExpirationDate *float64 `json:"expirationDate"`
+	Expires        *float64 `json:"expires"`
+}
+
+// ParseJSON reads an array of cookie objects, or an object with a "cookies" array
+func ParseJSON(data []byte) ([]*http.Cookie, error) {
+	var list []jsonCookie
+	if err := json.Unmarshal(data, &list); err != nil {
+		var wrapped struct {
+			Cookies []jsonCookie `json:"cookies"`
+		}
+		if err2 := json.Unmarshal(data, &wrapped); err2 != nil {
+			return nil, fmt.Errorf("invalid cookie JSON: %w", err)
+		}
+		list = wrapped.Cookies
+	}
+
+	var cookies []*http.Cookie
+	for _, jc := range list {
+		if jc.Name == "" {
+			continue
+		}
+		cookie := &http.Cookie{
+			Name:     jc.Name,
+			Value:    jc.Value,
+			Domain:   jc.Domain,
+			Path:     jc.Path,
+			Secure:   jc.Secure,
+			HttpOnly: jc.HTTPOnly,
+		}
+		expiry := jc.ExpirationDate
+		if expiry == nil {
+			expiry = jc.Expires
+		}
+		// Session cookies are exported without an expiry, or with -1
+		if expiry != nil && *expiry > 0 {
+			sec, frac := math.Modf(*expiry)
+			cookie.Expires = time.Unix(int64(sec), int64(frac*1e9))
+		}
+		cookies = append(cookies, cookie)
+	}
+	if len(cookies) == 0 {
+		return nil, ErrNoCookies
+	}
+	return cookies, nil
+}
+
+// Google keeps the unexpired cookies that google.com and its subdomains receive.
+// When a name appears for several domains the one set on google.com itself wins.
+func Google(cookies []*http.Cookie) []*http.Cookie {
+	now := time.Now()
+	index := make(map[string]int)
+	var kept []*http.Cookie
+	for _, cookie := range cookies {
+		domain := strings.TrimPrefix(strings.ToLower(cookie.Domain), ".")
+		if domain != "google.com" && !strings.HasSuffix(domain, ".google.com") {
+			continue
+		}
+		if !cookie.Expires.IsZero() && cookie.Expires.Before(now) {
+			continue
+		}
+
+		if i, exists := index[cookie.Name]; exists {
+			if domain == "google.com" {
+				kept[i] = cookie
+			}
+			continue
+		}
+		index[cookie.Name] = len(kept)
+		kept = append(kept, cookie)
+	}
+	return kept
+}
+
+// Names lists cookie names, e.g. for logging an import without its values
+func Names(cookies []*http.Cookie) []string {
+	names := make([]string, 0, len(cookies))
+	for _, cookie := range cookies {
+		names = append(names, cookie.Name)
+	}
+	return names
+}
+
+func isNetscape(data []byte) bool {
+	if bytes.HasPrefix(data, []byte("# Netscape")) || bytes.HasPrefix(data, []byte("# HTTP Cookie File")) {
+		return true
+	}
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	return bytes.Count(line, []byte("\t")) >= 5
+}
@@ -0,0 +1,200 @@
+package ephemeral
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/providers/gemini"
+
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// HeaderName lets a single request opt in ("true") or out ("false") of ephemeral mode
+const HeaderName = "X-Gemini-Ephemeral"
+
+const deleteTimeout = 30 * time.Second
+
+// Deleter removes a conversation from the upstream account history
+type Deleter interface {
+	DeleteConversation(ctx context.Context, conversationID string) error
+}
+
+// Manager deletes upstream conversations once their answer has been delivered,
+// retrying failed deletions from a background sweeper.
+type Manager struct {
+	deleter     Deleter
+	log         *zap.Logger
+	enabled     bool
+	apiKeys     map[string]bool
+	interval    time.Duration
+	maxAttempts int
+
+	mu       sync.Mutex      // guards the policy fields, pending and inFlight
+	pending  map[string]int  // conversation ID -> failed attempts
+	inFlight map[string]bool // conversations being deleted right now
+	stop     chan struct{}
+}
+
+// NewManager creates the ephemeral manager and ties its sweeper to the app lifecycle
+func NewManager(lc fx.Lifecycle, cfg *config.Config, client *gemini.Client, log *zap.Logger) *Manager {
+	m := newManager(cfg.Ephemeral, client, log)
+
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			go m.startSweeper()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			close(m.stop)
+			return nil
+		},
+	})
+
+	return m
+}
+
+func newManager(cfg config.EphemeralConfig, deleter Deleter, log *zap.Logger) *Manager {
+	interval := time.Duration(cfg.SweepInterval) * time.Second
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	m := &Manager{
+		deleter:  deleter,
+		log:      log,
+		interval: interval,
+		pending:  make(map[string]int),
+		inFlight: make(map[string]bool),
+		stop:     make(chan struct{}),
+	}
+	m.SetPolicy(cfg)
+	return m
+}
+
+// SetPolicy updates which requests are ephemeral and how often deletion is attempted.
+// The sweep interval is only read at startup.
+func (m *Manager) SetPolicy(cfg config.EphemeralConfig) {
+	apiKeys := make(map[string]bool, len(cfg.APIKeys))
+	for _, key := range cfg.APIKeys {
+		apiKeys[key] = true
+	}
+
+	maxAttempts := cfg.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.enabled = cfg.Enabled
+	m.apiKeys = apiKeys
+	m.maxAttempts = maxAttempts
+}
+
+// Applies resolves the policy for a request: the header wins, then the API key, then the global setting
+func (m *Manager) Applies(apiKey string, header string) bool {
+	if header != "" {
+		if v, err := strconv.ParseBool(header); err == nil {
+			return v
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if apiKey != "" && m.apiKeys[apiKey] {
+		return true
+	}
+	return m.enabled
+}
+
+// Release deletes the conversation in the background; failures are queued for the sweeper
+func (m *Manager) Release(conversationID string) {
+	if conversationID == "" {
+		return
+	}
+	go m.tryDelete(conversationID)
+}
+
+// Pending returns the number of conversations waiting for a deletion retry
+func (m *Manager) Pending() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.pending)
+}
+
+// tryDelete deletes the conversation unless a deletion of it is already running,
+// so Release and the sweeper never delete the same conversation twice
+func (m *Manager) tryDelete(conversationID string) {
+	m.mu.Lock()
+	if m.inFlight[conversationID] {
+		m.mu.Unlock()
+		return
+	}
+	m.inFlight[conversationID] = true
+	m.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), deleteTimeout)
+	defer cancel()
+
+	err := m.deleter.DeleteConversation(ctx, conversationID)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.inFlight, conversationID)
+
+	if err == nil {
+		delete(m.pending, conversationID)
+		m.log.Debug("Ephemeral conversation deleted", zap.String("conversation_id", conversationID))
+		return
+	}
+
+	attempts := m.pending[conversationID] + 1
+	if attempts >= m.maxAttempts {
+		delete(m.pending, conversationID)
+		m.log.Error("Giving up deleting ephemeral conversation",
+			zap.String("conversation_id", conversationID),
+			zap.Int("attempts", attempts),
+			zap.Error(err),
+		)
+		return
+	}
+
+	m.pending[conversationID] = attempts
+	m.log.Warn("Ephemeral conversation deletion failed, will retry",
+		zap.String("conversation_id", conversationID),
+		zap.Int("attempt", attempts),
+		zap.Error(err),
+	)
+}
+
+// startSweeper periodically retries deletions that previously failed
+func (m *Manager) startSweeper() {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.sweep()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func (m *Manager) sweep() {
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.pending))
+	for id := range m.pending {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+
+	for _, id := range ids {
+		m.tryDelete(id)
+	}
+}
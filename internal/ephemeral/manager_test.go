@@ -0,0 +1,156 @@
+package ephemeral
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"gemini-web-to-api/internal/config"
+
+	"go.uber.org/zap/zaptest"
+)
+
+// fakeDeleter records deletions, failing the first failures calls and
+// blocking each call until block is closed when it is set
+type fakeDeleter struct {
+	mu       sync.Mutex
+	calls    map[string]int
+	failures int
+	started  chan string
+	block    chan struct{}
+}
+
+func newFakeDeleter() *fakeDeleter {
+	return &fakeDeleter{calls: make(map[string]int), started: make(chan string, 10)}
+}
+
+func (d *fakeDeleter) DeleteConversation(ctx context.Context, conversationID string) error {
+	d.mu.Lock()
+	d.calls[conversationID]++
+	fail := d.failures > 0
+	if fail {
+		d.failures--
+	}
+	block := d.block
+	d.mu.Unlock()
+
+	d.started <- conversationID
+	if block != nil {
+		<-block
+	}
+	if fail {
+		return errors.New("upstream unavailable")
+	}
+	return nil
+}
+
+func (d *fakeDeleter) Calls(conversationID string) int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.calls[conversationID]
+}
+
+func TestApplies(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+		apiKey  string
+		header  string
+		want    bool
+	}{
+		{"disabled", false, "", "", false},
+		{"enabled globally", true, "", "", true},
+		{"ephemeral key", false, "secret", "", true},
+		{"other key", false, "other", "", false},
+		{"header opts in", false, "other", "true", true},
+		{"header opts out of global", true, "", "false", false},
+		{"header opts out of key", false, "secret", "false", false},
+		{"invalid header ignored", true, "", "maybe", true},
+	}
+	for _, tt := range tests {
+		m := newManager(config.EphemeralConfig{Enabled: tt.enabled, APIKeys: []string{"secret"}}, newFakeDeleter(), zaptest.NewLogger(t))
+		if got := m.Applies(tt.apiKey, tt.header); got != tt.want {
+			t.Errorf("%s: Applies(%q, %q) = %v, want %v", tt.name, tt.apiKey, tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestSweepRetriesFailedDeletion(t *testing.T) {
+	deleter := newFakeDeleter()
+	deleter.failures = 1
+	m := newManager(config.EphemeralConfig{MaxAttempts: 3}, deleter, zaptest.NewLogger(t))
+
+	m.tryDelete("c_1")
+	if got := m.Pending(); got != 1 {
+		t.Fatalf("pending after failed delete = %d, want 1", got)
+	}
+
+	m.sweep()
+	if got := m.Pending(); got != 0 {
+		t.Errorf("pending after sweep = %d, want 0", got)
+	}
+	if got := deleter.Calls("c_1"); got != 2 {
+		t.Errorf("delete calls = %d, want 2", got)
+	}
+}
+
+func TestSweepGivesUpAfterMaxAttempts(t *testing.T) {
+	deleter := newFakeDeleter()
+	deleter.failures = 5
+	m := newManager(config.EphemeralConfig{MaxAttempts: 2}, deleter, zaptest.NewLogger(t))
+
+	m.tryDelete("c_1")
+	m.sweep()
+	if got := m.Pending(); got != 0 {
+		t.Errorf("pending = %d, want the conversation dropped", got)
+	}
+	m.sweep()
+	if got := deleter.Calls("c_1"); got != 2 {
+		t.Errorf("delete calls = %d, want 2", got)
+	}
+}
+
+func TestSweepSkipsDeletionInFlight(t *testing.T) {
+	deleter := newFakeDeleter()
+	deleter.failures = 1
+	m := newManager(config.EphemeralConfig{MaxAttempts: 3}, deleter, zaptest.NewLogger(t))
+
+	m.tryDelete("c_1")
+	<-deleter.started
+
+	// Release the conversation again while it is still pending, and sweep while that deletion runs
+	deleter.mu.Lock()
+	deleter.block = make(chan struct{})
+	deleter.mu.Unlock()
+	m.Release("c_1")
+	select {
+	case <-deleter.started:
+	case <-time.After(time.Second):
+		t.Fatal("Release did not start a deletion")
+	}
+	swept := make(chan struct{})
+	go func() {
+		m.sweep()
+		close(swept)
+	}()
+	select {
+	case <-swept:
+	case <-deleter.started:
+		t.Error("the sweep deleted a conversation whose deletion was in flight")
+	}
+	close(deleter.block)
+	<-swept
+
+	deadline := time.Now().Add(time.Second)
+	for m.Pending() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the conversation was not deleted")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if got := deleter.Calls("c_1"); got != 2 {
+		t.Errorf("delete calls = %d, want 2: the sweep must skip a deletion in flight", got)
+	}
+}
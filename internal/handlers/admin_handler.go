@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"gemini-web-to-api/internal/cookieimport"
+	"gemini-web-to-api/internal/models"
+	"gemini-web-to-api/internal/providers/gemini"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+const adminTimeout = 1 * time.Minute
+
+// AdminHandler manages the session of the running Gemini client
+type AdminHandler struct {
+	client *gemini.Client
+	log    *zap.Logger
+}
+
+func NewAdminHandler(client *gemini.Client) *AdminHandler {
+	return &AdminHandler{
+		client: client,
+		log:    zap.NewNop(),
+	}
+}
+
+// SetLogger sets the logger for this handler
+func (h *AdminHandler) SetLogger(log *zap.Logger) {
+	h.log = log
+}
+
+// HandleStatus reports cookie age, the last rotation and the session token state
+func (h *AdminHandler) HandleStatus(c *fiber.Ctx) error {
+	return c.JSON(models.AdminStatusResponse{
+		Accounts: []models.AdminAccountStatus{h.accountStatus()},
+	})
+}
+
+// HandleUpdateCookies applies new session cookies to the running client
+func (h *AdminHandler) HandleUpdateCookies(c *fiber.Ctx) error {
+	var req models.AdminCookiesRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("invalid request body: %w", err), "invalid_request_error"))
+	}
+	if req.Secure1PSID == "" && req.Secure1PSIDTS == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("provide __Secure-1PSID and/or __Secure-1PSIDTS"), "invalid_request_error"))
+	}
+	if req.Secure1PSID == "" {
+		req.Secure1PSID = h.client.GetCookies().Secure1PSID
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), adminTimeout)
+	defer cancel()
+
+	if err := h.client.UpdateCookies(ctx, req.Secure1PSID, req.Secure1PSIDTS, req.Secure1PSIDCC); err != nil {
+		h.log.Error("Cookie update failed", zap.Error(err))
+		return c.Status(fiber.StatusBadGateway).JSON(errorToResponse(err, "api_error"))
+	}
+
+	h.log.Info("Cookies updated via admin API")
+	return c.JSON(h.accountStatus())
+}
+
+// HandleImportCookies applies a cookie export: a Cookie header, Netscape cookies.txt or export JSON,
+// sent as the request body or as a multipart "file" upload
+func (h *AdminHandler) HandleImportCookies(c *fiber.Ctx) error {
+	data := c.Body()
+	if fh, err := c.FormFile("file"); err == nil {
+		f, err := fh.Open()
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("failed to read upload: %w", err), "invalid_request_error"))
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(f); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("failed to read upload: %w", err), "invalid_request_error"))
+		}
+	}
+
+	cookies, format, err := cookieimport.Parse(data)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(err, "invalid_request_error"))
+	}
+	cookies = cookieimport.Google(cookies)
+	if !hasCookie(cookies, "__Secure-1PSID") {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("no google.com __Secure-1PSID cookie in the import"), "invalid_request_error"))
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), adminTimeout)
+	defer cancel()
+
+	if err := h.client.ImportCookies(ctx, cookies); err != nil {
+		h.log.Error("Cookie import failed", zap.Error(err))
+		return c.Status(fiber.StatusBadGateway).JSON(errorToResponse(err, "api_error"))
+	}
+
+	names := cookieimport.Names(cookies)
+	h.log.Info("Cookies imported via admin API", zap.String("format", string(format)), zap.Strings("cookies", names))
+	return c.JSON(models.AdminCookieImportResponse{
+		Format:  string(format),
+		Cookies: names,
+		Status:  h.accountStatus(),
+	})
+}
+
+// HandleRotate forces a __Secure-1PSIDTS rotation
+func (h *AdminHandler) HandleRotate(c *fiber.Ctx) error {
+	if err := h.client.RotateCookies(); err != nil {
+		return c.Status(fiber.StatusBadGateway).JSON(errorToResponse(err, "api_error"))
+	}
+	return c.JSON(h.accountStatus())
+}
+
+// HandleReinit fetches a new session token, rotating cookies if needed
+func (h *AdminHandler) HandleReinit(c *fiber.Ctx) error {
+	ctx, cancel := context.WithTimeout(c.Context(), adminTimeout)
+	defer cancel()
+
+	if err := h.client.Reinit(ctx); err != nil {
+		h.log.Error("Re-init failed", zap.Error(err))
+		return c.Status(fiber.StatusBadGateway).JSON(errorToResponse(err, "api_error"))
+	}
+	return c.JSON(h.accountStatus())
+}
+
+// HandleClearCookieCache deletes the cached cookies of the current account
+func (h *AdminHandler) HandleClearCookieCache(c *fiber.Ctx) error {
+	if err := h.client.ClearCookieCache(); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(errorToResponse(err, "api_error"))
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// accountStatus reports the session of the client's account
+func (h *AdminHandler) accountStatus() models.AdminAccountStatus {
+	s := h.client.Status()
+	status := models.AdminAccountStatus{
+		Account:          s.Account,
+		Healthy:          s.Healthy,
+		UnhealthyReason:  s.UnhealthyReason,
+		CookiesUpdatedAt: s.CookiesUpdatedAt,
+		CookieAgeSeconds: s.CookieAgeSeconds,
+		HasPSIDTS:        s.HasPSIDTS,
+		HasPSIDCC:        s.HasPSIDCC,
+		SessionToken:     s.SessionToken,
+		SessionTokenAt:   s.SessionTokenAt,
+		ActiveRequests:   s.ActiveRequests,
+		QueuedRequests:   s.QueuedRequests,
+		QueuedByPriority: s.QueuedByPriority,
+		Parser: models.AdminParserStatus{
+			Strategies: s.Parser.Strategies,
+			Fallbacks:  s.Parser.Fallbacks,
+			Failures:   s.Parser.Failures,
+		},
+	}
+	if r := s.LastRotation; r != nil {
+		status.LastRotation = &models.AdminRotationResult{At: r.At, OK: r.OK, Error: r.Error}
+	}
+	if d := s.Parser.LastDrift; d != nil {
+		status.Parser.LastDrift = &models.AdminDriftReport{At: d.At, Strategy: d.Strategy, Layouts: d.Layouts, TextPaths: d.TextPaths}
+	}
+	return status
+}
+
+func hasCookie(cookies []*http.Cookie, name string) bool {
+	for _, cookie := range cookies {
+		if cookie.Name == name && cookie.Value != "" {
+			return true
+		}
+	}
+	return false
+}
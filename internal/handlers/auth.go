@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/models"
+	"gemini-web-to-api/internal/routing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var (
+	errInvalidAPIKey = errors.New("invalid or missing API key")
+	errAdminDisabled = errors.New("admin API is disabled: set ADMIN_API_KEYS or admin.api_keys")
+)
+
+// NewAuthMiddleware rejects requests without one of the API keys configured for the flavor.
+// Keys are read from the live config, so reloaded keys apply to the next request;
+// with no keys configured the routes stay open.
+func NewAuthMiddleware(store *config.Store, flavor string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		keys := apiKeysFor(store.Current(), flavor)
+		if len(keys) == 0 || validAPIKey(extractAPIKey(c), keys) {
+			return c.Next()
+		}
+
+		c.Status(fiber.StatusUnauthorized)
+		switch flavor {
+		case routing.FlavorClaude:
+			return c.JSON(fiber.Map{
+				"type":  "error",
+				"error": fiber.Map{"type": "authentication_error", "message": errInvalidAPIKey.Error()},
+			})
+		case routing.FlavorGemini:
+			return c.JSON(fiber.Map{
+				"error": fiber.Map{
+					"code":    fiber.StatusUnauthorized,
+					"message": errInvalidAPIKey.Error(),
+					"status":  "UNAUTHENTICATED",
+				},
+			})
+		default:
+			return c.JSON(models.ErrorResponse{
+				Error: models.Error{
+					Message: errInvalidAPIKey.Error(),
+					Type:    "invalid_request_error",
+					Code:    "invalid_api_key",
+				},
+			})
+		}
+	}
+}
+
+// NewAdminAuthMiddleware guards the admin routes, which stay closed until admin keys are configured
+func NewAdminAuthMiddleware(store *config.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		keys := store.Current().Admin.APIKeys
+		if len(keys) == 0 {
+			return c.Status(fiber.StatusForbidden).JSON(errorToResponse(errAdminDisabled, "permission_error"))
+		}
+		if !validAPIKey(extractAPIKey(c), keys) {
+			return c.Status(fiber.StatusUnauthorized).JSON(errorToResponse(errInvalidAPIKey, "authentication_error"))
+		}
+		return c.Next()
+	}
+}
+
+func apiKeysFor(cfg *config.Config, flavor string) []string {
+	switch flavor {
+	case routing.FlavorOpenAI:
+		return cfg.OpenAI.APIKeys
+	case routing.FlavorClaude:
+		return cfg.Claude.APIKeys
+	case routing.FlavorGemini:
+		return cfg.Gemini.APIKeys
+	}
+	return nil
+}
+
+// validAPIKey compares in constant time so keys cannot be guessed byte by byte
+func validAPIKey(key string, keys []string) bool {
+	if key == "" {
+		return false
+	}
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+			return true
+		}
+	}
+	return false
+}
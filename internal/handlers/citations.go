@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"gemini-web-to-api/internal/models"
+	"gemini-web-to-api/internal/providers"
+)
+
+// geminiGrounding maps the sources and citations of a web-search answer to Gemini
+// groundingMetadata, with segments in the text parts that hold them; firstPart is the
+// position of the first segment among the candidate's parts
+func geminiGrounding(response *providers.Response, segments []geminiSegment, firstPart int) *models.GroundingMetadata {
+	if len(response.References) == 0 {
+		return nil
+	}
+	metadata := &models.GroundingMetadata{}
+	for _, ref := range response.References {
+		metadata.GroundingChunks = append(metadata.GroundingChunks, models.GroundingChunk{
+			Web: &models.WebChunk{URI: ref.URL, Title: ref.Title},
+		})
+	}
+	for _, citation := range response.Citations {
+		for i, segment := range segments {
+			if segment.part.Text == "" || citation.Start < segment.start || citation.End > segment.end {
+				continue
+			}
+			metadata.GroundingSupports = append(metadata.GroundingSupports, models.GroundingSupport{
+				Segment: models.Segment{
+					PartIndex:  firstPart + i,
+					StartIndex: citation.Start - segment.start,
+					EndIndex:   citation.End - segment.start,
+					Text:       response.Text[citation.Start:citation.End],
+				},
+				GroundingChunkIndices: citation.References,
+			})
+			break
+		}
+	}
+	return metadata
+}
+
+// openAIAnnotations maps citations to url_citation annotations, one per cited source, with
+// offsets converted to characters
+func openAIAnnotations(response *providers.Response) []models.Annotation {
+	var annotations []models.Annotation
+	for _, citation := range response.Citations {
+		start := utf8.RuneCountInString(response.Text[:citation.Start])
+		end := start + utf8.RuneCountInString(response.Text[citation.Start:citation.End])
+		for _, i := range citation.References {
+			ref := response.References[i]
+			annotations = append(annotations, models.Annotation{
+				Type: "url_citation",
+				URLCitation: models.URLCitation{
+					StartIndex: start,
+					EndIndex:   end,
+					URL:        ref.URL,
+					Title:      ref.Title,
+				},
+			})
+		}
+	}
+	return annotations
+}
+
+// claudeTextBlocks splits the answer into text blocks at its citations, the way Claude returns
+// web search answers: cited spans become blocks of their own carrying their citations
+func claudeTextBlocks(response *providers.Response) []models.ConfigContent {
+	var blocks []models.ConfigContent
+	text := func(from, to int, citations []models.ClaudeCitation) {
+		if from < to {
+			blocks = append(blocks, models.ConfigContent{Type: "text", Text: response.Text[from:to], Citations: citations})
+		}
+	}
+
+	pos := 0
+	for _, citation := range response.Citations {
+		if citation.Start < pos {
+			continue // overlaps the previous citation
+		}
+		text(pos, citation.Start, nil)
+
+		cited := response.Text[citation.Start:citation.End]
+		var citations []models.ClaudeCitation
+		for _, i := range citation.References {
+			ref := response.References[i]
+			citations = append(citations, models.ClaudeCitation{
+				Type:      "web_search_result_location",
+				URL:       ref.URL,
+				Title:     ref.Title,
+				CitedText: cited,
+			})
+		}
+		text(citation.Start, citation.End, citations)
+		pos = citation.End
+	}
+	text(pos, len(response.Text), nil)
+
+	if len(blocks) == 0 {
+		blocks = append(blocks, models.ConfigContent{Type: "text", Text: response.Text})
+	}
+	if images := sideImages(response); images != "" {
+		blocks = append(blocks, models.ConfigContent{Type: "text", Text: strings.TrimSpace(images)})
+	}
+	return blocks
+}
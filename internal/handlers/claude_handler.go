@@ -6,9 +6,16 @@ import (
 	"fmt"
 	"time"
 
+	"gemini-web-to-api/internal/cache"
+	"gemini-web-to-api/internal/coalesce"
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/contextwindow"
+	"gemini-web-to-api/internal/ephemeral"
 	"gemini-web-to-api/internal/models"
 	"gemini-web-to-api/internal/providers"
 	"gemini-web-to-api/internal/providers/gemini"
+	"gemini-web-to-api/internal/queue"
+	"gemini-web-to-api/internal/routing"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
@@ -16,14 +23,26 @@ import (
 )
 
 type ClaudeHandler struct {
-	client *gemini.Client
-	log    *zap.Logger
+	client    *gemini.Client
+	ephemeral *ephemeral.Manager
+	cache     *cache.Cache
+	flights   *coalesce.Group
+	window    *contextwindow.Manager
+	router    *routing.Router
+	store     *config.Store
+	log       *zap.Logger
 }
 
-func NewClaudeHandler(client *gemini.Client) *ClaudeHandler {
+func NewClaudeHandler(client *gemini.Client, ephemeralManager *ephemeral.Manager, responseCache *cache.Cache, flights *coalesce.Group, window *contextwindow.Manager, router *routing.Router, store *config.Store) *ClaudeHandler {
 	return &ClaudeHandler{
-		client: client,
-		log:    zap.NewNop(),
+		client:    client,
+		ephemeral: ephemeralManager,
+		cache:     responseCache,
+		flights:   flights,
+		window:    window,
+		router:    router,
+		store:     store,
+		log:       zap.NewNop(),
 	}
 }
 
@@ -32,47 +51,43 @@ func (h *ClaudeHandler) SetLogger(log *zap.Logger) {
 	h.log = log
 }
 
-// GetModelData moved to models_handlers.go
-
-// HandleModels returns a list of Claude models
+// HandleModels returns the available models in Claude format
 func (h *ClaudeHandler) HandleModels(c *fiber.Ctx) error {
-	return c.JSON(fiber.Map{
-		"data": []fiber.Map{
-			{
-				"id":           "claude-3-5-sonnet-20240620",
-				"type":         "model",
-				"created_at":   1718841600,
-				"display_name": "Claude 3.5 Sonnet",
-			},
-			{
-				"id":           "claude-3-opus-20240229",
-				"type":         "model",
-				"created_at":   1709164800,
-				"display_name": "Claude 3 Opus",
-			},
-			{
-				"id":           "claude-3-7-sonnet-20250219",
-				"type":         "model",
-				"created_at":   1739923200,
-				"display_name": "Claude 3.7 Sonnet",
-			},
-		},
-	})
+	var data []models.ModelData
+	for _, m := range h.client.ListModels() {
+		data = append(data, toClaudeModel(m))
+	}
+	return c.JSON(models.ModelListResponse{Data: data})
 }
 
 // HandleModelByID returns a specific Claude model by ID
 func (h *ClaudeHandler) HandleModelByID(c *fiber.Ctx) error {
 	modelID := c.Params("model_id")
-	return c.JSON(fiber.Map{
-		"id":           modelID,
-		"type":         "model",
-		"created_at":   time.Now().Unix(),
-		"display_name": modelID,
+	if m, ok := h.client.GetModel(modelID); ok {
+		return c.JSON(toClaudeModel(m))
+	}
+
+	// Unknown IDs are still forwarded as-is, so describe them rather than failing
+	return c.JSON(models.ModelData{
+		ID:          modelID,
+		Type:        "model",
+		CreatedAt:   time.Now().Unix(),
+		DisplayName: modelID,
 	})
 }
 
-// Model handlers moved to models_handlers.go
-
+func toClaudeModel(m providers.ModelInfo) models.ModelData {
+	displayName := m.DisplayName
+	if displayName == "" {
+		displayName = m.ID
+	}
+	return models.ModelData{
+		ID:          m.ID,
+		Type:        "model",
+		CreatedAt:   m.Created,
+		DisplayName: displayName,
+	}
+}
 
 // HandleMessages handles the main chat endpoint
 func (h *ClaudeHandler) HandleMessages(c *fiber.Ctx) error {
@@ -92,17 +107,44 @@ func (h *ClaudeHandler) HandleMessages(c *fiber.Ctx) error {
 		})
 	}
 
-	// Build prompt
-	prompt := buildPromptFromMessages(req.Messages, req.System)
+	cfg := h.store.Current()
+	if req.Model == "" {
+		req.Model = cfg.Claude.Model
+	}
+	route := resolveRoute(h.router, h.client, routing.FlavorClaude, req.Model)
+	priority := requestPriority(c, cfg, route)
+
+	// Build prompt, shortened to fit the model's context window
+	systemPrompt := req.System
+	if systemPrompt == "" && !hasSystemMessage(req.Messages) {
+		systemPrompt = route.SystemPrompt
+	}
+	tmpl := promptTemplate(cfg, route)
+	fit, err := fitContext(c, h.window, cfg, priority, route.Model, req.Messages, func(messages []models.Message) string {
+		return tmpl.Build(messages, systemPrompt)
+	})
+	if err != nil {
+		return sendClaudeError(c, err)
+	}
+	prompt := fit.Prompt
 	if prompt == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"type":  "error",
 			"error": fiber.Map{"type": "invalid_request_error", "message": "no valid content in messages"},
 		})
 	}
+	if err := validatePromptLength(prompt, cfg); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"type":  "error",
+			"error": fiber.Map{"type": "invalid_request_error", "message": err.Error()},
+		})
+	}
 
-	opts := []providers.GenerateOption{}
+	opts := append(routeOptions(route), providers.WithTemperature(float64(req.Temperature)))
 	msgID := fmt.Sprintf("msg_%s", uuid.New().String())
+	isEphemeral := h.ephemeral.Applies(extractAPIKey(c), c.Get(ephemeral.HeaderName))
+	lookup := lookupCache(c, h.cache, prompt, opts, isEphemeral)
+	withThinking := req.Thinking.Enabled()
 
 	// Handle Streaming
 	if req.Stream {
@@ -110,24 +152,25 @@ func (h *ClaudeHandler) HandleMessages(c *fiber.Ctx) error {
 		c.Set("Cache-Control", "no-cache")
 		c.Set("Connection", "keep-alive")
 
-		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
-			// Add timeout
-			ctx, cancel := context.WithTimeout(c.Context(), 5*time.Minute)
+		reqCtx := c.Context()
+		reqCtx.SetBodyStreamWriter(func(w *bufio.Writer) {
+			// Bound by the timeout and the client connection
+			ctx, cancel := generationContext(reqCtx, cfg, priority)
 			defer cancel()
 
-			response, err := h.client.GenerateContent(ctx, prompt, opts...)
+			response, owner, _, err := generate(ctx, h.client, h.flights, lookup, prompt, tmpl, opts, isEphemeral)
 			if err != nil {
-				h.log.Error("GenerateContent streaming failed", zap.Error(err), zap.String("model", req.Model))
-				_ = sendSSEChunk(w, h.log, "error", fiber.Map{
-					"type": "error",
-					"error": fiber.Map{
-						"type":    "api_error",
-						"message": err.Error(),
-					},
-				})
+				h.log.Error("GenerateContent streaming failed", zap.Error(err), zap.String("model", route.Model))
+				_, errResponse := claudeError(providers.AsError(err))
+				_ = sendSSEChunk(w, h.log, "error", errResponse)
 				return
 			}
 
+			// Deleted however the stream ends, also when the client goes away
+			if isEphemeral && owner {
+				defer h.ephemeral.Release(conversationIDOf(response))
+			}
+
 			// Simulate Streaming - Claude format
 			_ = sendSSEChunk(w, h.log, "message_start", fiber.Map{
 				"type": "message_start",
@@ -135,69 +178,115 @@ func (h *ClaudeHandler) HandleMessages(c *fiber.Ctx) error {
 					ID:    msgID,
 					Type:  "message",
 					Role:  "assistant",
-					Model: req.Model,
-					Usage: models.Usage{InputTokens: 10, OutputTokens: 1},
+					Model: route.Model,
+					Usage: models.Usage{InputTokens: fit.Tokens, OutputTokens: 1},
 				},
 			})
 
-			_ = sendSSEChunk(w, h.log, "content_block_start", fiber.Map{
-				"type":           "content_block_start",
-				"index":          0,
-				"content_block":  models.ConfigContent{Type: "text", Text: ""},
-			})
-
-			// Send chunks
-			chunks := splitResponseIntoChunks(response.Text, 20)
-			for _, chunk := range chunks {
-				_ = sendSSEChunk(w, h.log, "content_block_delta", fiber.Map{
-					"type":  "content_block_delta",
-					"index": 0,
-					"delta": models.Delta{Type: "text_delta", Text: chunk},
+			index := 0
+			if withThinking && response.Thinking != "" {
+				deltas := wordDeltas(response.Thinking, func(chunk string) models.Delta {
+					return models.Delta{Type: "thinking_delta", Thinking: chunk}
 				})
+				if !h.streamBlock(ctx, w, index, models.ConfigContent{Type: "thinking"}, deltas) {
+					return
+				}
+				index++
+			}
 
-				// Check context cancellation
-				if !sleepWithCancel(c.Context(), 20*time.Millisecond) {
-					h.log.Info("Stream cancelled by client")
+			// Cited spans are blocks of their own, their citations sent ahead of the text
+			for _, block := range claudeTextBlocks(response) {
+				var deltas []models.Delta
+				for i := range block.Citations {
+					deltas = append(deltas, models.Delta{Type: "citations_delta", Citation: &block.Citations[i]})
+				}
+				deltas = append(deltas, wordDeltas(block.Text, func(chunk string) models.Delta {
+					return models.Delta{Type: "text_delta", Text: chunk}
+				})...)
+				if !h.streamBlock(ctx, w, index, models.ConfigContent{Type: "text", Text: ""}, deltas) {
 					return
 				}
+				index++
 			}
 
-			_ = sendSSEChunk(w, h.log, "content_block_stop", fiber.Map{"type": "content_block_stop", "index": 0})
 			_ = sendSSEChunk(w, h.log, "message_stop", fiber.Map{"type": "message_stop", "stop_reason": "end_turn"})
 		})
 		return nil
 	}
 
 	// Non-streaming response
-	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Minute)
+	ctx, cancel := generationContext(c.Context(), cfg, priority)
 	defer cancel()
+	ctx, queueStats := queue.WithStats(ctx)
 
-	response, err := h.client.GenerateContent(ctx, prompt, opts...)
+	response, owner, shared, err := generate(ctx, h.client, h.flights, lookup, prompt, tmpl, opts, isEphemeral)
+	setQueueHeaders(c, queueStats, shared)
 	if err != nil {
-		h.log.Error("GenerateContent failed", zap.Error(err), zap.String("model", req.Model))
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"type":  "error",
-			"error": fiber.Map{"type": "api_error", "message": err.Error()},
-		})
+		h.log.Error("GenerateContent failed", zap.Error(err), zap.String("model", route.Model))
+		return sendClaudeError(c, err)
+	}
+
+	if isEphemeral && owner {
+		h.ephemeral.Release(conversationIDOf(response))
 	}
 
 	// Construct Response
-	content := []models.ConfigContent{{Type: "text", Text: response.Text}}
+	var content []models.ConfigContent
+	if withThinking && response.Thinking != "" {
+		content = append(content, models.ConfigContent{Type: "thinking", Thinking: response.Thinking})
+	}
+	content = append(content, claudeTextBlocks(response)...)
 
 	return c.JSON(models.MessageResponse{
 		ID:         msgID,
 		Type:       "message",
 		Role:       "assistant",
-		Model:      req.Model,
+		Model:      route.Model,
 		Content:    content,
 		StopReason: "end_turn",
 		Usage: models.Usage{
-			InputTokens:  len(prompt) / 4,
-			OutputTokens: len(response.Text) / 4,
+			InputTokens:  fit.Tokens,
+			OutputTokens: h.window.Count(response.Text),
 		},
 	})
 }
 
+// streamBlock sends a content block as start, delta and stop events.
+// It reports false when the client went away.
+func (h *ClaudeHandler) streamBlock(ctx context.Context, w *bufio.Writer, index int, block models.ConfigContent, deltas []models.Delta) bool {
+	_ = sendSSEChunk(w, h.log, "content_block_start", fiber.Map{
+		"type":          "content_block_start",
+		"index":         index,
+		"content_block": block,
+	})
+
+	for _, delta := range deltas {
+		_ = sendSSEChunk(w, h.log, "content_block_delta", fiber.Map{
+			"type":  "content_block_delta",
+			"index": index,
+			"delta": delta,
+		})
+
+		// Check context cancellation
+		if !sleepWithCancel(ctx, 20*time.Millisecond) {
+			h.log.Info("Stream cancelled by client")
+			return false
+		}
+	}
+
+	_ = sendSSEChunk(w, h.log, "content_block_stop", fiber.Map{"type": "content_block_stop", "index": index})
+	return true
+}
+
+// wordDeltas splits text into word-sized deltas to simulate streaming
+func wordDeltas(text string, delta func(string) models.Delta) []models.Delta {
+	var deltas []models.Delta
+	for _, chunk := range splitResponseIntoChunks(text, 20) {
+		deltas = append(deltas, delta(chunk))
+	}
+	return deltas
+}
+
 // HandleCountTokens handles token counting
 func (h *ClaudeHandler) HandleCountTokens(c *fiber.Ctx) error {
 	var req models.MessageRequest
@@ -208,13 +297,14 @@ func (h *ClaudeHandler) HandleCountTokens(c *fiber.Ctx) error {
 		})
 	}
 
-	// Simple estimation
-	totalChars := len(req.System)
-	for _, m := range req.Messages {
-		totalChars += len(m.Content)
+	cfg := h.store.Current()
+	if req.Model == "" {
+		req.Model = cfg.Claude.Model
 	}
+	route := resolveRoute(h.router, h.client, routing.FlavorClaude, req.Model)
+	prompt := promptTemplate(cfg, route).Build(req.Messages, req.System)
 
 	return c.JSON(fiber.Map{
-		"input_tokens": totalChars / 4,
+		"input_tokens": h.window.Count(prompt),
 	})
 }
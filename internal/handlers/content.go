@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+
+	"gemini-web-to-api/internal/models"
+	"gemini-web-to-api/internal/providers"
+)
+
+// geminiSegment is a Gemini part of the answer and the range of the response text it covers
+type geminiSegment struct {
+	part       models.Part
+	start, end int
+}
+
+// geminiSegments maps the typed parts of a response to Gemini parts. Code followed by its
+// output becomes executableCode and codeExecutionResult, images become fileData; prose,
+// tables and code that was not run stay in text parts, merged as they read in the markdown.
+func geminiSegments(response *providers.Response) []geminiSegment {
+	if len(response.Parts) == 0 {
+		return []geminiSegment{{part: models.Part{Text: response.Text}, end: len(response.Text)}}
+	}
+
+	var segments []geminiSegment
+	textStart, textEnd := -1, -1
+	flush := func() {
+		if textStart >= 0 {
+			segments = append(segments, geminiSegment{part: models.Part{Text: response.Text[textStart:textEnd]}, start: textStart, end: textEnd})
+			textStart = -1
+		}
+	}
+	add := func(p providers.Part, part models.Part) {
+		flush()
+		segments = append(segments, geminiSegment{part: part, start: p.Start, end: p.Start})
+	}
+
+	for i, p := range response.Parts {
+		ran := i+1 < len(response.Parts) && response.Parts[i+1].Type == providers.PartCodeResult
+		switch {
+		case p.Type == providers.PartCode && ran:
+			add(p, models.Part{ExecutableCode: &models.ExecutableCode{Language: geminiLanguage(p.Language), Code: p.Text}})
+		case p.Type == providers.PartCodeResult:
+			add(p, models.Part{CodeExecutionResult: &models.CodeExecutionResult{Outcome: geminiOutcome(p.Outcome), Output: p.Text}})
+		case p.Type == providers.PartImage && p.Image != nil:
+			add(p, models.Part{FileData: &models.FileData{MimeType: imageMimeType(p.Image.URL), FileURI: p.Image.URL}})
+		default:
+			if textStart < 0 {
+				textStart = p.Start
+			}
+			textEnd = p.End
+		}
+	}
+	flush()
+	return segments
+}
+
+// geminiLanguage maps a fence tag to the languages the Gemini API names
+func geminiLanguage(tag string) string {
+	switch strings.ToLower(tag) {
+	case "python", "py", "python3":
+		return "PYTHON"
+	}
+	return "LANGUAGE_UNSPECIFIED"
+}
+
+func geminiOutcome(outcome string) string {
+	if outcome == "failed" {
+		return "OUTCOME_FAILED"
+	}
+	return "OUTCOME_OK"
+}
+
+// imageMimeType guesses the type of an image from its URL, empty when the URL does not tell
+func imageMimeType(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return mime.TypeByExtension(path.Ext(u.Path))
+}
+
+// sideImages renders the images shown beside the text, which plain-text content would lose,
+// as markdown to append to it
+func sideImages(response *providers.Response) string {
+	var b strings.Builder
+	for _, p := range response.Parts {
+		if p.Type == providers.PartImage && p.Image != nil && p.Start == p.End {
+			alt := p.Image.AltText
+			if alt == "" {
+				alt = p.Image.Title
+			}
+			b.WriteString("\n\n![" + alt + "](" + p.Image.URL + ")")
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"time"
+)
+
+// How often a waiting request checks whether its client is still connected
+const disconnectPollInterval = 250 * time.Millisecond
+
+// withDisconnect returns a context that is cancelled once the client closes conn, so that a
+// request still waiting in the queue is dropped instead of being sent upstream for nobody.
+// fasthttp does not cancel the request context on disconnect, hence the polling.
+func withDisconnect(parent context.Context, conn net.Conn) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	raw := rawConnOf(conn)
+	if raw == nil {
+		return ctx, cancel
+	}
+
+	go func() {
+		ticker := time.NewTicker(disconnectPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if peerClosed(raw) {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return ctx, cancel
+}
+
+// rawConnOf returns the socket behind conn, looking through TLS, or nil if there is none
+func rawConnOf(conn net.Conn) syscall.RawConn {
+	if tlsConn, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = tlsConn.NetConn()
+	}
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return nil
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return nil
+	}
+	return raw
+}
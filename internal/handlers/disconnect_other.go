@@ -0,0 +1,11 @@
+//go:build !unix
+
+package handlers
+
+import "syscall"
+
+// peerClosed cannot peek at sockets on this platform; disconnects go unnoticed until the
+// response is written
+func peerClosed(raw syscall.RawConn) bool {
+	return false
+}
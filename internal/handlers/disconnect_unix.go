@@ -0,0 +1,22 @@
+//go:build unix
+
+package handlers
+
+import (
+	"errors"
+	"syscall"
+)
+
+// peerClosed peeks at the socket without consuming anything: a read of zero bytes means the
+// client has closed its end. Go sockets are non-blocking, so this never waits. Bytes the client
+// sent ahead, such as a pipelined request, hide a close until the server reads them.
+func peerClosed(raw syscall.RawConn) bool {
+	closed := false
+	_ = raw.Read(func(fd uintptr) bool {
+		var buf [1]byte
+		n, _, err := syscall.Recvfrom(int(fd), buf[:], syscall.MSG_PEEK)
+		closed = (n == 0 && err == nil) || errors.Is(err, syscall.ECONNRESET)
+		return true
+	})
+	return closed
+}
@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"strconv"
+
+	"gemini-web-to-api/internal/models"
+	"gemini-web-to-api/internal/providers"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Anthropic reports an overloaded upstream with this non-standard status
+const statusOverloaded = 529
+
+// openAIError maps a provider error to an OpenAI status and error body
+func openAIError(err *providers.Error) (int, models.ErrorResponse) {
+	status, errType, code := fiber.StatusServiceUnavailable, "server_error", "service_unavailable"
+	switch err.Kind {
+	case providers.ErrUnauthenticated:
+		// The server's own Gemini session, not the caller's API key: a 401 would tell SDKs the key is bad
+		status, errType, code = fiber.StatusServiceUnavailable, "api_error", "session_expired"
+	case providers.ErrRateLimited:
+		status, errType, code = fiber.StatusTooManyRequests, "rate_limit_error", "rate_limit_exceeded"
+	case providers.ErrContentBlocked:
+		status, errType, code = fiber.StatusBadRequest, "invalid_request_error", "content_policy_violation"
+	case providers.ErrModelUnavailable:
+		status, errType, code = fiber.StatusNotFound, "invalid_request_error", "model_not_found"
+	case providers.ErrTimeout:
+		status, errType, code = fiber.StatusGatewayTimeout, "server_error", "timeout"
+	case providers.ErrInvalidRequest:
+		status, errType, code = fiber.StatusBadRequest, "invalid_request_error", ""
+	case providers.ErrContextExceeded:
+		status, errType, code = fiber.StatusBadRequest, "invalid_request_error", "context_length_exceeded"
+	}
+	return status, models.ErrorResponse{
+		Error: models.Error{Message: err.Message, Type: errType, Code: code},
+	}
+}
+
+// claudeError maps a provider error to an Anthropic status and error body
+func claudeError(err *providers.Error) (int, fiber.Map) {
+	status, errType := statusOverloaded, "overloaded_error"
+	switch err.Kind {
+	case providers.ErrUnauthenticated:
+		status, errType = statusOverloaded, "overloaded_error"
+	case providers.ErrRateLimited:
+		status, errType = fiber.StatusTooManyRequests, "rate_limit_error"
+	case providers.ErrContentBlocked, providers.ErrInvalidRequest, providers.ErrContextExceeded:
+		status, errType = fiber.StatusBadRequest, "invalid_request_error"
+	case providers.ErrModelUnavailable:
+		status, errType = fiber.StatusNotFound, "not_found_error"
+	case providers.ErrTimeout:
+		status, errType = fiber.StatusGatewayTimeout, "timeout_error"
+	}
+	return status, fiber.Map{
+		"type":  "error",
+		"error": fiber.Map{"type": errType, "message": err.Message},
+	}
+}
+
+// geminiError maps a provider error to a Google API status and error body
+func geminiError(err *providers.Error) (int, fiber.Map) {
+	status, code := fiber.StatusServiceUnavailable, "UNAVAILABLE"
+	switch err.Kind {
+	case providers.ErrUnauthenticated:
+		status, code = fiber.StatusServiceUnavailable, "UNAVAILABLE"
+	case providers.ErrRateLimited:
+		status, code = fiber.StatusTooManyRequests, "RESOURCE_EXHAUSTED"
+	case providers.ErrContentBlocked, providers.ErrInvalidRequest, providers.ErrContextExceeded:
+		status, code = fiber.StatusBadRequest, "INVALID_ARGUMENT"
+	case providers.ErrModelUnavailable:
+		status, code = fiber.StatusNotFound, "NOT_FOUND"
+	case providers.ErrTimeout:
+		status, code = fiber.StatusGatewayTimeout, "DEADLINE_EXCEEDED"
+	}
+	return status, fiber.Map{
+		"error": fiber.Map{"code": status, "message": err.Message, "status": code},
+	}
+}
+
+// setRetryHeaders tells SDK clients whether to retry: the OpenAI and Anthropic SDKs honor
+// x-should-retry, and all of them honor Retry-After
+func setRetryHeaders(c *fiber.Ctx, err *providers.Error) {
+	c.Set("x-should-retry", strconv.FormatBool(err.Retryable()))
+	if err.RetryAfter > 0 {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(err.RetryAfter.Seconds()+0.5)))
+	}
+}
+
+// sendOpenAIError responds to an OpenAI-style request with the classified error
+func sendOpenAIError(c *fiber.Ctx, err error) error {
+	providerErr := providers.AsError(err)
+	setRetryHeaders(c, providerErr)
+	status, body := openAIError(providerErr)
+	return c.Status(status).JSON(body)
+}
+
+// sendClaudeError responds to an Anthropic-style request with the classified error
+func sendClaudeError(c *fiber.Ctx, err error) error {
+	providerErr := providers.AsError(err)
+	setRetryHeaders(c, providerErr)
+	status, body := claudeError(providerErr)
+	return c.Status(status).JSON(body)
+}
+
+// sendGeminiError responds to a Google-style request with the classified error
+func sendGeminiError(c *fiber.Ctx, err error) error {
+	providerErr := providers.AsError(err)
+	setRetryHeaders(c, providerErr)
+	status, body := geminiError(providerErr)
+	return c.Status(status).JSON(body)
+}
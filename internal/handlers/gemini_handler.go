@@ -8,24 +8,44 @@ import (
 	"sync"
 	"time"
 
+	"gemini-web-to-api/internal/cache"
+	"gemini-web-to-api/internal/coalesce"
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/contextwindow"
+	"gemini-web-to-api/internal/ephemeral"
 	"gemini-web-to-api/internal/models"
+	"gemini-web-to-api/internal/prompts"
 	"gemini-web-to-api/internal/providers"
 	"gemini-web-to-api/internal/providers/gemini"
+	"gemini-web-to-api/internal/queue"
+	"gemini-web-to-api/internal/routing"
 
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 )
 
 type GeminiHandler struct {
-	client *gemini.Client
-	log    *zap.Logger
-	mu     sync.RWMutex
+	client    *gemini.Client
+	ephemeral *ephemeral.Manager
+	cache     *cache.Cache
+	flights   *coalesce.Group
+	window    *contextwindow.Manager
+	router    *routing.Router
+	store     *config.Store
+	log       *zap.Logger
+	mu        sync.RWMutex
 }
 
-func NewGeminiHandler(client *gemini.Client) *GeminiHandler {
+func NewGeminiHandler(client *gemini.Client, ephemeralManager *ephemeral.Manager, responseCache *cache.Cache, flights *coalesce.Group, window *contextwindow.Manager, router *routing.Router, store *config.Store) *GeminiHandler {
 	return &GeminiHandler{
-		client: client,
-		log:    zap.NewNop(), // Will be injected via wire if needed
+		client:    client,
+		ephemeral: ephemeralManager,
+		cache:     responseCache,
+		flights:   flights,
+		window:    window,
+		router:    router,
+		store:     store,
+		log:       zap.NewNop(), // Will be injected via wire if needed
 	}
 }
 
@@ -46,6 +66,16 @@ func (h *GeminiHandler) IsHealthy() bool {
 	return h.client.IsHealthy()
 }
 
+// UnhealthyReason explains why the underlying Gemini client is unhealthy
+func (h *GeminiHandler) UnhealthyReason() string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if h.client == nil {
+		return "client not initialized"
+	}
+	return h.client.UnhealthyReason()
+}
+
 // --- Official Gemini API (v1beta) ---
 
 // HandleV1BetaModels returns the list of models in Gemini format
@@ -56,74 +86,179 @@ func (h *GeminiHandler) HandleV1BetaModels(c *fiber.Ctx) error {
 	availableModels := h.client.ListModels()
 	var geminiModels []models.GeminiModel
 	for _, m := range availableModels {
-		geminiModels = append(geminiModels, models.GeminiModel{
-			Name:                       "models/" + m.ID,
-			DisplayName:                m.ID,
-			SupportedGenerationMethods: []string{"generateContent", "streamGenerateContent"},
-		})
+		geminiModels = append(geminiModels, toGeminiModel(m))
 	}
 	return c.JSON(models.GeminiModelsResponse{Models: geminiModels})
 }
 
-// HandleV1BetaGenerateContent handles the official Gemini generateContent endpoint
-func (h *GeminiHandler) HandleV1BetaGenerateContent(c *fiber.Ctx) error {
+// HandleV1BetaGetModel returns a single model in Gemini format
+func (h *GeminiHandler) HandleV1BetaGetModel(c *fiber.Ctx) error {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
 
 	model := c.Params("model")
-	var req models.GeminiGenerateRequest
-	if err := c.BodyParser(&req); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("invalid request body: %w", err), "invalid_request_error"))
+	m, ok := h.client.GetModel(model)
+	if !ok {
+		return c.Status(fiber.StatusNotFound).JSON(errorToResponse(fmt.Errorf("model not found: %s", model), "not_found_error"))
 	}
+	return c.JSON(toGeminiModel(m))
+}
 
-	// Extract prompt from contents
-	var promptBuilder strings.Builder
-	for _, content := range req.Contents {
+func toGeminiModel(m providers.ModelInfo) models.GeminiModel {
+	displayName := m.DisplayName
+	if displayName == "" {
+		displayName = m.ID
+	}
+	return models.GeminiModel{
+		Name:                       "models/" + m.ID,
+		DisplayName:                displayName,
+		Description:                m.Description,
+		InputTokenLimit:            m.ContextWindow,
+		SupportedGenerationMethods: []string{"generateContent", "streamGenerateContent"},
+	}
+}
+
+// geminiMessages reads the conversation from the contents, a message per content
+func geminiMessages(contents []models.Content) []models.Message {
+	messages := make([]models.Message, 0, len(contents))
+	for _, content := range contents {
+		var texts []string
 		for _, part := range content.Parts {
-			if part.Text != "" {
-				promptBuilder.WriteString(part.Text)
-				promptBuilder.WriteString("\n")
+			// Thought parts are the model's earlier thinking, not conversation
+			if part.Text != "" && !part.Thought {
+				texts = append(texts, part.Text)
 			}
 		}
+		messages = append(messages, models.Message{Role: content.Role, Content: strings.Join(texts, "\n")})
+	}
+	return messages
+}
+
+// geminiTemplate returns the prompt template the route names, or the configured default.
+// Unlike the chat APIs, the Gemini API has no built-in default: when no template is
+// configured its contents are sent as they are.
+func geminiTemplate(cfg *config.Config, route routing.Route) prompts.Template {
+	name := route.Template
+	if name == "" {
+		name = cfg.Routing.Template
+	}
+	if name == "" {
+		return nil
+	}
+	tmpl, _ := prompts.Lookup(name)
+	return tmpl
+}
+
+// buildGeminiPrompt renders the conversation with the template, if any; otherwise it joins
+// the text of the conversation, after the route's system prompt
+func buildGeminiPrompt(messages []models.Message, systemPrompt string, tmpl prompts.Template) string {
+	if tmpl != nil {
+		return tmpl.Build(messages, systemPrompt)
+	}
+
+	var promptBuilder strings.Builder
+	for _, msg := range messages {
+		if msg.Content != "" {
+			promptBuilder.WriteString(msg.Content)
+			promptBuilder.WriteString("\n")
+		}
 	}
 
 	prompt := strings.TrimSpace(promptBuilder.String())
-	if prompt == "" {
+	if prompt != "" && systemPrompt != "" {
+		prompt = fmt.Sprintf("System: %s\n\n%s", systemPrompt, prompt)
+	}
+	return prompt
+}
+
+// HandleV1BetaGenerateContent handles the official Gemini generateContent endpoint
+func (h *GeminiHandler) HandleV1BetaGenerateContent(c *fiber.Ctx) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	model := c.Params("model")
+	var req models.GeminiGenerateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("invalid request body: %w", err), "invalid_request_error"))
+	}
+
+	// Extract the conversation from contents
+	messages := geminiMessages(req.Contents)
+	if buildGeminiPrompt(messages, "", nil) == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("empty content"), "invalid_request_error"))
 	}
 
-	opts := []providers.GenerateOption{providers.WithModel(model)}
-	if strings.Contains(model, "deep-research") {
-		opts = append(opts, providers.WithDeepResearch(true))
+	cfg := h.store.Current()
+	route := resolveRoute(h.router, h.client, routing.FlavorGemini, model)
+	priority := requestPriority(c, cfg, route)
+
+	// Shortened to fit the model's context window
+	tmpl := geminiTemplate(cfg, route)
+	fit, err := fitContext(c, h.window, cfg, priority, route.Model, messages, func(messages []models.Message) string {
+		return buildGeminiPrompt(messages, route.SystemPrompt, tmpl)
+	})
+	if err != nil {
+		return sendGeminiError(c, err)
 	}
+	prompt := fit.Prompt
+	if err := validatePromptLength(prompt, cfg); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(err, "invalid_request_error"))
+	}
+
+	opts := append(routeOptions(route), providers.WithTemperature(float64(req.GenerationConfig.GetTemperature())))
+
+	isEphemeral := h.ephemeral.Applies(extractAPIKey(c), c.Get(ephemeral.HeaderName))
+	lookup := lookupCache(c, h.cache, prompt, opts, isEphemeral)
 
-	// Add timeout to context
-	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Minute)
+	// Bound by the timeout and the client connection
+	ctx, cancel := generationContext(c.Context(), cfg, priority)
 	defer cancel()
+	ctx, queueStats := queue.WithStats(ctx)
 
-	response, err := h.client.GenerateContent(ctx, prompt, opts...)
+	response, owner, shared, err := generate(ctx, h.client, h.flights, lookup, prompt, tmpl, opts, isEphemeral)
+	setQueueHeaders(c, queueStats, shared)
 	if err != nil {
-		h.log.Error("GenerateContent failed", zap.Error(err), zap.String("model", model))
-		return c.Status(fiber.StatusInternalServerError).JSON(errorToResponse(err, "api_error"))
+		h.log.Error("GenerateContent failed", zap.Error(err), zap.String("model", route.Model))
+		return sendGeminiError(c, err)
+	}
+
+	if isEphemeral && owner {
+		h.ephemeral.Release(conversationIDOf(response))
 	}
 
+	segments := geminiSegments(response)
+	parts := geminiParts(response, segments, req.GenerationConfig.IncludeThoughts())
 	return c.JSON(models.GeminiGenerateResponse{
 		Candidates: []models.Candidate{
 			{
 				Index: 0,
 				Content: models.Content{
 					Role:  "model",
-					Parts: []models.Part{{Text: response.Text}},
+					Parts: parts,
 				},
-				FinishReason: "STOP",
+				FinishReason:      "STOP",
+				GroundingMetadata: geminiGrounding(response, segments, len(parts)-len(segments)),
 			},
 		},
 		UsageMetadata: &models.UsageMetadata{
 			TotalTokenCount: 0,
 		},
+		ModelVersion: route.Model,
 	})
 }
 
+// geminiParts returns the parts of a response, led by a thought part when thoughts were requested
+func geminiParts(response *providers.Response, segments []geminiSegment, includeThoughts bool) []models.Part {
+	parts := []models.Part{}
+	if includeThoughts && response.Thinking != "" {
+		parts = append(parts, models.Part{Text: response.Thinking, Thought: true})
+	}
+	for _, segment := range segments {
+		parts = append(parts, segment.part)
+	}
+	return parts
+}
+
 // HandleV1BetaStreamGenerateContent handles the official Gemini streaming endpoint
 func (h *GeminiHandler) HandleV1BetaStreamGenerateContent(c *fiber.Ctx) error {
 	h.mu.RLock()
@@ -135,54 +270,90 @@ func (h *GeminiHandler) HandleV1BetaStreamGenerateContent(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("invalid request body: %w", err), "invalid_request_error"))
 	}
 
-	var promptBuilder strings.Builder
-	for _, content := range req.Contents {
-		for _, part := range content.Parts {
-			if part.Text != "" {
-				promptBuilder.WriteString(part.Text)
-				promptBuilder.WriteString("\n")
-			}
-		}
-	}
-
-	prompt := strings.TrimSpace(promptBuilder.String())
-	if prompt == "" {
+	messages := geminiMessages(req.Contents)
+	if buildGeminiPrompt(messages, "", nil) == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("empty content"), "invalid_request_error"))
 	}
 
-	opts := []providers.GenerateOption{providers.WithModel(model)}
-	if strings.Contains(model, "deep-research") {
-		opts = append(opts, providers.WithDeepResearch(true))
+	cfg := h.store.Current()
+	route := resolveRoute(h.router, h.client, routing.FlavorGemini, model)
+	priority := requestPriority(c, cfg, route)
+
+	// Shortened to fit the model's context window
+	tmpl := geminiTemplate(cfg, route)
+	fit, err := fitContext(c, h.window, cfg, priority, route.Model, messages, func(messages []models.Message) string {
+		return buildGeminiPrompt(messages, route.SystemPrompt, tmpl)
+	})
+	if err != nil {
+		return sendGeminiError(c, err)
+	}
+	prompt := fit.Prompt
+	if err := validatePromptLength(prompt, cfg); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(err, "invalid_request_error"))
 	}
 
+	opts := append(routeOptions(route), providers.WithTemperature(float64(req.GenerationConfig.GetTemperature())))
+
+	isEphemeral := h.ephemeral.Applies(extractAPIKey(c), c.Get(ephemeral.HeaderName))
+	lookup := lookupCache(c, h.cache, prompt, opts, isEphemeral)
+
 	c.Set("Content-Type", "application/json")
 	c.Set("Transfer-Encoding", "chunked")
 
-	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
-		// Add timeout to context
-		ctx, cancel := context.WithTimeout(c.Context(), 5*time.Minute)
+	reqCtx := c.Context()
+	reqCtx.SetBodyStreamWriter(func(w *bufio.Writer) {
+		// Bound by the timeout and the client connection
+		ctx, cancel := generationContext(reqCtx, cfg, priority)
 		defer cancel()
 
-		resp, err := h.client.GenerateContent(ctx, prompt, opts...)
+		resp, owner, _, err := generate(ctx, h.client, h.flights, lookup, prompt, tmpl, opts, isEphemeral)
 		if err != nil {
-			h.log.Error("GenerateContent streaming failed", zap.Error(err), zap.String("model", model))
-			errResponse := errorToResponse(err, "api_error")
+			h.log.Error("GenerateContent streaming failed", zap.Error(err), zap.String("model", route.Model))
+			_, errResponse := geminiError(providers.AsError(err))
 			_ = sendStreamChunk(w, h.log, errResponse)
 			return
 		}
 
-		chunks := splitResponseIntoChunks(resp.Text, 30)
-		for i, content := range chunks {
+		// Deleted however the stream ends, also when the client goes away
+		if isEphemeral && owner {
+			defer h.ephemeral.Release(conversationIDOf(resp))
+		}
+
+		// Thought parts stream first, as from thinking models of the official API. Text is
+		// streamed in chunks; code, its output and images go out whole.
+		var parts []models.Part
+		firstPart := 0
+		if req.GenerationConfig.IncludeThoughts() && resp.Thinking != "" {
+			firstPart = 1
+			for _, content := range splitResponseIntoChunks(resp.Thinking, 30) {
+				if content != "" {
+					parts = append(parts, models.Part{Text: content, Thought: true})
+				}
+			}
+		}
+		segments := geminiSegments(resp)
+		for _, segment := range segments {
+			if segment.part.Text == "" {
+				parts = append(parts, segment.part)
+				continue
+			}
+			for _, content := range splitResponseIntoChunks(segment.part.Text, 30) {
+				parts = append(parts, models.Part{Text: content})
+			}
+		}
+
+		for i, part := range parts {
 			chunk := models.GeminiGenerateResponse{
 				Candidates: []models.Candidate{
 					{
 						Index: 0,
 						Content: models.Content{
 							Role:  "model",
-							Parts: []models.Part{{Text: content}},
+							Parts: []models.Part{part},
 						},
 					},
 				},
+				ModelVersion: route.Model,
 			}
 
 			if err := sendStreamChunk(w, h.log, chunk); err != nil {
@@ -191,20 +362,22 @@ func (h *GeminiHandler) HandleV1BetaStreamGenerateContent(c *fiber.Ctx) error {
 			}
 
 			// Check for context cancellation and sleep
-			if !sleepWithCancel(c.Context(), 30*time.Millisecond) {
+			if !sleepWithCancel(ctx, 30*time.Millisecond) {
 				h.log.Info("Stream cancelled by client")
 				return
 			}
 		}
 
-		// Send final chunk
+		// Send final chunk, with grounding over the streamed parts
 		finalChunk := models.GeminiGenerateResponse{
 			Candidates: []models.Candidate{
 				{
-					Index:        0,
-					FinishReason: "STOP",
+					Index:             0,
+					FinishReason:      "STOP",
+					GroundingMetadata: geminiGrounding(resp, segments, firstPart),
 				},
 			},
+			ModelVersion: route.Model,
 		}
 		_ = sendStreamChunk(w, h.log, finalChunk)
 	})
@@ -228,10 +401,114 @@ func (h *GeminiHandler) HandleRetrieveDeepResearch(c *fiber.Ctx) error {
 	response, err := h.client.RetrieveDeepResearch(ctx, conversationID)
 	if err != nil {
 		h.log.Error("RetrieveDeepResearch failed", zap.Error(err), zap.String("conversation_id", conversationID))
-		return c.Status(fiber.StatusInternalServerError).JSON(errorToResponse(err, "api_error"))
+		return sendGeminiError(c, err)
 	}
 
 	return c.JSON(response)
 }
 
+// HandleListConversations lists the most recent conversations in the account history
+func (h *GeminiHandler) HandleListConversations(c *fiber.Ctx) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	limit := c.QueryInt("limit", 0)
+	if limit < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("limit must be non-negative"), "invalid_request_error"))
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 1*time.Minute)
+	defer cancel()
+
+	conversations, err := h.client.ListConversations(ctx, limit)
+	if err != nil {
+		h.log.Error("ListConversations failed", zap.Error(err))
+		return sendGeminiError(c, err)
+	}
+
+	return c.JSON(models.ConversationListResponse{Conversations: conversations})
+}
+
+// HandleGetConversation returns the turns of a conversation
+func (h *GeminiHandler) HandleGetConversation(c *fiber.Ctx) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	conversationID := c.Params("conversationID")
+	if conversationID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("missing conversationID"), "invalid_request_error"))
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 1*time.Minute)
+	defer cancel()
+
+	turns, err := h.client.GetConversation(ctx, conversationID, c.QueryInt("limit", 0))
+	if err != nil {
+		h.log.Error("GetConversation failed", zap.Error(err), zap.String("conversation_id", conversationID))
+		return sendGeminiError(c, err)
+	}
+
+	return c.JSON(models.ConversationResponse{ID: conversationID, Turns: turns})
+}
+
+// HandleUpdateConversation renames and/or pins a conversation
+func (h *GeminiHandler) HandleUpdateConversation(c *fiber.Ctx) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
 
+	conversationID := c.Params("conversationID")
+	if conversationID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("missing conversationID"), "invalid_request_error"))
+	}
+
+	var req models.ConversationUpdateRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("invalid request body: %w", err), "invalid_request_error"))
+	}
+	if req.Title == nil && req.Pinned == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("nothing to update: provide title and/or pinned"), "invalid_request_error"))
+	}
+	if req.Title != nil && strings.TrimSpace(*req.Title) == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("title cannot be empty"), "invalid_request_error"))
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 1*time.Minute)
+	defer cancel()
+
+	if req.Title != nil {
+		if err := h.client.RenameConversation(ctx, conversationID, strings.TrimSpace(*req.Title)); err != nil {
+			h.log.Error("RenameConversation failed", zap.Error(err), zap.String("conversation_id", conversationID))
+			return sendGeminiError(c, err)
+		}
+	}
+
+	if req.Pinned != nil {
+		if err := h.client.PinConversation(ctx, conversationID, *req.Pinned); err != nil {
+			h.log.Error("PinConversation failed", zap.Error(err), zap.String("conversation_id", conversationID))
+			return sendGeminiError(c, err)
+		}
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// HandleDeleteConversation removes a conversation from the account history
+func (h *GeminiHandler) HandleDeleteConversation(c *fiber.Ctx) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	conversationID := c.Params("conversationID")
+	if conversationID == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("missing conversationID"), "invalid_request_error"))
+	}
+
+	ctx, cancel := context.WithTimeout(c.Context(), 1*time.Minute)
+	defer cancel()
+
+	if err := h.client.DeleteConversation(ctx, conversationID); err != nil {
+		h.log.Error("DeleteConversation failed", zap.Error(err), zap.String("conversation_id", conversationID))
+		return sendGeminiError(c, err)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
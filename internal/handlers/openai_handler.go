@@ -2,28 +2,45 @@ package handlers
 
 import (
 	"bufio"
-	"context"
 	"fmt"
-	"strings"
 	"time"
 
+	"gemini-web-to-api/internal/cache"
+	"gemini-web-to-api/internal/coalesce"
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/contextwindow"
+	"gemini-web-to-api/internal/ephemeral"
 	"gemini-web-to-api/internal/models"
 	"gemini-web-to-api/internal/providers"
 	"gemini-web-to-api/internal/providers/gemini"
+	"gemini-web-to-api/internal/queue"
+	"gemini-web-to-api/internal/routing"
 
 	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 )
 
 type OpenAIHandler struct {
-	client *gemini.Client
-	log    *zap.Logger
+	client    *gemini.Client
+	ephemeral *ephemeral.Manager
+	cache     *cache.Cache
+	flights   *coalesce.Group
+	window    *contextwindow.Manager
+	router    *routing.Router
+	store     *config.Store
+	log       *zap.Logger
 }
 
-func NewOpenAIHandler(client *gemini.Client) *OpenAIHandler {
+func NewOpenAIHandler(client *gemini.Client, ephemeralManager *ephemeral.Manager, responseCache *cache.Cache, flights *coalesce.Group, window *contextwindow.Manager, router *routing.Router, store *config.Store) *OpenAIHandler {
 	return &OpenAIHandler{
-		client: client,
-		log:    zap.NewNop(),
+		client:    client,
+		ephemeral: ephemeralManager,
+		cache:     responseCache,
+		flights:   flights,
+		window:    window,
+		router:    router,
+		store:     store,
+		log:       zap.NewNop(),
 	}
 }
 
@@ -58,7 +75,6 @@ func (h *OpenAIHandler) HandleModels(c *fiber.Ctx) error {
 	})
 }
 
-
 // HandleChatCompletions accepts requests in OpenAI format
 func (h *OpenAIHandler) HandleChatCompletions(c *fiber.Ctx) error {
 	var req models.ChatCompletionRequest
@@ -76,20 +92,38 @@ func (h *OpenAIHandler) HandleChatCompletions(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(err, "invalid_request_error"))
 	}
 
-	// Build prompt from messages
-	prompt := buildPromptFromMessages(req.Messages, "")
+	cfg := h.store.Current()
+	if req.Model == "" {
+		req.Model = cfg.OpenAI.Model
+	}
+	route := resolveRoute(h.router, h.client, routing.FlavorOpenAI, req.Model)
+	priority := requestPriority(c, cfg, route)
+
+	// Build prompt from messages, shortened to fit the model's context window
+	systemPrompt := ""
+	if !hasSystemMessage(req.Messages) {
+		systemPrompt = route.SystemPrompt
+	}
+	tmpl := promptTemplate(cfg, route)
+	fit, err := fitContext(c, h.window, cfg, priority, route.Model, req.Messages, func(messages []models.Message) string {
+		return tmpl.Build(messages, systemPrompt)
+	})
+	if err != nil {
+		return sendOpenAIError(c, err)
+	}
+	prompt := fit.Prompt
 	if prompt == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(fmt.Errorf("no valid content in messages"), "invalid_request_error"))
 	}
-
-	opts := []providers.GenerateOption{}
-	if req.Model != "" {
-		opts = append(opts, providers.WithModel(req.Model))
-		if strings.Contains(req.Model, "deep-research") {
-			opts = append(opts, providers.WithDeepResearch(true))
-		}
+	if err := validatePromptLength(prompt, cfg); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errorToResponse(err, "invalid_request_error"))
 	}
 
+	opts := append(routeOptions(route), providers.WithTemperature(float64(req.Temperature)))
+
+	isEphemeral := h.ephemeral.Applies(extractAPIKey(c), c.Get(ephemeral.HeaderName))
+	lookup := lookupCache(c, h.cache, prompt, opts, isEphemeral)
+
 	// Handle Streaming
 	if req.Stream {
 		c.Set("Content-Type", "text/event-stream")
@@ -97,33 +131,51 @@ func (h *OpenAIHandler) HandleChatCompletions(c *fiber.Ctx) error {
 		c.Set("Connection", "keep-alive")
 		c.Set("Transfer-Encoding", "chunked")
 
-		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
-			// Add timeout
-			ctx, cancel := context.WithTimeout(c.Context(), 5*time.Minute)
+		reqCtx := c.Context()
+		reqCtx.SetBodyStreamWriter(func(w *bufio.Writer) {
+			// Bound by the timeout and the client connection
+			ctx, cancel := generationContext(reqCtx, cfg, priority)
 			defer cancel()
 
-			response, err := h.client.GenerateContent(ctx, prompt, opts...)
+			response, owner, _, err := generate(ctx, h.client, h.flights, lookup, prompt, tmpl, opts, isEphemeral)
 			if err != nil {
-				h.log.Error("GenerateContent streaming failed", zap.Error(err), zap.String("model", req.Model))
-				errResponse := errorToResponse(err, "api_error")
-				_ = marshalJSONSafely(h.log, errResponse) // Use safe marshal
+				h.log.Error("GenerateContent streaming failed", zap.Error(err), zap.String("model", route.Model))
+				_, errResponse := openAIError(providers.AsError(err))
+				_ = sendSSEChunk(w, h.log, "data", errResponse)
 				return
 			}
 
+			// Deleted however the stream ends, also when the client goes away
+			if isEphemeral && owner {
+				defer h.ephemeral.Release(conversationIDOf(response))
+			}
+
 			id := fmt.Sprintf("chatcmpl-%d", time.Now().Unix())
 			created := time.Now().Unix()
-			chunks := splitResponseIntoChunks(response.Text, 20)
 
-			for i, content := range chunks {
+			// Reasoning deltas come first, as from OpenAI-compatible reasoning models
+			var deltas []models.Delta
+			if req.IncludeReasoning {
+				for _, content := range splitResponseIntoChunks(response.Thinking, 20) {
+					if content != "" {
+						deltas = append(deltas, models.Delta{ReasoningContent: content})
+					}
+				}
+			}
+			for _, content := range splitResponseIntoChunks(response.Text+sideImages(response), 20) {
+				deltas = append(deltas, models.Delta{Content: content})
+			}
+
+			for i, delta := range deltas {
 				chunk := models.ChatCompletionChunk{
 					ID:      id,
 					Object:  "chat.completion.chunk",
 					Created: created,
-					Model:   req.Model,
+					Model:   route.Model,
 					Choices: []models.ChunkChoice{
 						{
 							Index: 0,
-							Delta: models.Delta{Content: content},
+							Delta: delta,
 						},
 					},
 				}
@@ -134,22 +186,22 @@ func (h *OpenAIHandler) HandleChatCompletions(c *fiber.Ctx) error {
 				}
 
 				// Check context cancellation
-				if !sleepWithCancel(c.Context(), 20*time.Millisecond) {
+				if !sleepWithCancel(ctx, 20*time.Millisecond) {
 					h.log.Info("Stream cancelled by client")
 					return
 				}
 			}
 
-			// Send final chunk with finish_reason
+			// Send final chunk with finish_reason and the cited sources
 			finalChunk := models.ChatCompletionChunk{
 				ID:      id,
 				Object:  "chat.completion.chunk",
 				Created: created,
-				Model:   req.Model,
+				Model:   route.Model,
 				Choices: []models.ChunkChoice{
 					{
 						Index:        0,
-						Delta:        models.Delta{},
+						Delta:        models.Delta{Annotations: openAIAnnotations(response)},
 						FinishReason: "stop",
 					},
 				},
@@ -166,19 +218,29 @@ func (h *OpenAIHandler) HandleChatCompletions(c *fiber.Ctx) error {
 	}
 
 	// Non-streaming response
-	ctx, cancel := context.WithTimeout(c.Context(), 5*time.Minute)
+	ctx, cancel := generationContext(c.Context(), cfg, priority)
 	defer cancel()
+	ctx, queueStats := queue.WithStats(ctx)
 
-	response, err := h.client.GenerateContent(ctx, prompt, opts...)
+	response, owner, shared, err := generate(ctx, h.client, h.flights, lookup, prompt, tmpl, opts, isEphemeral)
+	setQueueHeaders(c, queueStats, shared)
 	if err != nil {
-		h.log.Error("GenerateContent failed", zap.Error(err), zap.String("model", req.Model))
-		return c.Status(fiber.StatusInternalServerError).JSON(errorToResponse(err, "api_error"))
+		h.log.Error("GenerateContent failed", zap.Error(err), zap.String("model", route.Model))
+		return sendOpenAIError(c, err)
 	}
 
-	return c.JSON(h.convertToOpenAIFormat(response, req.Model))
+	if isEphemeral && owner {
+		h.ephemeral.Release(conversationIDOf(response))
+	}
+
+	return c.JSON(h.convertToOpenAIFormat(response, route.Model, req.IncludeReasoning))
 }
 
-func (h *OpenAIHandler) convertToOpenAIFormat(response *providers.Response, model string) models.ChatCompletionResponse {
+func (h *OpenAIHandler) convertToOpenAIFormat(response *providers.Response, model string, includeReasoning bool) models.ChatCompletionResponse {
+	reasoning := ""
+	if includeReasoning {
+		reasoning = response.Thinking
+	}
 	return models.ChatCompletionResponse{
 		ID:      fmt.Sprintf("chatcmpl-%d", time.Now().Unix()),
 		Object:  "chat.completion",
@@ -188,8 +250,10 @@ func (h *OpenAIHandler) convertToOpenAIFormat(response *providers.Response, mode
 			{
 				Index: 0,
 				Message: models.Message{
-					Role:    "assistant",
-					Content: response.Text,
+					Role:             "assistant",
+					Content:          response.Text + sideImages(response),
+					ReasoningContent: reasoning,
+					Annotations:      openAIAnnotations(response),
 				},
 				FinishReason: "stop",
 			},
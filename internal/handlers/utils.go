@@ -5,33 +5,85 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"net"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 
+	"gemini-web-to-api/internal/cache"
+	"gemini-web-to-api/internal/coalesce"
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/contextwindow"
 	"gemini-web-to-api/internal/models"
+	"gemini-web-to-api/internal/prompts"
+	"gemini-web-to-api/internal/providers"
+	"gemini-web-to-api/internal/providers/gemini"
+	"gemini-web-to-api/internal/queue"
+	"gemini-web-to-api/internal/routing"
 
+	"github.com/gofiber/fiber/v2"
 	"go.uber.org/zap"
 )
 
-// buildPromptFromMessages constructs a unified prompt from messages
-func buildPromptFromMessages(messages []models.Message, systemPrompt string) string {
-	var promptBuilder strings.Builder
-
-	if systemPrompt != "" {
-		promptBuilder.WriteString(fmt.Sprintf("System: %s\n\n", systemPrompt))
+// promptTemplate returns the prompt template the route names, or the configured default
+func promptTemplate(cfg *config.Config, route routing.Route) prompts.Template {
+	name := route.Template
+	if name == "" {
+		name = cfg.Routing.Template
+	}
+	tmpl, ok := prompts.Lookup(name)
+	if !ok {
+		tmpl, _ = prompts.Lookup(prompts.DefaultTemplate)
 	}
+	return tmpl
+}
 
+// hasSystemMessage reports whether the messages already carry a system prompt
+func hasSystemMessage(messages []models.Message) bool {
 	for _, msg := range messages {
-		role := "User"
-		if strings.EqualFold(msg.Role, "assistant") || strings.EqualFold(msg.Role, "model") {
-			role = "Model"
-		} else if strings.EqualFold(msg.Role, "system") {
-			role = "System"
+		if strings.EqualFold(msg.Role, "system") && strings.TrimSpace(msg.Content) != "" {
+			return true
 		}
-		promptBuilder.WriteString(fmt.Sprintf("%s: %s\n", role, msg.Content))
 	}
+	return false
+}
+
+// resolveRoute routes a request's model and maps a model alias the route lands on to the
+// model it points at, so the alias is generated, cached and shared as its target
+func resolveRoute(router *routing.Router, client *gemini.Client, flavor, model string) routing.Route {
+	route := router.Resolve(flavor, model)
+	route.Model = client.ResolveModel(route.Model)
+	return route
+}
+
+// routeOptions converts a resolved route into generation options
+func routeOptions(route routing.Route) []providers.GenerateOption {
+	opts := []providers.GenerateOption{}
+	if route.Model != "" {
+		opts = append(opts, providers.WithModel(route.Model))
+	}
+	if route.DeepResearch {
+		opts = append(opts, providers.WithDeepResearch(true))
+	}
+	if route.Gem != "" {
+		opts = append(opts, providers.WithGem(route.Gem))
+	}
+	return opts
+}
+
+// requestTimeout returns how long a generation request may take
+func requestTimeout(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.Limits.RequestTimeout) * time.Second
+}
 
-	return strings.TrimSpace(promptBuilder.String())
+// validatePromptLength enforces the configured prompt size limit
+func validatePromptLength(prompt string, cfg *config.Config) error {
+	if limit := cfg.Limits.MaxPromptChars; limit > 0 && utf8.RuneCountInString(prompt) > limit {
+		return fmt.Errorf("prompt is too long: %d characters (limit %d)", utf8.RuneCountInString(prompt), limit)
+	}
+	return nil
 }
 
 // validateMessages validates that messages array is not empty and not all empty
@@ -143,3 +195,167 @@ func errorToResponse(err error, errorType string) models.ErrorResponse {
 		},
 	}
 }
+
+// extractAPIKey returns the client's API key from any of the supported auth styles
+// (OpenAI bearer token, Anthropic x-api-key, Google x-goog-api-key or ?key=)
+func extractAPIKey(c *fiber.Ctx) string {
+	if auth := c.Get(fiber.HeaderAuthorization); auth != "" {
+		if key := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer ")); key != "" {
+			return key
+		}
+	}
+	if key := c.Get("x-api-key"); key != "" {
+		return key
+	}
+	if key := c.Get("x-goog-api-key"); key != "" {
+		return key
+	}
+	return c.Query("key")
+}
+
+// conversationIDOf returns the upstream conversation ID (cid) of a response
+func conversationIDOf(response *providers.Response) string {
+	if response == nil {
+		return ""
+	}
+	if response.ConversationID != "" {
+		return response.ConversationID
+	}
+	cid, _ := response.Metadata["cid"].(string)
+	return cid
+}
+
+// Response headers reporting how long a request waited for a free slot on the Gemini account
+const (
+	HeaderQueueWait     = "X-Queue-Wait-Ms"
+	HeaderQueuePosition = "X-Queue-Position"
+	HeaderQueuePriority = "X-Queue-Priority"
+)
+
+// HeaderPriority lets a client queue its request at a lower priority than its API key allows
+const HeaderPriority = "X-Priority"
+
+// setQueueHeaders reports the queue wait of a non-streaming request. A request that shared
+// another's generation has no wait of its own and gets no queue headers.
+func setQueueHeaders(c *fiber.Ctx, stats *queue.Stats, shared bool) {
+	if shared {
+		return
+	}
+	c.Set(HeaderQueueWait, strconv.FormatInt(stats.Wait.Milliseconds(), 10))
+	c.Set(HeaderQueuePosition, strconv.Itoa(stats.Position))
+	c.Set(HeaderQueuePriority, stats.Priority.String())
+}
+
+// lookupCache consults the response cache for a request and reports the outcome in the
+// X-Cache header, with the Age of a cached response. Ephemeral requests bypass the cache.
+func lookupCache(c *fiber.Ctx, rc *cache.Cache, prompt string, opts []providers.GenerateOption, isEphemeral bool) *cache.Lookup {
+	lookup := rc.Lookup(cache.Request{
+		Prompt:       prompt,
+		Options:      opts,
+		APIKey:       extractAPIKey(c),
+		CacheControl: c.Get(fiber.HeaderCacheControl),
+		Ephemeral:    isEphemeral,
+	})
+	if lookup.Status != "" {
+		c.Set(cache.HeaderName, string(lookup.Status))
+	}
+	if lookup.Hit() {
+		c.Set(fiber.HeaderAge, strconv.Itoa(int(lookup.Age.Seconds())))
+	}
+	return lookup
+}
+
+// Response headers reporting how a conversation was shortened to fit the context window
+const (
+	HeaderContextTruncated  = "X-Context-Truncated" // the strategy that shortened it
+	HeaderContextDropped    = "X-Context-Dropped-Messages"
+	HeaderContextSummarized = "X-Context-Summarized-Messages"
+)
+
+// fitContext builds the prompt of a conversation within the model's context window and
+// reports in the response headers how the conversation was shortened, if it was
+func fitContext(c *fiber.Ctx, window *contextwindow.Manager, cfg *config.Config, priority queue.Priority, model string, messages []models.Message, build func([]models.Message) string) (*contextwindow.Result, error) {
+	// A summary is generated like any other request
+	ctx, cancel := generationContext(c.Context(), cfg, priority)
+	defer cancel()
+
+	fit, err := window.Fit(ctx, model, messages, build)
+	if err != nil {
+		return nil, err
+	}
+	if fit.Truncated() {
+		c.Set(HeaderContextTruncated, fit.Strategy)
+		c.Set(HeaderContextDropped, strconv.Itoa(fit.Dropped))
+		c.Set(HeaderContextSummarized, strconv.Itoa(fit.Summarized))
+	}
+	return fit, nil
+}
+
+// generate answers from the cache on a hit; otherwise it joins an identical request in
+// flight, or asks Gemini, and caches the response. The reply is cleaned of what the model
+// echoed of the prompt template, when the prompt was built with one. Owner reports whether
+// this request handles the response's side effects, which only one of the requests sharing
+// it may. Shared reports that the request joined another's generation, so it never went
+// through the queue itself.
+func generate(ctx context.Context, client *gemini.Client, flights *coalesce.Group, lookup *cache.Lookup, prompt string, tmpl prompts.Template, opts []providers.GenerateOption, isEphemeral bool) (response *providers.Response, owner, shared bool, err error) {
+	if lookup.Hit() {
+		return lookup.Response, false, false, nil
+	}
+
+	// Ephemeral requests delete their conversation, so they only share with each other
+	key := cache.Key(prompt, opts)
+	if isEphemeral {
+		key += ":ephemeral"
+	}
+	response, owner, shared, err = flights.Do(ctx, key, func(ctx context.Context) (*providers.Response, error) {
+		response, err := client.GenerateContent(ctx, prompt, opts...)
+		if err != nil || tmpl == nil {
+			return response, err
+		}
+		return prompts.Clean(tmpl, response), nil
+	})
+	if err == nil {
+		lookup.Store(response)
+	}
+	return response, owner, shared, err
+}
+
+// requestPriority picks the queue priority of a generation request. The API key's class is the
+// highest priority the request may use, the X-Priority header can only lower it, and Deep
+// Research always queues as research.
+func requestPriority(c *fiber.Ctx, cfg *config.Config, route routing.Route) queue.Priority {
+	priority := queue.PriorityInteractive
+	if key := extractAPIKey(c); key != "" {
+		switch {
+		case slices.Contains(cfg.Queue.ResearchAPIKeys, key):
+			priority = queue.PriorityResearch
+		case slices.Contains(cfg.Queue.BatchAPIKeys, key):
+			priority = queue.PriorityBatch
+		}
+	}
+	if requested, ok := queue.ParsePriority(c.Get(HeaderPriority)); ok && requested > priority {
+		priority = requested
+	}
+	if route.DeepResearch {
+		priority = queue.PriorityResearch
+	}
+	return priority
+}
+
+// requestContext is the request context of the HTTP server (*fasthttp.RequestCtx). Stream
+// writers must capture it before the handler returns: the fiber.Ctx is recycled by then.
+type requestContext interface {
+	context.Context
+	Conn() net.Conn
+}
+
+// generationContext bounds a generation request by the configured timeout and the client
+// connection, and tags it with its queue priority
+func generationContext(reqCtx requestContext, cfg *config.Config, priority queue.Priority) (context.Context, context.CancelFunc) {
+	ctx, cancelTimeout := context.WithTimeout(reqCtx, requestTimeout(cfg))
+	ctx, cancelWatch := withDisconnect(ctx, reqCtx.Conn())
+	return queue.WithPriority(ctx, priority), func() {
+		cancelWatch()
+		cancelTimeout()
+	}
+}
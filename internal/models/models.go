@@ -1,9 +1,18 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+
+	"gemini-web-to-api/internal/providers"
+)
+
 // Message represents a chat message (shared across OpenAI, Claude, etc)
 type Message struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role             string       `json:"role"`
+	Content          string       `json:"content"`
+	ReasoningContent string       `json:"reasoning_content,omitempty"` // OpenAI: the model's thinking, when requested
+	Annotations      []Annotation `json:"annotations,omitempty"`       // OpenAI: sources cited by the content
 }
 
 // ModelListResponse represents the list of models
@@ -25,10 +34,15 @@ type ModelData struct {
 
 // Delta represents the delta content in a chunk
 type Delta struct {
-	Type    string `json:"type,omitempty"`    // "text_delta"
-	Content string `json:"content,omitempty"` // for OpenAI
-	Text    string `json:"text,omitempty"`    // for Claude
-	Role    string `json:"role,omitempty"`
+	Type             string `json:"type,omitempty"`              // "text_delta" or "thinking_delta"
+	Content          string `json:"content,omitempty"`           // for OpenAI
+	ReasoningContent string `json:"reasoning_content,omitempty"` // for OpenAI, thinking
+	Text             string `json:"text,omitempty"`              // for Claude
+	Thinking         string `json:"thinking,omitempty"`          // for Claude, thinking_delta
+	Role             string `json:"role,omitempty"`
+
+	Annotations []Annotation    `json:"annotations,omitempty"` // for OpenAI, with the last chunk
+	Citation    *ClaudeCitation `json:"citation,omitempty"`    // for Claude, citations_delta
 }
 
 // Usage represents token usage (compatible format)
@@ -63,6 +77,22 @@ type ChatCompletionRequest struct {
 	Stream      bool      `json:"stream,omitempty"`
 	Temperature float32   `json:"temperature,omitempty"`
 	MaxTokens   int       `json:"max_tokens,omitempty"`
+	// IncludeReasoning returns the thinking of thinking models as reasoning_content
+	IncludeReasoning bool `json:"include_reasoning,omitempty"`
+}
+
+// Annotation is an OpenAI message annotation; only url_citation is produced
+type Annotation struct {
+	Type        string      `json:"type"` // "url_citation"
+	URLCitation URLCitation `json:"url_citation"`
+}
+
+// URLCitation is a web source cited by a span of the content, in character offsets
+type URLCitation struct {
+	StartIndex int    `json:"start_index"`
+	EndIndex   int    `json:"end_index"`
+	URL        string `json:"url"`
+	Title      string `json:"title"`
 }
 
 // ChatCompletionResponse represents OpenAI chat completion response
@@ -102,11 +132,24 @@ type ChunkChoice struct {
 
 // MessageRequest represents the specialized Claude request body
 type MessageRequest struct {
-	Model     string    `json:"model"`
-	MaxTokens int       `json:"max_tokens"`
-	Messages  []Message `json:"messages"`
-	System    string    `json:"system,omitempty"`
-	Stream    bool      `json:"stream,omitempty"`
+	Model       string         `json:"model"`
+	MaxTokens   int            `json:"max_tokens"`
+	Messages    []Message      `json:"messages"`
+	System      string         `json:"system,omitempty"`
+	Stream      bool           `json:"stream,omitempty"`
+	Temperature float32        `json:"temperature,omitempty"`
+	Thinking    *ThinkingParam `json:"thinking,omitempty"`
+}
+
+// ThinkingParam enables thinking content blocks in a Claude response
+type ThinkingParam struct {
+	Type         string `json:"type"` // "enabled" or "disabled"
+	BudgetTokens int    `json:"budget_tokens,omitempty"`
+}
+
+// Enabled reports whether the request asked for thinking blocks
+func (p *ThinkingParam) Enabled() bool {
+	return p != nil && p.Type == "enabled"
 }
 
 // MessageResponse represents the non-streaming response body
@@ -122,8 +165,33 @@ type MessageResponse struct {
 
 // ConfigContent represents the content block in a response
 type ConfigContent struct {
-	Type string `json:"type"` // "text"
-	Text string `json:"text"`
+	Type      string           `json:"type"` // "text" or "thinking"
+	Text      string           `json:"text"`
+	Citations []ClaudeCitation `json:"citations,omitempty"` // sources of a text block
+	Thinking  string           `json:"-"`
+	Signature string           `json:"-"`
+}
+
+// ClaudeCitation is a web search result cited by a text block
+type ClaudeCitation struct {
+	Type           string `json:"type"` // "web_search_result_location"
+	URL            string `json:"url"`
+	Title          string `json:"title"`
+	CitedText      string `json:"cited_text"`
+	EncryptedIndex string `json:"encrypted_index"`
+}
+
+// MarshalJSON writes thinking blocks with their own fields instead of text
+func (c ConfigContent) MarshalJSON() ([]byte, error) {
+	if c.Type == "thinking" {
+		return json.Marshal(struct {
+			Type      string `json:"type"`
+			Thinking  string `json:"thinking"`
+			Signature string `json:"signature"`
+		}{c.Type, c.Thinking, c.Signature})
+	}
+	type content ConfigContent
+	return json.Marshal(content(c))
 }
 
 // StreamEvent represents a streaming event
@@ -150,6 +218,7 @@ type GeminiModel struct {
 	DisplayName                string   `json:"displayName"`
 	Description                string   `json:"description,omitempty"`
 	Version                    string   `json:"version,omitempty"`
+	InputTokenLimit            int      `json:"inputTokenLimit,omitempty"`
 	SupportedGenerationMethods []string `json:"supportedGenerationMethods"`
 }
 
@@ -168,8 +237,12 @@ type Content struct {
 
 // Part represents a part of content
 type Part struct {
-	Text       string      `json:"text,omitempty"`
-	InlineData *InlineData `json:"inlineData,omitempty"`
+	Text                string               `json:"text,omitempty"`
+	Thought             bool                 `json:"thought,omitempty"` // the text is the model's thinking
+	InlineData          *InlineData          `json:"inlineData,omitempty"`
+	FileData            *FileData            `json:"fileData,omitempty"`
+	ExecutableCode      *ExecutableCode      `json:"executableCode,omitempty"`
+	CodeExecutionResult *CodeExecutionResult `json:"codeExecutionResult,omitempty"`
 }
 
 // InlineData represents inline data (e.g., images)
@@ -178,18 +251,57 @@ type InlineData struct {
 	Data     string `json:"data"`
 }
 
+// FileData references content by URI, such as an image the model generated or found
+type FileData struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+// ExecutableCode is code the model ran
+type ExecutableCode struct {
+	Language string `json:"language"` // PYTHON or LANGUAGE_UNSPECIFIED
+	Code     string `json:"code"`
+}
+
+// CodeExecutionResult is the output of running the preceding ExecutableCode
+type CodeExecutionResult struct {
+	Outcome string `json:"outcome"` // OUTCOME_OK or OUTCOME_FAILED
+	Output  string `json:"output,omitempty"`
+}
+
 // GenerationConfig represents generation configuration
 type GenerationConfig struct {
-	Temperature     float32 `json:"temperature,omitempty"`
-	TopP            float32 `json:"topP,omitempty"`
-	TopK            int32   `json:"topK,omitempty"`
-	MaxOutputTokens int32   `json:"maxOutputTokens,omitempty"`
+	Temperature     float32         `json:"temperature,omitempty"`
+	TopP            float32         `json:"topP,omitempty"`
+	TopK            int32           `json:"topK,omitempty"`
+	MaxOutputTokens int32           `json:"maxOutputTokens,omitempty"`
+	ThinkingConfig  *ThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+// ThinkingConfig controls whether thought parts are returned
+type ThinkingConfig struct {
+	IncludeThoughts bool   `json:"includeThoughts,omitempty"`
+	ThinkingBudget  *int32 `json:"thinkingBudget,omitempty"`
+}
+
+// GetTemperature returns the requested temperature, 0 when none was given
+func (c *GenerationConfig) GetTemperature() float32 {
+	if c == nil {
+		return 0
+	}
+	return c.Temperature
+}
+
+// IncludeThoughts reports whether the request asked for thought parts
+func (c *GenerationConfig) IncludeThoughts() bool {
+	return c != nil && c.ThinkingConfig != nil && c.ThinkingConfig.IncludeThoughts
 }
 
 // GeminiGenerateResponse represents a Gemini generate response
 type GeminiGenerateResponse struct {
 	Candidates   []Candidate    `json:"candidates"`
 	UsageMetadata *UsageMetadata `json:"usageMetadata,omitempty"`
+	ModelVersion string         `json:"modelVersion,omitempty"`
 }
 
 // Candidate represents a candidate response
@@ -198,6 +310,37 @@ type Candidate struct {
 	Content      Content `json:"content"`
 	FinishReason string `json:"finishReason,omitempty"`
 	FinishMessage string `json:"finishMessage,omitempty"`
+	GroundingMetadata *GroundingMetadata `json:"groundingMetadata,omitempty"`
+}
+
+// GroundingMetadata lists the web sources of an answer and the segments they support
+type GroundingMetadata struct {
+	GroundingChunks   []GroundingChunk   `json:"groundingChunks,omitempty"`
+	GroundingSupports []GroundingSupport `json:"groundingSupports,omitempty"`
+}
+
+// GroundingChunk is a web source
+type GroundingChunk struct {
+	Web *WebChunk `json:"web,omitempty"`
+}
+
+type WebChunk struct {
+	URI   string `json:"uri"`
+	Title string `json:"title,omitempty"`
+}
+
+// GroundingSupport ties a segment of the answer to the chunks that support it
+type GroundingSupport struct {
+	Segment               Segment `json:"segment"`
+	GroundingChunkIndices []int   `json:"groundingChunkIndices"`
+}
+
+// Segment is a span of a part's text, in byte offsets
+type Segment struct {
+	PartIndex  int    `json:"partIndex,omitempty"`
+	StartIndex int    `json:"startIndex,omitempty"`
+	EndIndex   int    `json:"endIndex"`
+	Text       string `json:"text,omitempty"`
 }
 
 // UsageMetadata represents usage metadata
@@ -207,6 +350,88 @@ type UsageMetadata struct {
 	TotalTokenCount      int32 `json:"totalTokenCount"`
 }
 
+// ============= Conversation Management =============
+
+// ConversationListResponse represents the list of conversations in the account history
+type ConversationListResponse struct {
+	Conversations []providers.Conversation `json:"conversations"`
+}
+
+// ConversationResponse represents a single conversation with its turns
+type ConversationResponse struct {
+	ID    string                       `json:"id"`
+	Turns []providers.ConversationTurn `json:"turns"`
+}
+
+// ConversationUpdateRequest renames and/or pins a conversation
+type ConversationUpdateRequest struct {
+	Title  *string `json:"title,omitempty"`
+	Pinned *bool   `json:"pinned,omitempty"`
+}
+
+// ============= Admin =============
+
+// AdminStatusResponse lists the session state of each account
+type AdminStatusResponse struct {
+	Accounts []AdminAccountStatus `json:"accounts"`
+}
+
+// AdminAccountStatus describes the session of an account
+type AdminAccountStatus struct {
+	Account          string               `json:"account,omitempty"`
+	Healthy          bool                 `json:"healthy"`
+	UnhealthyReason  string               `json:"unhealthy_reason,omitempty"`
+	CookiesUpdatedAt time.Time            `json:"cookies_updated_at"`
+	CookieAgeSeconds int64                `json:"cookie_age_seconds"`
+	HasPSIDTS        bool                 `json:"has_1psidts"`
+	HasPSIDCC        bool                 `json:"has_1psidcc"`
+	SessionToken     bool                 `json:"session_token"` // whether an SNlM0e token is held
+	SessionTokenAt   *time.Time           `json:"session_token_fetched_at,omitempty"`
+	LastRotation     *AdminRotationResult `json:"last_rotation,omitempty"`
+	ActiveRequests   int                  `json:"active_requests"`
+	QueuedRequests   int                  `json:"queued_requests"`
+	QueuedByPriority map[string]int       `json:"queued_by_priority"`
+	Parser           AdminParserStatus    `json:"parser"`
+}
+
+// AdminRotationResult is the outcome of the last cookie rotation
+type AdminRotationResult struct {
+	At    time.Time `json:"at"`
+	OK    bool      `json:"ok"`
+	Error string    `json:"error,omitempty"`
+}
+
+// AdminParserStatus counts responses by the layout strategy that parsed them
+type AdminParserStatus struct {
+	Strategies map[string]int    `json:"strategies"`
+	Fallbacks  int               `json:"fallbacks"` // parsed by a strategy other than the first
+	Failures   int               `json:"failures"`  // parsed by none
+	LastDrift  *AdminDriftReport `json:"last_drift,omitempty"`
+}
+
+// AdminDriftReport describes the last response whose layout the primary strategy did not recognize
+type AdminDriftReport struct {
+	At        time.Time `json:"at"`
+	Strategy  string    `json:"strategy,omitempty"` // the fallback that parsed it, empty if none did
+	Layouts   []string  `json:"layouts"`            // skeleton of each wrb.fr payload
+	TextPaths []string  `json:"text_paths"`         // where the longest strings are, likely the answer
+}
+
+// AdminCookiesRequest replaces the session cookies of the running client.
+// An empty __Secure-1PSID keeps the current one; an empty __Secure-1PSIDTS is obtained by rotation.
+type AdminCookiesRequest struct {
+	Secure1PSID   string `json:"__Secure-1PSID"`
+	Secure1PSIDTS string `json:"__Secure-1PSIDTS"`
+	Secure1PSIDCC string `json:"__Secure-1PSIDCC,omitempty"`
+}
+
+// AdminCookieImportResponse summarizes an imported cookie set without exposing values
+type AdminCookieImportResponse struct {
+	Format  string             `json:"format"`
+	Cookies []string           `json:"cookies"` // names of the google.com cookies applied
+	Status  AdminAccountStatus `json:"status"`
+}
+
 // ============= Request/Response Common Types =============
 
 // EmbeddingsRequest represents a request for embeddings
@@ -0,0 +1,217 @@
+package prompts
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gemini-web-to-api/internal/models"
+	"gemini-web-to-api/internal/providers"
+)
+
+// Template renders a conversation as the single prompt the web app takes, and finds the
+// reply in what the model answered
+type Template interface {
+	// Build renders the messages, after the route's default system prompt if any
+	Build(messages []models.Message, systemPrompt string) string
+	// Reply returns where the reply is in text, without the labels of the template the
+	// model echoed around it
+	Reply(text string) (start, end int)
+}
+
+// Names of the built-in templates
+const (
+	Transcript  = "transcript"  // "User: ..." lines, one per message
+	XML         = "xml"         // messages in role tags, then the instruction to reply
+	Instruction = "instruction" // system instructions first, then the history, then the request
+)
+
+// DefaultTemplate is used when neither the route nor the config names one
+const DefaultTemplate = Transcript
+
+var templates = map[string]Template{
+	Transcript:  transcript{},
+	XML:         xmlTags{},
+	Instruction: instructionFirst{},
+}
+
+// Lookup returns a template by name; the empty name is the default template
+func Lookup(name string) (Template, bool) {
+	if name == "" {
+		name = DefaultTemplate
+	}
+	t, ok := templates[name]
+	return t, ok
+}
+
+var (
+	// labelLine matches content lines that would read as the start of another turn
+	labelLine = regexp.MustCompile(`(?im)^([ \t]*)(user|model|assistant|system|human)([ \t]*:)`)
+	// roleTag matches the tags of the XML template
+	roleTag = regexp.MustCompile(`(?i)<(/?)(system|user|model|conversation)>`)
+	// echoedLabel matches a role label the model put in front of its reply
+	echoedLabel = regexp.MustCompile(`^\s*(?i:model|assistant)[ \t]*:[ \t]*\n?`)
+)
+
+// escapeLabels keeps lines of content that start like a turn from being read as one
+func escapeLabels(content string) string {
+	return labelLine.ReplaceAllString(content, `${1}\${2}${3}`)
+}
+
+// escapeTags keeps the role tags of the XML template in content from closing or opening a turn
+func escapeTags(content string) string {
+	return roleTag.ReplaceAllString(content, "&lt;${1}${2}&gt;")
+}
+
+// label names a message's role the way the templates do
+func label(role string) string {
+	switch strings.ToLower(role) {
+	case "assistant", "model":
+		return "Model"
+	case "system":
+		return "System"
+	}
+	return "User"
+}
+
+// stripLabel skips a role label echoed at the start of text
+func stripLabel(text string) (start, end int) {
+	if m := echoedLabel.FindStringIndex(text); m != nil {
+		return m[1], len(text)
+	}
+	return 0, len(text)
+}
+
+// transcript renders the conversation as a transcript, a line per message
+type transcript struct{}
+
+func (transcript) Build(messages []models.Message, systemPrompt string) string {
+	var b strings.Builder
+	if systemPrompt != "" {
+		fmt.Fprintf(&b, "System: %s\n\n", systemPrompt)
+	}
+	for _, msg := range messages {
+		fmt.Fprintf(&b, "%s: %s\n", label(msg.Role), escapeLabels(msg.Content))
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (transcript) Reply(text string) (int, int) {
+	return stripLabel(text)
+}
+
+// xmlTags wraps each message in a tag named after its role
+type xmlTags struct{}
+
+func (xmlTags) Build(messages []models.Message, systemPrompt string) string {
+	var b strings.Builder
+	if systemPrompt != "" {
+		fmt.Fprintf(&b, "<system>\n%s\n</system>\n", systemPrompt)
+	}
+	b.WriteString("<conversation>\n")
+	for _, msg := range messages {
+		tag := strings.ToLower(label(msg.Role))
+		fmt.Fprintf(&b, "<%s>\n%s\n</%s>\n", tag, escapeTags(msg.Content), tag)
+	}
+	b.WriteString("</conversation>\n\n")
+	b.WriteString("Write the model's reply to the last user message. Answer with the text of the reply only, without tags.")
+	return b.String()
+}
+
+func (xmlTags) Reply(text string) (int, int) {
+	start, end := 0, len(text)
+	trimmed := strings.TrimLeft(text, " \t\r\n")
+	if strings.HasPrefix(strings.ToLower(trimmed), "<model>") {
+		start = len(text) - len(trimmed) + len("<model>")
+		start += len(text[start:]) - len(strings.TrimLeft(text[start:], " \t\r\n"))
+	}
+	rest := strings.TrimRight(text[start:], " \t\r\n")
+	if strings.HasSuffix(strings.ToLower(rest), "</model>") {
+		end = start + len(strings.TrimRight(rest[:len(rest)-len("</model>")], " \t\r\n"))
+	}
+	s, _ := stripLabel(text[start:end])
+	return start + s, end
+}
+
+// instructionFirst leads with the system instructions, then gives the earlier turns as
+// context and the last message as the request to answer
+type instructionFirst struct{}
+
+func (instructionFirst) Build(messages []models.Message, systemPrompt string) string {
+	var instructions []string
+	if systemPrompt != "" {
+		instructions = append(instructions, systemPrompt)
+	}
+	var history []models.Message
+	for _, msg := range messages {
+		if strings.EqualFold(msg.Role, "system") {
+			instructions = append(instructions, escapeLabels(msg.Content))
+		} else {
+			history = append(history, msg)
+		}
+	}
+	if len(history) == 0 {
+		return strings.TrimSpace(strings.Join(instructions, "\n\n"))
+	}
+	last := history[len(history)-1]
+
+	// A single question needs no framing
+	if len(instructions) == 0 && len(history) == 1 {
+		return strings.TrimSpace(last.Content)
+	}
+
+	var b strings.Builder
+	if len(instructions) > 0 {
+		fmt.Fprintf(&b, "Instructions:\n%s\n\n", strings.Join(instructions, "\n\n"))
+	}
+	if len(history) > 1 {
+		b.WriteString("Conversation so far:\n")
+		for _, msg := range history[:len(history)-1] {
+			fmt.Fprintf(&b, "%s: %s\n", label(msg.Role), escapeLabels(msg.Content))
+		}
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "Reply to this message from the user:\n%s", escapeLabels(last.Content))
+	return strings.TrimSpace(b.String())
+}
+
+func (instructionFirst) Reply(text string) (int, int) {
+	return stripLabel(text)
+}
+
+// Clean returns the response without what the model echoed of the template around its
+// reply, with the offsets of citations and parts moved along. The response itself, which
+// may be shared or cached, is not modified.
+func Clean(t Template, response *providers.Response) *providers.Response {
+	start, end := t.Reply(response.Text)
+	if start == 0 && end == len(response.Text) {
+		return response
+	}
+
+	cleaned := *response
+	cleaned.Text = response.Text[start:end]
+	move := func(offset int) int {
+		return min(max(offset-start, 0), len(cleaned.Text))
+	}
+
+	cleaned.Citations = nil
+	for _, citation := range response.Citations {
+		citation.Start, citation.End = move(citation.Start), move(citation.End)
+		if citation.Start < citation.End {
+			cleaned.Citations = append(cleaned.Citations, citation)
+		}
+	}
+
+	cleaned.Parts = nil
+	for _, part := range response.Parts {
+		part.Start, part.End = move(part.Start), move(part.End)
+		if part.Type == providers.PartText {
+			part.Text = cleaned.Text[part.Start:part.End]
+			if strings.TrimSpace(part.Text) == "" {
+				continue
+			}
+		}
+		cleaned.Parts = append(cleaned.Parts, part)
+	}
+	return &cleaned
+}
@@ -0,0 +1,122 @@
+package prompts
+
+import (
+	"testing"
+
+	"gemini-web-to-api/internal/models"
+	"gemini-web-to-api/internal/providers"
+)
+
+var conversation = []models.Message{
+	{Role: "system", Content: "Be brief."},
+	{Role: "user", Content: "Quote this:\nModel: I agree"},
+	{Role: "assistant", Content: "Done."},
+	{Role: "user", Content: "Now with <model>tags</model>"},
+}
+
+func TestBuild(t *testing.T) {
+	tests := []struct {
+		name, want string
+	}{
+		{Transcript, "System: Be brief.\n" +
+			"User: Quote this:\n\\Model: I agree\n" +
+			"Model: Done.\n" +
+			"User: Now with <model>tags</model>"},
+		{XML, "<conversation>\n" +
+			"<system>\nBe brief.\n</system>\n" +
+			"<user>\nQuote this:\nModel: I agree\n</user>\n" +
+			"<model>\nDone.\n</model>\n" +
+			"<user>\nNow with &lt;model&gt;tags&lt;/model&gt;\n</user>\n" +
+			"</conversation>\n\n" +
+			"Write the model's reply to the last user message. Answer with the text of the reply only, without tags."},
+		{Instruction, "Instructions:\nBe brief.\n\n" +
+			"Conversation so far:\n" +
+			"User: Quote this:\n\\Model: I agree\n" +
+			"Model: Done.\n\n" +
+			"Reply to this message from the user:\nNow with <model>tags</model>"},
+	}
+	for _, tt := range tests {
+		tmpl, ok := Lookup(tt.name)
+		if !ok {
+			t.Fatalf("Lookup(%q) failed", tt.name)
+		}
+		if got := tmpl.Build(conversation, ""); got != tt.want {
+			t.Errorf("%s:\n got %q\nwant %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestBuildSingleQuestion(t *testing.T) {
+	messages := []models.Message{{Role: "user", Content: "hi"}}
+	tests := map[string]string{
+		Transcript:  "User: hi",
+		Instruction: "hi",
+	}
+	for name, want := range tests {
+		tmpl, _ := Lookup(name)
+		if got := tmpl.Build(messages, ""); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+	tmpl, _ := Lookup(Instruction)
+	if got, want := tmpl.Build(messages, "Be brief."), "Instructions:\nBe brief.\n\nReply to this message from the user:\nhi"; got != want {
+		t.Errorf("instruction with system prompt: got %q, want %q", got, want)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	if tmpl, ok := Lookup(""); !ok || tmpl != (transcript{}) {
+		t.Errorf("Lookup(\"\") = %v, %v; want the transcript template", tmpl, ok)
+	}
+	if _, ok := Lookup("chatml"); ok {
+		t.Error("Lookup of an unknown template succeeded")
+	}
+}
+
+func TestReply(t *testing.T) {
+	tests := []struct {
+		template, text, want string
+	}{
+		{Transcript, "Model: Hello", "Hello"},
+		{Transcript, "  assistant:\nHello", "Hello"},
+		{Transcript, "Hello\nModel: again", "Hello\nModel: again"},
+		{XML, "<model>\nHello\n</model>\n", "Hello"},
+		{XML, "<model>Model: Hello</model>", "Hello"},
+		{XML, "Hello", "Hello"},
+		{Instruction, "Model: Hello", "Hello"},
+	}
+	for _, tt := range tests {
+		tmpl, _ := Lookup(tt.template)
+		start, end := tmpl.Reply(tt.text)
+		if got := tt.text[start:end]; got != tt.want {
+			t.Errorf("%s Reply(%q) = %q, want %q", tt.template, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestCleanMovesOffsets(t *testing.T) {
+	text := "Model: Go is fast. Gophers agree.\n![gopher](https://example.com/g.png)\n"
+	response := &providers.Response{
+		Text:      text,
+		Citations: []providers.Citation{{Start: 7, End: 18, References: []int{0}}, {Start: 0, End: 6}},
+		Parts: []providers.Part{
+			{Type: providers.PartText, Text: text[:34], Start: 0, End: 34},
+			{Type: providers.PartImage, Image: &providers.Image{URL: "https://example.com/g.png"}, Start: 34, End: len(text)},
+		},
+	}
+	tmpl, _ := Lookup(Transcript)
+	cleaned := Clean(tmpl, response)
+
+	if cleaned.Text != text[7:] {
+		t.Fatalf("text = %q", cleaned.Text)
+	}
+	if response.Text != text {
+		t.Error("Clean modified the original response")
+	}
+	if len(cleaned.Citations) != 1 || cleaned.Text[cleaned.Citations[0].Start:cleaned.Citations[0].End] != "Go is fast." {
+		t.Errorf("citations = %+v", cleaned.Citations)
+	}
+	if len(cleaned.Parts) != 2 || cleaned.Parts[0].Text != "Go is fast. Gophers agree.\n" || cleaned.Parts[1].Start != 27 {
+		t.Errorf("parts = %+v", cleaned.Parts)
+	}
+}
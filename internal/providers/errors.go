@@ -0,0 +1,70 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrorKind classifies a provider failure independently of the API flavor it is reported in
+type ErrorKind string
+
+const (
+	ErrUnauthenticated     ErrorKind = "unauthenticated"      // the provider session is no longer accepted
+	ErrRateLimited         ErrorKind = "rate_limited"         // usage limit reached, retry later
+	ErrContentBlocked      ErrorKind = "content_blocked"      // the prompt or answer was refused
+	ErrModelUnavailable    ErrorKind = "model_unavailable"    // unknown model, or not available to the account
+	ErrUpstreamUnavailable ErrorKind = "upstream_unavailable" // unreachable, blocked or unexpected answer
+	ErrTimeout             ErrorKind = "timeout"
+	ErrInvalidRequest      ErrorKind = "invalid_request"
+	ErrContextExceeded     ErrorKind = "context_length_exceeded" // the prompt does not fit the model's context window
+)
+
+// Error is a classified provider failure. Message is safe to show to API clients;
+// the wrapped error keeps the upstream details for logging.
+type Error struct {
+	Kind       ErrorKind
+	Message    string
+	RetryAfter time.Duration // hint for rate limits, zero when unknown
+	Err        error
+}
+
+func NewError(kind ErrorKind, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Retryable reports whether sending the same request again may succeed
+func (e *Error) Retryable() bool {
+	switch e.Kind {
+	case ErrRateLimited, ErrUpstreamUnavailable, ErrTimeout, ErrUnauthenticated:
+		return true
+	}
+	return false
+}
+
+// AsError returns the classified error in err's chain. Context errors become timeouts;
+// anything else is reported as the upstream being unavailable, without its details.
+func AsError(err error) *Error {
+	var providerErr *Error
+	if errors.As(err, &providerErr) {
+		return providerErr
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return NewError(ErrTimeout, "the request timed out", err)
+	}
+	if errors.Is(err, context.Canceled) {
+		return NewError(ErrTimeout, "the request was cancelled", err)
+	}
+	return NewError(ErrUpstreamUnavailable, "the upstream request failed", err)
+}
@@ -0,0 +1,181 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/cookieimport"
+
+	"go.uber.org/zap"
+)
+
+// RotationResult is the outcome of the last __Secure-1PSIDTS rotation
+type RotationResult struct {
+	At    time.Time `json:"at"`
+	OK    bool      `json:"ok"`
+	Error string    `json:"error,omitempty"`
+}
+
+// AccountStatus describes the session of the account the client is logged into
+type AccountStatus struct {
+	Account          string          `json:"account,omitempty"`
+	Healthy          bool            `json:"healthy"`
+	UnhealthyReason  string          `json:"unhealthy_reason,omitempty"`
+	CookiesUpdatedAt time.Time       `json:"cookies_updated_at"`
+	CookieAgeSeconds int64           `json:"cookie_age_seconds"`
+	HasPSIDTS        bool            `json:"has_1psidts"`
+	HasPSIDCC        bool            `json:"has_1psidcc"`
+	SessionToken     bool            `json:"session_token"` // whether an SNlM0e token is held
+	SessionTokenAt   *time.Time      `json:"session_token_fetched_at,omitempty"`
+	LastRotation     *RotationResult `json:"last_rotation,omitempty"`
+	ActiveRequests   int             `json:"active_requests"`
+	QueuedRequests   int             `json:"queued_requests"`
+	QueuedByPriority map[string]int  `json:"queued_by_priority"`
+	Parser           ParserStatus    `json:"parser"`
+}
+
+// Status reports cookie age, the last rotation and the session token state
+func (c *Client) Status() AccountStatus {
+	c.cookies.mu.RLock()
+	status := AccountStatus{
+		CookiesUpdatedAt: c.cookies.UpdatedAt,
+		CookieAgeSeconds: int64(time.Since(c.cookies.UpdatedAt).Seconds()),
+		HasPSIDTS:        c.cookies.Secure1PSIDTS != "",
+		HasPSIDCC:        c.cookies.Secure1PSIDCC != "",
+	}
+	c.cookies.mu.RUnlock()
+	status.ActiveRequests, status.QueuedRequests = c.limiter.Load()
+	status.QueuedByPriority = c.limiter.QueuedByPriority()
+	status.Parser = c.parser.status()
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	status.Account = c.account
+	status.Healthy = c.healthy
+	status.UnhealthyReason = c.unhealthyReason
+	status.SessionToken = c.at != ""
+	if !c.tokenAt.IsZero() {
+		tokenAt := c.tokenAt
+		status.SessionTokenAt = &tokenAt
+	}
+	if c.lastRotation != nil {
+		rotation := *c.lastRotation
+		status.LastRotation = &rotation
+	}
+	return status
+}
+
+// Reinit fetches a new session token with the current cookies, rotating them first if needed
+func (c *Client) Reinit(ctx context.Context) error {
+	if err := c.reauth(); err != nil {
+		return err
+	}
+
+	if _, err := c.ListGems(ctx); err != nil {
+		c.log.Warn("Failed to fetch Gems after re-init", zap.Error(err))
+	}
+	c.log.Info("Gemini client re-initialized")
+	return nil
+}
+
+// accountSource is the part of the config that identifies the account's cookies
+type accountSource struct {
+	PSID        string
+	PSIDTS      string
+	PSIDCC      string
+	Cookies     string
+	CookiesFile string
+}
+
+func accountSourceOf(cfg *config.Config) accountSource {
+	return accountSource{
+		PSID:        cleanCookie(cfg.Gemini.Secure1PSID),
+		PSIDTS:      cleanCookie(cfg.Gemini.Secure1PSIDTS),
+		PSIDCC:      cleanCookie(cfg.Gemini.Secure1PSIDCC),
+		Cookies:     cfg.Gemini.Cookies,
+		CookiesFile: cfg.Gemini.CookiesFile,
+	}
+}
+
+// sessionCookies is a full cookie set for one account
+type sessionCookies struct {
+	PSID   string
+	PSIDTS string
+	PSIDCC string
+	Extra  map[string]string // other google.com cookies, by name
+}
+
+// resolve reads the imported cookies; explicitly configured values take precedence
+func (s accountSource) resolve() (sessionCookies, error) {
+	var imported []*http.Cookie
+	if s.CookiesFile != "" {
+		cookies, _, err := cookieimport.ReadFile(s.CookiesFile)
+		if err != nil {
+			return sessionCookies{}, err
+		}
+		imported = append(imported, cookies...)
+	}
+	if s.Cookies != "" {
+		cookies, _, err := cookieimport.Parse([]byte(s.Cookies))
+		if err != nil {
+			return sessionCookies{}, fmt.Errorf("invalid GEMINI_COOKIES: %w", err)
+		}
+		imported = append(imported, cookies...)
+	}
+
+	session := splitSessionCookies(cookieimport.Google(imported))
+	if s.PSID != "" {
+		session.PSID = s.PSID
+	}
+	if s.PSIDTS != "" {
+		session.PSIDTS = s.PSIDTS
+	}
+	if s.PSIDCC != "" {
+		session.PSIDCC = s.PSIDCC
+	}
+	return session, nil
+}
+
+// splitSessionCookies separates the session cookies the client tracks from the rest
+func splitSessionCookies(cookies []*http.Cookie) sessionCookies {
+	session := sessionCookies{Extra: make(map[string]string)}
+	for _, cookie := range cookies {
+		value := cleanCookie(cookie.Value)
+		switch cookie.Name {
+		case "__Secure-1PSID":
+			session.PSID = value
+		case "__Secure-1PSIDTS":
+			session.PSIDTS = value
+		case "__Secure-1PSIDCC":
+			session.PSIDCC = value
+		default:
+			session.Extra[cookie.Name] = value
+		}
+	}
+	return session
+}
+
+// restoreCachedCookies takes the rotated cookies of the same __Secure-1PSID from the cache.
+// Configured extra cookies are kept where the cache has none.
+func (c *Client) restoreCachedCookies(cached *CachedCookies) {
+	if c.cookies.Extra == nil {
+		c.cookies.Extra = make(map[string]string)
+	}
+	for name, value := range cached.Cookies {
+		switch name {
+		case "__Secure-1PSID":
+		case "__Secure-1PSIDTS":
+			c.cookies.Secure1PSIDTS = value
+		case "__Secure-1PSIDCC":
+			c.cookies.Secure1PSIDCC = value
+		default:
+			c.cookies.Extra[name] = value
+		}
+	}
+	if !cached.RotatedAt.IsZero() {
+		c.cookies.UpdatedAt = cached.RotatedAt
+	}
+}
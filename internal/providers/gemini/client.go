@@ -9,16 +9,20 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"net/http"
+	"net/url"
 	"os"
-	"path/filepath"
 	"regexp"
 	"strings"
 	"sync"
 	"time"
 
 	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/cookieimport"
 	"gemini-web-to-api/internal/providers"
+	"gemini-web-to-api/internal/providers/gemini/recording"
+	"gemini-web-to-api/internal/queue"
 
 	"github.com/google/uuid"
 	"github.com/imroc/req/v3"
@@ -36,24 +40,55 @@ type Client struct {
 	autoRefresh     bool
 	refreshInterval time.Duration
 	stopRefresh     chan struct{}
-	maxRetries      int
-
-	reqMu sync.Mutex
+	retry           RetryPolicy
+	budget          *retryBudget
+	modelsRefresh   time.Duration
+	tokenRefresh    time.Duration
+
+	endpoints    Endpoints
+	cookieURL    *url.URL // where the session cookies are kept in the HTTP client's jar
+	cookieDomain string   // domain host-only cookies are widened to, empty to keep them host-only
+
+	parser    parserStats         // responses by layout strategy, and the last layout drift
+	recorder  *recording.Recorder // saves upstream exchanges as fixtures, nil when recording is off
+	limiter   *queue.Limiter // bounds the requests sent to the account at once
+	sessionMu sync.RWMutex   // shared by requests, exclusive while the account's cookies are replaced
+	authMu    sync.Mutex     // serializes re-authentication and cookie rotation
+	gems   gemCache
+	models *providers.ModelRegistry
+
+	account      string        // label of the account, from config
+	source       accountSource // the account's cookies as last read from config
+	cache        CookieCache
+	tokenAt         time.Time // when the SNlM0e token was last fetched
+	lastRotation    *RotationResult
+	unhealthyReason string
 }
 
 type CookieStore struct {
 	Secure1PSID   string    `json:"__Secure-1PSID"`
 	Secure1PSIDTS string    `json:"__Secure-1PSIDTS"`
 	Secure1PSIDCC string    `json:"__Secure-1PSIDCC"`
+	Extra         map[string]string `json:"extra,omitempty"` // other imported google.com cookies
 	UpdatedAt     time.Time `json:"updated_at"`
 	mu            sync.RWMutex
 }
 
 const (
-	defaultRefreshIntervalMinutes = 30
+	defaultRefreshIntervalMinutes       = 30
+	defaultModelsRefreshIntervalMinutes = 60
+	defaultTokenRefreshIntervalMinutes  = 15
 )
 
-func NewClient(cfg *config.Config, log *zap.Logger) *Client {
+// bootstrapData finds where the app page assigns its bootstrap data object
+var bootstrapData = regexp.MustCompile(`window\.WIZ_global_data\s*=\s*`)
+
+func NewClient(cfg *config.Config, log *zap.Logger) (*Client, error) {
+	cache, err := NewCookieCache(cfg.CookieCache, log)
+	if err != nil {
+		return nil, err
+	}
+
 	cookies := &CookieStore{
 		Secure1PSID:   cfg.Gemini.Secure1PSID,
 		Secure1PSIDTS: cfg.Gemini.Secure1PSIDTS,
@@ -70,23 +105,95 @@ func NewClient(cfg *config.Config, log *zap.Logger) *Client {
 		refreshIntervalMinutes = defaultRefreshIntervalMinutes
 	}
 
-	maxRetries := cfg.Gemini.MaxRetries
-	if maxRetries < 0 {
-		maxRetries = 0
+	modelsRefreshMinutes := cfg.Gemini.ModelsRefresh
+	if modelsRefreshMinutes <= 0 {
+		modelsRefreshMinutes = defaultModelsRefreshIntervalMinutes
+	}
+
+	tokenRefreshMinutes := cfg.Gemini.TokenRefresh
+	if tokenRefreshMinutes <= 0 {
+		tokenRefreshMinutes = defaultTokenRefreshIntervalMinutes
 	}
 
-	return &Client{
+	endpoints := DefaultEndpoints
+	if cfg.Gemini.BaseURL != "" {
+		endpoints = EndpointsAt(cfg.Gemini.BaseURL)
+		log.Warn("Sending Gemini requests to a custom base URL", zap.String("base_url", cfg.Gemini.BaseURL))
+	}
+	cookieURL, cookieDomain := endpoints.cookieScope()
+
+	limiter := queue.NewLimiter(cfg.Gemini.Concurrency, cfg.Gemini.MaxQueue, queueTimeoutOf(cfg))
+	limiter.SetWeights(queueWeightsOf(cfg))
+
+	c := &Client{
 		httpClient:      client,
 		cookies:         cookies,
 		autoRefresh:     true,
 		refreshInterval: time.Duration(refreshIntervalMinutes) * time.Minute,
 		stopRefresh:     make(chan struct{}),
-		maxRetries:      maxRetries,
+		retry:           retryPolicyOf(cfg),
+		budget:          newRetryBudget(cfg.Gemini.RetryBudget),
+		endpoints:       endpoints,
+		cookieURL:       cookieURL,
+		cookieDomain:    cookieDomain,
+		limiter:         limiter,
+		modelsRefresh:   time.Duration(modelsRefreshMinutes) * time.Minute,
+		tokenRefresh:    time.Duration(tokenRefreshMinutes) * time.Minute,
+		models:          providers.NewModelRegistry(cfg.Gemini.ModelsFile, log),
+		account:         cfg.Gemini.Account,
+		source:          accountSourceOf(cfg),
+		cache:           cache,
 		log:             log,
 	}
+
+	c.recorder = recording.New(cfg.Gemini.RecordDir, recording.Mode(cfg.Gemini.RecordMode), c.secrets, log)
+	if c.recorder != nil {
+		httpClient := client.GetClient()
+		httpClient.Transport = c.recorder.Wrap(httpClient.Transport)
+		log.Warn("Recording upstream exchanges",
+			zap.String("mode", cfg.Gemini.RecordMode),
+			zap.String("dir", cfg.Gemini.RecordDir),
+		)
+	}
+	return c, nil
+}
+
+// secrets lists the credentials scrubbed from recordings: the session token and cookie values
+func (c *Client) secrets() []string {
+	c.mu.RLock()
+	secrets := []string{c.at}
+	c.mu.RUnlock()
+
+	c.cookies.mu.RLock()
+	defer c.cookies.mu.RUnlock()
+	secrets = append(secrets, c.cookies.Secure1PSID, c.cookies.Secure1PSIDTS, c.cookies.Secure1PSIDCC)
+	for _, value := range c.cookies.Extra {
+		secrets = append(secrets, value)
+	}
+	return secrets
+}
+
+// saveFailure records the exchange behind a response the client could not use
+func (c *Client) saveFailure(capture *recording.Capture, err error) {
+	if path := c.recorder.SaveFailure(capture); path != "" {
+		c.log.Warn("Recorded unparseable upstream response", zap.String("file", path), zap.Error(err))
+	}
 }
 
 func (c *Client) Init(ctx context.Context) error {
+	// Merge imported cookies (GEMINI_COOKIES, cookies file) with the configured ones
+	session, err := c.source.resolve()
+	if err != nil {
+		return err
+	}
+	c.cookies.Secure1PSID = session.PSID
+	c.cookies.Secure1PSIDTS = session.PSIDTS
+	c.cookies.Secure1PSIDCC = session.PSIDCC
+	c.cookies.Extra = session.Extra
+	if len(session.Extra) > 0 {
+		c.log.Info("Imported cookies", zap.Int("extra_cookies", len(session.Extra)))
+	}
+
 	// Clean cookies
 	c.cookies.Secure1PSID = cleanCookie(c.cookies.Secure1PSID)
 	configPSIDTS := cleanCookie(c.cookies.Secure1PSIDTS) // Save original config value
@@ -95,24 +202,31 @@ func (c *Client) Init(ctx context.Context) error {
 
 	// Check if we should use cached cookies or clear cache
 	if c.cookies.Secure1PSID != "" {
-		cachedTS, err := c.LoadCachedCookies()
-		
+		cached, err := c.LoadCachedCookies()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			c.log.Warn("Failed to read cookie cache, ignoring it", zap.Error(err))
+		}
+		cachedTS := ""
+		if cached != nil {
+			cachedTS = cached.Cookies["__Secure-1PSIDTS"]
+		}
+
 		// If config has a new PSIDTS that differs from cache, clear cache and use config
 		if configPSIDTS != "" && cachedTS != "" && configPSIDTS != cachedTS {
 			c.log.Info("Config has new __Secure-1PSIDTS, clearing old cache")
 			_ = c.ClearCookieCache()
 			// Keep using the config value (already set above)
-		} else if err == nil && cachedTS != "" && configPSIDTS == "" {
+		} else if cachedTS != "" && configPSIDTS == "" {
 			// Only use cache if config doesn't provide PSIDTS
-			c.cookies.Secure1PSIDTS = cachedTS
-			c.log.Info("Loaded __Secure-1PSIDTS from cache")
+			c.restoreCachedCookies(cached)
+			c.log.Info("Loaded cookies from cache", zap.Time("rotated_at", cached.RotatedAt))
 		}
 	}
 
 	// Obtain PSIDTS via rotation if missing
 	if c.cookies.Secure1PSID != "" && c.cookies.Secure1PSIDTS == "" {
 		c.log.Info("Only __Secure-1PSID provided, attempting to obtain __Secure-1PSIDTS via rotation...")
-		if err := c.RotateCookies(); err != nil {
+		if err := c.rotate(); err != nil {
 			c.log.Info("Rotation failed, proceeding with just __Secure-1PSID (might fail)", zap.String("error", err.Error()))
 		} else {
 			c.log.Info("Successfully obtained __Secure-1PSIDTS via rotation")
@@ -120,27 +234,17 @@ func (c *Client) Init(ctx context.Context) error {
 	}
 
 	// Populate cookies
-	c.httpClient.SetCommonCookies(c.cookies.ToHTTPCookies()...)
-
-	// Get SNlM0e token
-	err := c.refreshSessionToken()
-	if err != nil {
-		c.log.Debug("Initial session token fetch failed, attempting cookie rotation", zap.Error(err))
-		// Try to rotate cookies and retry
-		if rotErr := c.RotateCookies(); rotErr == nil {
-			c.log.Debug("Cookie rotation succeeded, retrying session token fetch")
-			err = c.refreshSessionToken()
-		} else {
-			c.log.Debug("Cookie rotation failed", zap.Error(rotErr))
-		}
-	}
+	c.setCookies(c.cookies.ToHTTPCookies()...)
 
-	if err != nil {
+	// Get SNlM0e token, rotating cookies if the current ones are rejected
+	if err := c.reauth(); err != nil {
 		return err
 	}
 
-	// Save the valid cookies to cache immediately after successful init
-	_ = c.SaveCachedCookies()
+	// Prefetch Gems so they show up in the model list right away
+	if _, err := c.ListGems(ctx); err != nil {
+		c.log.Warn("Failed to fetch Gems, they will be retried on demand", zap.Error(err))
+	}
 
 	c.log.Info("✅ Gemini client initialized successfully")
 
@@ -158,14 +262,14 @@ func (c *Client) refreshSessionToken() error {
 		SetTimeout(30 * time.Second).
 		SetUserAgent("Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
 	
-	resp1, err := tmpClient.R().Get("https://www.google.com/")
+	resp1, err := tmpClient.R().Get(c.endpoints.Google + "/")
 	extraCookies := ""
 	if err == nil {
 		parts := []string{}
 		for _, ck := range resp1.Cookies() {
 			parts = append(parts, fmt.Sprintf("%s=%s", ck.Name, ck.Value))
 			// Also sync to main client
-			c.httpClient.SetCommonCookies(ck)
+			c.setCookies(ck)
 		}
 		if len(parts) > 0 {
 			extraCookies = strings.Join(parts, "; ") + "; "
@@ -173,11 +277,16 @@ func (c *Client) refreshSessionToken() error {
 	}
 
 	// 2. Prepare full cookie string
+	c.cookies.mu.RLock()
+	for name, value := range c.cookies.Extra {
+		extraCookies += fmt.Sprintf("%s=%s; ", name, value)
+	}
 	cookieStr := fmt.Sprintf("%s__Secure-1PSID=%s; __Secure-1PSIDTS=%s", 
 		extraCookies, c.cookies.Secure1PSID, c.cookies.Secure1PSIDTS)
 	if c.cookies.Secure1PSIDCC != "" {
 		cookieStr += fmt.Sprintf("; __Secure-1PSIDCC=%s", c.cookies.Secure1PSIDCC)
 	}
+	c.cookies.mu.RUnlock()
 
 	commonHeaders := map[string]string{
 		"Accept":                    "text/html,application/xhtml+xml,application/xml;q=0.9,image/avif,image/webp,image/apng,*/*;q=0.8,application/signed-exchange;v=b3;q=0.7",
@@ -226,7 +335,7 @@ func (c *Client) refreshSessionToken() error {
 		return strings.Join(res, "; ")
 	}
 
-	req1, _ := http.NewRequest("GET", "https://gemini.google.com/?hl=en", nil)
+	req1, _ := http.NewRequest("GET", c.endpoints.App+"/?hl=en", nil)
 	for k, v := range commonHeaders {
 		req1.Header.Set(k, v)
 	}
@@ -234,14 +343,12 @@ func (c *Client) refreshSessionToken() error {
 	resp1_direct, _ := hClient.Do(req1)
 	if resp1_direct != nil {
 		cookieStr = mergeCookies(cookieStr, resp1_direct.Cookies())
-		for _, ck := range resp1_direct.Cookies() {
-			c.httpClient.SetCommonCookies(ck)
-		}
+		c.setCookies(resp1_direct.Cookies()...)
 		resp1_direct.Body.Close()
 	}
 
 	// 2. The main INIT hit
-	req2, _ := http.NewRequest("GET", EndpointInit+"?hl=en", nil)
+	req2, _ := http.NewRequest("GET", c.endpoints.Init+"?hl=en", nil)
 	for k, v := range commonHeaders {
 		req2.Header.Set(k, v)
 	}
@@ -252,7 +359,7 @@ func (c *Client) refreshSessionToken() error {
 
 	resp, err := hClient.Do(req2)
 	if err != nil {
-		return fmt.Errorf("failed to reach gemini app: %w", err)
+		return &UpstreamError{Kind: FailureNetwork, Err: fmt.Errorf("failed to reach gemini app: %w", err)}
 	}
 	defer resp.Body.Close()
 
@@ -288,41 +395,146 @@ func (c *Client) refreshSessionToken() error {
 
 			// Log as Info to avoid stack trace for expected auth failures
 			c.log.Info(errMsg)
-			return fmt.Errorf("%s", errMsg)
+			kind := FailureAuth
+			if isBlockedPage(body) {
+				kind = FailureBlocked
+			}
+			return &UpstreamError{Kind: kind, Status: resp.StatusCode, Err: errors.New(errMsg)}
 		}
 	}
 
 	c.mu.Lock()
 	c.at = matches[1]
+	c.tokenAt = time.Now()
 	c.healthy = true
+	c.unhealthyReason = ""
 	c.mu.Unlock()
+
+	if discovered := discoverModels(body); len(discovered) > 0 {
+		c.models.SetDiscovered(discovered)
+		ids := make([]string, len(discovered))
+		for i, m := range discovered {
+			ids[i] = m.ID
+		}
+		c.log.Debug("Discovered models from app bootstrap data", zap.Strings("models", ids))
+	}
 	return nil
 }
 
-// startAutoRefresh periodically refreshes the PSIDTS cookie
+// discoverModels reads the account's models from the "models" list of the app bootstrap
+// data. Each entry is [id, code, created]; the code and creation time may be missing.
+func discoverModels(body string) []providers.ModelInfo {
+	loc := bootstrapData.FindStringIndex(body)
+	if loc == nil {
+		return nil
+	}
+	var data struct {
+		Models []json.RawMessage `json:"models"`
+	}
+	// The decoder stops at the end of the object, before the rest of the script
+	if err := json.NewDecoder(strings.NewReader(body[loc[1]:])).Decode(&data); err != nil {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var models []providers.ModelInfo
+	for _, raw := range data.Models {
+		var fields []json.RawMessage
+		if err := json.Unmarshal(raw, &fields); err != nil || len(fields) == 0 {
+			continue
+		}
+		var m providers.ModelInfo
+		if err := json.Unmarshal(fields[0], &m.ID); err != nil || m.ID == "" || seen[m.ID] {
+			continue
+		}
+		if len(fields) > 1 {
+			_ = json.Unmarshal(fields[1], &m.Code)
+		}
+		if len(fields) > 2 {
+			_ = json.Unmarshal(fields[2], &m.Created)
+		}
+		seen[m.ID] = true
+		models = append(models, m)
+	}
+	return models
+}
+
+// startAutoRefresh periodically refreshes the PSIDTS cookie, the session token and the model list
 func (c *Client) startAutoRefresh() {
 	ticker := time.NewTicker(c.refreshInterval)
 	defer ticker.Stop()
 
+	tokenTicker := time.NewTicker(c.tokenRefresh)
+	defer tokenTicker.Stop()
+
+	modelsTicker := time.NewTicker(c.modelsRefresh)
+	defer modelsTicker.Stop()
+
 	for {
 		select {
 		case <-ticker.C:
 			if err := c.RotateCookies(); err != nil {
 				c.log.Error("Cookie rotation failed", zap.Error(err))
 			}
+		case <-tokenTicker.C:
+			if err := c.refreshToken(); err != nil {
+				c.log.Error("Session token refresh failed", zap.Error(err))
+			}
+		case <-modelsTicker.C:
+			c.refreshModels()
 		case <-c.stopRefresh:
 			return
 		}
 	}
 }
 
+// refreshToken fetches a new SNlM0e token before the current one goes stale
+func (c *Client) refreshToken() error {
+	return c.reauth()
+}
+
+// refreshModels re-reads the bootstrap data and the model overlay
+func (c *Client) refreshModels() {
+	if err := c.models.ReloadOverlay(); err != nil {
+		c.log.Warn("Failed to reload model overlay", zap.Error(err))
+	}
+	if err := c.refreshToken(); err != nil {
+		c.log.Warn("Model discovery refresh failed", zap.Error(err))
+	}
+}
+
+// RotateCookies refreshes __Secure-1PSIDTS and records the outcome for the account status
 func (c *Client) RotateCookies() error {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+	return c.rotate()
+}
+
+// rotate is RotateCookies for callers holding c.authMu
+func (c *Client) rotate() error {
+	err := c.rotateCookies()
+
+	result := &RotationResult{At: time.Now(), OK: err == nil}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	c.mu.Lock()
+	c.lastRotation = result
+	c.mu.Unlock()
+
+	return err
+}
+
+func (c *Client) rotateCookies() error {
 	c.cookies.mu.Lock()
 	defer c.cookies.mu.Unlock()
 
 	// Prepare cookies for rotation request
 	// NOTE: We access fields directly instead of using ToHTTPCookies() to avoid recursive locking (deadlock)
 	parts := []string{}
+	for name, value := range c.cookies.Extra {
+		parts = append(parts, fmt.Sprintf("%s=%s", name, value))
+	}
 	if c.cookies.Secure1PSID != "" {
 		parts = append(parts, fmt.Sprintf("__Secure-1PSID=%s", c.cookies.Secure1PSID))
 	}
@@ -336,14 +548,14 @@ func (c *Client) RotateCookies() error {
 
 	// Payload must be exactly this string
 	strBody := `[000,"-0000000000000000000"]`
-	req, _ := http.NewRequest("POST", EndpointRotateCookies, strings.NewReader(strBody))
+	req, _ := http.NewRequest("POST", c.endpoints.RotateCookies, strings.NewReader(strBody))
 	
 	req.Header.Set("Content-Type", "application/json")
 	// Google often blocks requests with default Go-http-client User-Agent
 	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36")
 	req.Header.Set("Cookie", cookieStr)
 
-	c.log.Debug("Sending rotation request", zap.String("url", EndpointRotateCookies))
+	c.log.Debug("Sending rotation request", zap.String("url", c.endpoints.RotateCookies))
 	hClient := &http.Client{Timeout: 5 * time.Second}
 	resp, err := hClient.Do(req)
 	if err != nil {
@@ -366,13 +578,13 @@ func (c *Client) RotateCookies() error {
 			c.cookies.UpdatedAt = time.Now()
 			found = true
 			// Save the new cookie to cache immediately
-			_ = c.SaveCachedCookies()
+			_ = c.saveCachedCookiesLocked()
 		}
 		if cookie.Name == "__Secure-1PSIDCC" {
 			c.cookies.Secure1PSIDCC = cookie.Value
 		}
 		// Sync to req/v3 client for future calls
-		c.httpClient.SetCommonCookies(cookie)
+		c.setCookies(cookie)
 	}
 
 	if found {
@@ -383,7 +595,7 @@ func (c *Client) RotateCookies() error {
 	return errors.New("no new __Secure-1PSIDTS cookie received")
 }
 
-func (c *Client) generateDeepResearch(ctx context.Context, prompt string, options ...providers.GenerateOption) (*providers.Response, error) {
+func (c *Client) generateDeepResearch(ctx context.Context, prompt string, gemID string) (*providers.Response, error) {
 	// Phase 1: Planning
 	c.log.Info("Starting Deep Research Phase 1: Planning", zap.String("prompt", prompt))
 	
@@ -402,21 +614,19 @@ func (c *Client) generateDeepResearch(ctx context.Context, prompt string, option
 	inner[54] = []interface{}{[]interface{}{[]interface{}{[]interface{}{[]interface{}{1}}}}} // Deep Research nested flag
 	inner[55] = []interface{}{[]interface{}{1}}
 	inner[59] = reqID
+	if gemID != "" {
+		inner[gemInnerPosition] = gemID
+	}
 
 	innerJSON, _ := json.Marshal(inner)
 	outer := []interface{}{nil, string(innerJSON)}
 	outerJSON, _ := json.Marshal(outer)
 
-	resp1, err := c.doRequest(ctx, outerJSON)
+	res1, err := c.generate(ctx, "", outerJSON)
 	if err != nil {
 		return nil, fmt.Errorf("deep research planning failed: %w", err)
 	}
 
-	res1, err := c.parseResponse(resp1.String())
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse planning response: %w", err)
-	}
-
 	stateToken, ok := res1.Metadata["state_token"].(string)
 	if !ok || stateToken == "" {
 		c.log.Warn("No state token found in planning response, returning plan as is")
@@ -438,30 +648,217 @@ func (c *Client) generateDeepResearch(ctx context.Context, prompt string, option
 	inner2[54] = inner[54]
 	inner2[55] = inner[55]
 	inner2[59] = reqID
+	inner2[gemInnerPosition] = inner[gemInnerPosition]
 
 	innerJSON2, _ := json.Marshal(inner2)
 	outer2 := []interface{}{nil, string(innerJSON2), nil, stateToken}
 	outerJSON2, _ := json.Marshal(outer2)
 
-	resp2, err := c.doRequest(ctx, outerJSON2)
+	res2, err := c.generate(ctx, "", outerJSON2)
 	if err != nil {
 		return nil, fmt.Errorf("deep research execution failed: %w", err)
 	}
+	return res2, nil
+}
+
+// BatchExecute calls a single batchexecute RPC and returns its decoded wrb.fr payload.
+// payload is JSON-encoded as the RPC's inner request. The call takes a request slot like a
+// generation does, so it must not be made while holding one.
+func (c *Client) BatchExecute(ctx context.Context, rpcID string, payload interface{}) ([]interface{}, error) {
+	if c.sessionToken() == "" {
+		return nil, errors.New("client not initialized")
+	}
 
-	return c.parseResponse(resp2.String())
+	innerJSON, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode %s payload: %w", rpcID, err)
+	}
+
+	fReq := [][][]interface{}{
+		{
+			{rpcID, string(innerJSON), nil, "generic"},
+		},
+	}
+	fReqJSON, _ := json.Marshal(fReq)
+
+	// Counted against the account's request limit, and kept out of a cookie swap
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return nil, toProviderError(ctx, err)
+	}
+	defer release()
+
+	ctx, capture := c.recorder.WithCapture(ctx)
+	var body string
+	err = c.withRetry(ctx, rpcID, func() error {
+		// Read on every attempt, so the retry after re-authentication sends the new token
+		formData := map[string]string{
+			"at":    c.sessionToken(),
+			"f.req": string(fReqJSON),
+		}
+		resp, err := c.httpClient.R().
+			SetContext(ctx).
+			SetFormData(formData).
+			SetQueryParam("rpcids", rpcID).
+			SetQueryParam("hl", "en").
+			SetQueryParam("rt", "c").
+			Post(c.endpoints.BatchExec)
+		if err != nil {
+			return &UpstreamError{Kind: FailureNetwork, Err: fmt.Errorf("%s request failed: %w", rpcID, err)}
+		}
+		body = resp.String()
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s failed: %w", rpcID, classifyStatus(resp.StatusCode, resp.Header, body))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, toProviderError(ctx, err)
+	}
+
+	result, err := parseBatchExecuteResponse(body, rpcID)
+	if err != nil {
+		c.saveFailure(capture, err)
+		return nil, err
+	}
+	return result, nil
 }
 
-func (c *Client) doRequest(ctx context.Context, outerJSON []byte) (*req.Response, error) {
-	formData := map[string]string{
-		"at":    c.at,
-		"f.req": string(outerJSON),
+// parseBatchExecuteResponse finds the wrb.fr envelope for rpcID and decodes its payload.
+// A matching envelope with an empty payload decodes to an empty slice (e.g. delete acknowledgements).
+func parseBatchExecuteResponse(body string, rpcID string) ([]interface{}, error) {
+	lines := strings.Split(body, "\n")
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, ")]}'") {
+			continue
+		}
+
+		var envelope []interface{}
+		if err := json.Unmarshal([]byte(line), &envelope); err != nil {
+			continue
+		}
+
+		for _, item := range envelope {
+			itemArr, ok := item.([]interface{})
+			if !ok || len(itemArr) < 3 || itemArr[0] != "wrb.fr" || itemArr[1] != rpcID {
+				continue
+			}
+
+			payloadStr, ok := itemArr[2].(string)
+			if !ok || payloadStr == "" {
+				return []interface{}{}, nil
+			}
+
+			var payload []interface{}
+			if err := json.Unmarshal([]byte(payloadStr), &payload); err != nil {
+				return nil, fmt.Errorf("failed to decode %s payload: %w", rpcID, err)
+			}
+			return payload, nil
+		}
 	}
 
-	return c.httpClient.R().
-		SetContext(ctx).
-		SetFormData(formData).
-		SetQueryParam("at", c.at).
-		Post(EndpointGenerate)
+	return nil, fmt.Errorf("no %s result in batchexecute response", rpcID)
+}
+
+// ApplyConfig applies a reloaded configuration to the running client.
+// New account cookies replace the current session; refresh intervals need a restart.
+func (c *Client) ApplyConfig(cfg *config.Config) {
+	c.mu.Lock()
+	c.retry = retryPolicyOf(cfg)
+	c.mu.Unlock()
+	c.budget.setPercent(cfg.Gemini.RetryBudget)
+	c.limiter.SetLimits(cfg.Gemini.Concurrency, cfg.Gemini.MaxQueue, queueTimeoutOf(cfg))
+	c.limiter.SetWeights(queueWeightsOf(cfg))
+
+	// Compare with the previous config rather than the live cookies, which drift
+	// through rotation and admin updates
+	source := accountSourceOf(cfg)
+	c.mu.Lock()
+	c.account = cfg.Gemini.Account
+	changed := source != c.source
+	c.source = source
+	c.mu.Unlock()
+	if !changed {
+		return
+	}
+
+	session, err := source.resolve()
+	if err != nil {
+		c.log.Error("Failed to read cookies from config", zap.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	if err := c.replaceCookies(ctx, session); err != nil {
+		c.log.Error("Failed to apply new cookies from config", zap.Error(err))
+		return
+	}
+	c.log.Info("Applied new cookies from config", zap.String("account", cfg.Gemini.Account))
+}
+
+// UpdateCookies replaces the session cookies and fetches a new session token with them.
+// Previously imported cookies are dropped, as they may belong to another account.
+func (c *Client) UpdateCookies(ctx context.Context, psid, psidts, psidcc string) error {
+	return c.replaceCookies(ctx, sessionCookies{
+		PSID:   cleanCookie(psid),
+		PSIDTS: cleanCookie(psidts),
+		PSIDCC: cleanCookie(psidcc),
+	})
+}
+
+// ImportCookies replaces the session with an imported cookie set, keeping its google.com cookies
+func (c *Client) ImportCookies(ctx context.Context, cookies []*http.Cookie) error {
+	return c.replaceCookies(ctx, splitSessionCookies(cookieimport.Google(cookies)))
+}
+
+func (c *Client) replaceCookies(ctx context.Context, session sessionCookies) error {
+	if session.PSID == "" {
+		return errors.New("__Secure-1PSID is required")
+	}
+	if err := c.swapSession(session); err != nil {
+		return err
+	}
+
+	if _, err := c.ListGems(ctx); err != nil {
+		c.log.Warn("Failed to fetch Gems for the new account", zap.Error(err))
+	}
+	return nil
+}
+
+// swapSession installs new cookies and fetches a session token with them.
+// Running requests are waited for, so none of them mixes the two accounts' cookies.
+func (c *Client) swapSession(session sessionCookies) error {
+	c.sessionMu.Lock()
+	defer c.sessionMu.Unlock()
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
+
+	c.cookies.mu.Lock()
+	c.cookies.Secure1PSID = session.PSID
+	c.cookies.Secure1PSIDTS = session.PSIDTS
+	c.cookies.Secure1PSIDCC = session.PSIDCC
+	c.cookies.Extra = session.Extra
+	c.cookies.UpdatedAt = time.Now()
+	c.cookies.mu.Unlock()
+
+	if session.PSIDTS == "" {
+		if err := c.rotate(); err != nil {
+			c.log.Info("Rotation failed, proceeding with just __Secure-1PSID (might fail)", zap.String("error", err.Error()))
+		}
+	}
+
+	c.clearCookies()
+	c.setCookies(c.cookies.ToHTTPCookies()...)
+
+	if err := c.refreshSessionToken(); err != nil {
+		c.markUnhealthy(fmt.Sprintf("new cookies rejected: %v", err))
+		return err
+	}
+
+	_ = c.SaveCachedCookies()
+	return nil
 }
 
 func (c *Client) GetCookies() *CookieStore {
@@ -471,13 +868,27 @@ func (c *Client) GetCookies() *CookieStore {
 	return &CookieStore{
 		Secure1PSID:   c.cookies.Secure1PSID,
 		Secure1PSIDTS: c.cookies.Secure1PSIDTS,
+		Secure1PSIDCC: c.cookies.Secure1PSIDCC,
+		Extra:         maps.Clone(c.cookies.Extra),
 		UpdatedAt:     c.cookies.UpdatedAt,
 	}
 }
 
+// GenerateContent sends a single prompt. Failures are returned as *providers.Error.
 func (c *Client) GenerateContent(ctx context.Context, prompt string, options ...providers.GenerateOption) (*providers.Response, error) {
-	c.reqMu.Lock()
-	defer c.reqMu.Unlock()
+	response, err := c.generateContent(ctx, prompt, options...)
+	if err != nil {
+		return nil, toProviderError(ctx, err)
+	}
+	return response, nil
+}
+
+func (c *Client) generateContent(ctx context.Context, prompt string, options ...providers.GenerateOption) (*providers.Response, error) {
+	release, err := c.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
 	config := &providers.GenerateConfig{
 		Model: "gemini-pro", // default
@@ -486,78 +897,206 @@ func (c *Client) GenerateContent(ctx context.Context, prompt string, options ...
 		opt(config)
 	}
 
-	if c.at == "" {
+	if c.sessionToken() == "" {
 		return nil, errors.New("client not initialized")
 	}
 
+	if err := c.applyGem(config); err != nil {
+		return nil, err
+	}
+
 	if config.DeepResearch {
-		return c.generateDeepResearch(ctx, prompt, options...)
+		return c.generateDeepResearch(ctx, prompt, config.GemID)
 	}
 
 	// Build request payload
-	inner := []interface{}{
-		[]interface{}{prompt},
-		nil,
-		nil,
-	}
+	inner := buildGenerateInner(prompt, nil, config.GemID)
 
 	innerJSON, _ := json.Marshal(inner)
 	outer := []interface{}{nil, string(innerJSON)}
 	outerJSON, _ := json.Marshal(outer)
 
+	return c.generate(ctx, config.Model, outerJSON)
+}
+
+// generate posts a StreamGenerate request for a model under the client's retry policy.
+// The caller must hold a slot from c.acquire.
+func (c *Client) generate(ctx context.Context, model string, outerJSON []byte) (*providers.Response, error) {
+	var result *providers.Response
+	err := c.withRetry(ctx, "generate", func() error {
+		var err error
+		result, err = c.postGenerate(ctx, model, outerJSON)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// postGenerate sends one StreamGenerate request and classifies its failure
+func (c *Client) postGenerate(ctx context.Context, model string, outerJSON []byte) (*providers.Response, error) {
+	c.mu.RLock()
+	at := c.at
+	c.mu.RUnlock()
+
 	formData := map[string]string{
-		"at":    c.at,
+		"at":    at,
 		"f.req": string(outerJSON),
 	}
 
+	ctx, capture := c.recorder.WithCapture(ctx)
+	startTime := time.Now()
+	req := c.httpClient.R().
+		SetContext(ctx).
+		SetFormData(formData).
+		SetQueryParam("at", at)
+	if code := c.modelCode(model); code != "" {
+		req.SetHeader(ModelHeader, fmt.Sprintf(`[1,null,null,null,%q]`, code))
+	}
+	resp, err := req.Post(c.endpoints.Generate)
 
-	var lastErr error
-	for attempt := 0; attempt <= c.maxRetries; attempt++ {
-		if attempt > 0 {
-			c.log.Warn("Retrying generate request",
-				zap.Int("attempt", attempt),
-				zap.Int("max_retries", c.maxRetries),
-				zap.Error(lastErr),
-			)
-		}
+	duration := time.Since(startTime)
+	if err != nil {
+		c.log.Error("Generate request failed", zap.Error(err), zap.Duration("duration", duration))
+		return nil, &UpstreamError{Kind: FailureNetwork, Err: err}
+	}
 
-		// Abort remaining attempts if the caller cancelled the context.
-		if ctx.Err() != nil {
-			return nil, ctx.Err()
-		}
+	body := resp.String()
+	if resp.StatusCode != http.StatusOK {
+		return nil, classifyStatus(resp.StatusCode, resp.Header, body)
+	}
 
-		startTime := time.Now()
-		resp, err := c.httpClient.R().
-			SetContext(ctx).
-			SetFormData(formData).
-			SetQueryParam("at", c.at).
-			Post(EndpointGenerate)
+	result, err := c.parseResponse(body)
+	if err != nil {
+		c.saveFailure(capture, err)
+		return nil, classifyParseFailure(body, err)
+	}
+	return result, nil
+}
 
-		duration := time.Since(startTime)
-		if err != nil {
-			c.log.Error("Generate request failed", zap.Error(err), zap.Duration("duration", duration))
-			lastErr = err
-			continue
-		}
+// reauth fetches a new session token, rotating cookies first if the current ones are rejected.
+// The client is marked unhealthy with the reason when both fail.
+func (c *Client) reauth() error {
+	c.authMu.Lock()
+	defer c.authMu.Unlock()
 
-		if resp.StatusCode != http.StatusOK {
-			lastErr = fmt.Errorf("generate failed with status: %d", resp.StatusCode)
-			continue
+	err := c.refreshSessionToken()
+	if err != nil && FailureKindOf(err) != FailureNetwork {
+		c.log.Debug("Session token fetch failed, attempting cookie rotation", zap.Error(err))
+		if rotErr := c.rotate(); rotErr == nil {
+			c.log.Debug("Cookie rotation succeeded, retrying session token fetch")
+			err = c.refreshSessionToken()
+		} else {
+			c.log.Debug("Cookie rotation failed", zap.Error(rotErr))
+			err = fmt.Errorf("%w (cookie rotation failed: %v)", err, rotErr)
 		}
+	}
+	if err != nil {
+		c.markUnhealthy(fmt.Sprintf("re-authentication failed: %v", err))
+		return err
+	}
 
-		result, err := c.parseResponse(resp.String())
-		if err != nil {
-			lastErr = err
-			continue
+	_ = c.SaveCachedCookies()
+	return nil
+}
+
+// acquire waits for a request slot and holds the session for the request's duration.
+// Queue limits are reported as provider errors so that clients get 429 or 503.
+func (c *Client) acquire(ctx context.Context) (func(), error) {
+	release, err := c.limiter.Acquire(ctx)
+	switch {
+	case errors.Is(err, queue.ErrQueueFull):
+		return nil, providers.NewError(providers.ErrRateLimited, "too many requests are waiting for this Gemini account, try again later", err)
+	case errors.Is(err, queue.ErrQueueTimeout):
+		return nil, providers.NewError(providers.ErrUpstreamUnavailable, "no free slot for this Gemini account in time", err)
+	case err != nil:
+		return nil, err
+	}
+
+	c.sessionMu.RLock()
+	return func() {
+		c.sessionMu.RUnlock()
+		release()
+	}, nil
+}
+
+// sessionToken returns the current SNlM0e token, empty before Init
+func (c *Client) sessionToken() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.at
+}
+
+// setCookies stores cookies in the HTTP client's jar, which unlike its common cookies is safe
+// to update while requests are running. Host-only cookies are widened to google.com; off
+// Google's hosts all cookies are kept host-only, and without Secure over plain HTTP.
+func (c *Client) setCookies(cookies ...*http.Cookie) {
+	widened := make([]*http.Cookie, 0, len(cookies))
+	for _, cookie := range cookies {
+		ck := *cookie
+		if c.cookieDomain == "" {
+			ck.Domain = ""
+		} else if ck.Domain == "" {
+			ck.Domain = c.cookieDomain
+		}
+		if ck.Path == "" {
+			ck.Path = "/"
+		}
+		if c.cookieURL.Scheme != "https" {
+			ck.Secure = false
 		}
+		widened = append(widened, &ck)
+	}
+	c.httpClient.GetClient().Jar.SetCookies(c.cookieURL, widened)
+}
 
-		if attempt > 0 {
-			c.log.Info("Generate request succeeded after retry", zap.Int("attempt", attempt))
+// clearCookies expires every cookie the jar holds for Gemini, host-only and domain-wide
+func (c *Client) clearCookies() {
+	jar := c.httpClient.GetClient().Jar
+	var expired []*http.Cookie
+	for _, cookie := range jar.Cookies(c.cookieURL) {
+		expired = append(expired, &http.Cookie{Name: cookie.Name, Path: "/", MaxAge: -1})
+		if c.cookieDomain != "" {
+			expired = append(expired, &http.Cookie{Name: cookie.Name, Domain: c.cookieDomain, Path: "/", MaxAge: -1})
 		}
-		return result, nil
 	}
+	jar.SetCookies(c.cookieURL, expired)
+}
 
-	return nil, lastErr
+func queueTimeoutOf(cfg *config.Config) time.Duration {
+	return time.Duration(cfg.Gemini.QueueTimeout) * time.Second
+}
+
+func queueWeightsOf(cfg *config.Config) queue.Weights {
+	return queue.Weights{cfg.Queue.InteractiveWeight, cfg.Queue.BatchWeight, cfg.Queue.ResearchWeight}
+}
+
+// markUnhealthy flags the client as unable to serve requests, with the reason shown in the status
+func (c *Client) markUnhealthy(reason string) {
+	c.mu.Lock()
+	c.healthy = false
+	c.unhealthyReason = reason
+	c.mu.Unlock()
+	c.log.Warn("Gemini client marked unhealthy", zap.String("reason", reason))
+}
+
+// buildGenerateInner builds the inner StreamGenerate request.
+// metadata is the [cid, rid, rcid] of the conversation to continue, nil for a new one;
+// a Gem ID is placed at index 19, as the web app does.
+func buildGenerateInner(prompt string, metadata []interface{}, gemID string) []interface{} {
+	inner := []interface{}{
+		[]interface{}{prompt},
+		nil,
+		metadata,
+	}
+	if gemID != "" {
+		for len(inner) < gemInnerPosition {
+			inner = append(inner, nil)
+		}
+		inner = append(inner, gemID)
+	}
+	return inner
 }
 
 func (c *Client) StartChat(options ...providers.ChatOption) providers.ChatSession {
@@ -594,156 +1133,48 @@ func (c *Client) IsHealthy() bool {
 	return c.healthy
 }
 
+// UnhealthyReason explains why the client is unhealthy, empty when it is healthy
+func (c *Client) UnhealthyReason() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.unhealthyReason
+}
+
 func (c *Client) ListModels() []providers.ModelInfo {
 	var models []providers.ModelInfo
-	for _, m := range providers.SupportedModels {
+	for _, m := range c.models.List() {
 		if m.Provider == "gemini" {
 			models = append(models, m)
 		}
 	}
-	return models
+	return append(models, c.gemModels()...)
 }
 
-// parseResponse parses Gemini's response format.
-// It scans ALL wrb.fr items across all lines to collect:
-//   - response text (from candidates)
-//   - conversation metadata (cid, rid, rcid)
-//   - state token (from dict key "26" in a secondary item, or legacy "!" prefix strings)
-func (c *Client) parseResponse(text string) (*providers.Response, error) {
-	var (
-		resText    string
-		cid        string
-		rid        string
-		rcid       string
-		stateToken string
-	)
-
-	lines := strings.Split(text, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		line = strings.TrimPrefix(line, ")]}'")
-
-		var root []interface{}
-		if err := json.Unmarshal([]byte(line), &root); err != nil {
-			continue
-		}
-
-		for _, item := range root {
-			itemArray, ok := item.([]interface{})
-			if !ok || len(itemArray) < 3 {
-				continue
-			}
-
-			payloadStr, ok := itemArray[2].(string)
-			if !ok {
-				continue
-			}
-
-			var payload []interface{}
-			if err := json.Unmarshal([]byte(payloadStr), &payload); err != nil {
-				continue
-			}
-
-			// Extract cid/rid from payload[1] (string or []string)
-			if len(payload) > 1 && cid == "" {
-				switch v := payload[1].(type) {
-				case string:
-					cid = v
-				case []interface{}:
-					if len(v) > 0 {
-						if s, ok := v[0].(string); ok {
-							cid = s
-						}
-					}
-					if len(v) > 1 && rid == "" {
-						if s, ok := v[1].(string); ok {
-							rid = s
-						}
-					}
-				}
-			}
-
-			// Extract text from candidates at payload[4]
-			if resText == "" && len(payload) > 4 {
-				candidates, ok := payload[4].([]interface{})
-				if ok && len(candidates) > 0 {
-					firstCandidate, ok := candidates[0].([]interface{})
-					if ok && len(firstCandidate) >= 2 {
-						contentParts, ok := firstCandidate[1].([]interface{})
-						if ok && len(contentParts) > 0 {
-							if s, ok := contentParts[0].(string); ok {
-								resText = s
-								if len(firstCandidate) > 0 {
-									if id, ok := firstCandidate[0].(string); ok {
-										rcid = id
-									}
-								}
-							}
-						}
-					}
-				}
-			}
-
-			// Extract state token: new format is a dict with key "26" at payload[2]
-			if stateToken == "" && len(payload) > 2 {
-				if m, ok := payload[2].(map[string]interface{}); ok {
-					if v, exists := m["26"]; exists {
-						if s, ok := v.(string); ok && len(s) > 10 {
-							stateToken = s
-						}
-					}
-				}
-			}
-
-			// Legacy state token: recursive search for string starting with '!'
-			if stateToken == "" {
-				stateToken = extractStateToken(payload)
-			}
-		}
-	}
+// ResolveModel maps a model alias to the model it points at; other IDs are returned unchanged
+func (c *Client) ResolveModel(id string) string {
+	return c.models.Resolve(id)
+}
 
-	if resText == "" {
-		sample := text
-		if len(sample) > 500 {
-			sample = sample[:500]
-		}
-		return nil, fmt.Errorf("failed to parse response. Sample: %s", sample)
+// modelCode returns the upstream code of a model or alias, empty when the web app should
+// pick its default model
+func (c *Client) modelCode(model string) string {
+	if m, ok := c.models.Get(c.models.Resolve(model)); ok {
+		return m.Code
 	}
-
-	return &providers.Response{
-		Text: resText,
-		Metadata: map[string]any{
-			"cid":         cid,
-			"rid":         rid,
-			"rcid":        rcid,
-			"state_token": stateToken,
-		},
-	}, nil
+	return ""
 }
 
-func extractStateToken(v interface{}) string {
-	switch val := v.(type) {
-	case string:
-		if strings.HasPrefix(val, "!") && len(val) > 20 {
-			return val
-		}
-	case []interface{}:
-		for _, item := range val {
-			if token := extractStateToken(item); token != "" {
-				return token
-			}
-		}
-	case map[string]interface{}:
-		for _, item := range val {
-			if token := extractStateToken(item); token != "" {
-				return token
-			}
+// GetModel returns a model, alias or Gem by ID
+func (c *Client) GetModel(id string) (providers.ModelInfo, bool) {
+	if m, ok := c.models.Get(id); ok {
+		return m, true
+	}
+	for _, m := range c.gemModels() {
+		if m.ID == id {
+			return m, true
 		}
 	}
-	return ""
+	return providers.ModelInfo{}, false
 }
 
 func (cs *CookieStore) ToHTTPCookies() []*http.Cookie {
@@ -753,6 +1184,16 @@ func (cs *CookieStore) ToHTTPCookies() []*http.Cookie {
 	cookies := []*http.Cookie{}
 	domain := ".google.com"
 
+	for name, value := range cs.Extra {
+		cookies = append(cookies, &http.Cookie{
+			Name:   name,
+			Value:  value,
+			Domain: domain,
+			Path:   "/",
+			Secure: true,
+		})
+	}
+
 	if cs.Secure1PSID != "" {
 		cookies = append(cookies, &http.Cookie{
 			Name:     "__Secure-1PSID",
@@ -797,212 +1238,78 @@ func cleanCookie(v string) string {
 	return v
 }
 
-// LoadCachedCookies attempts to read the saved 1PSIDTS from disk
-func (c *Client) LoadCachedCookies() (string, error) {
-	if c.cookies.Secure1PSID == "" {
-		return "", errors.New("no PSID available")
-	}
-
+// cacheKeyLocked identifies the account in the cookie cache without revealing its cookies.
+// Callers must hold c.cookies.mu.
+func (c *Client) cacheKeyLocked() string {
 	hash := sha256.Sum256([]byte(c.cookies.Secure1PSID))
-	filename := filepath.Join(".cookies", hex.EncodeToString(hash[:])+".txt")
+	return hex.EncodeToString(hash[:])
+}
 
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		return "", err
-	}
+// LoadCachedCookies reads the cookies saved for the current __Secure-1PSID
+func (c *Client) LoadCachedCookies() (*CachedCookies, error) {
+	c.cookies.mu.RLock()
+	psid, key := c.cookies.Secure1PSID, c.cacheKeyLocked()
+	c.cookies.mu.RUnlock()
 
-	ts := strings.TrimSpace(string(data))
-	if ts == "" {
-		return "", errors.New("empty cache file")
+	if psid == "" {
+		return nil, errors.New("no PSID available")
 	}
-	return ts, nil
+	return c.cache.Load(key)
 }
 
-// SaveCachedCookies writes the current 1PSIDTS to disk
+// SaveCachedCookies writes the current cookie set to the cache
 func (c *Client) SaveCachedCookies() error {
+	c.cookies.mu.RLock()
+	defer c.cookies.mu.RUnlock()
+	return c.saveCachedCookiesLocked()
+}
+
+// saveCachedCookiesLocked is SaveCachedCookies for callers holding c.cookies.mu
+func (c *Client) saveCachedCookiesLocked() error {
 	if c.cookies.Secure1PSID == "" || c.cookies.Secure1PSIDTS == "" {
 		return nil
 	}
 
-	// Create directory if not exists
-	if err := os.MkdirAll(".cookies", 0755); err != nil {
-		return err
+	cookies := make(map[string]string, len(c.cookies.Extra)+3)
+	for name, value := range c.cookies.Extra {
+		cookies[name] = value
+	}
+	cookies["__Secure-1PSID"] = c.cookies.Secure1PSID
+	cookies["__Secure-1PSIDTS"] = c.cookies.Secure1PSIDTS
+	if c.cookies.Secure1PSIDCC != "" {
+		cookies["__Secure-1PSIDCC"] = c.cookies.Secure1PSIDCC
 	}
 
-	hash := sha256.Sum256([]byte(c.cookies.Secure1PSID))
-	filename := filepath.Join(".cookies", hex.EncodeToString(hash[:])+".txt")
-
-	err := os.WriteFile(filename, []byte(c.cookies.Secure1PSIDTS), 0600)
+	c.mu.RLock()
+	account := c.account
+	c.mu.RUnlock()
+
+	err := c.cache.Save(c.cacheKeyLocked(), &CachedCookies{
+		Account:   account,
+		Cookies:   cookies,
+		RotatedAt: c.cookies.UpdatedAt,
+		SavedAt:   time.Now(),
+	})
 	if err == nil {
-		c.log.Debug("Saved __Secure-1PSIDTS to local cache for future use", zap.String("file", filename))
+		c.log.Debug("Saved cookies to local cache for future use", zap.Int("cookies", len(cookies)))
 	} else {
-		c.log.Warn("Failed to save cookies to cache", zap.String("file", filename), zap.Error(err))
+		c.log.Warn("Failed to save cookies to cache", zap.Error(err))
 	}
 	return err
 }
 
-// RetrieveDeepResearch fetches the full research report and references for a given conversation
-func (c *Client) RetrieveDeepResearch(ctx context.Context, conversationID string) (*providers.Response, error) {
-	c.log.Info("Retrieving Deep Research content", zap.String("conversation_id", conversationID))
-
-	if c.at == "" {
-		return nil, errors.New("client not initialized")
-	}
-
-	// Payload for kwDCne (BatchExecute)
-	inner := []interface{}{conversationID}
-	innerJSON, _ := json.Marshal(inner)
-	
-	fReq := [][][]interface{}{
-		{
-			{"kwDCne", string(innerJSON), nil, "generic"},
-		},
-	}
-	fReqJSON, _ := json.Marshal(fReq)
-
-	formData := map[string]string{
-		"at":    c.at,
-		"f.req": string(fReqJSON),
-	}
-
-	resp, err := c.httpClient.R().
-		SetContext(ctx).
-		SetFormData(formData).
-		SetQueryParam("rpcids", "kwDCne").
-		SetQueryParam("hl", "en").
-		SetQueryParam("rt", "c").
-		Post(EndpointBatchExec)
-
-	if err != nil {
-		return nil, fmt.Errorf("retrieval request failed: %w", err)
-	}
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("retrieval failed with status: %d", resp.StatusCode)
-	}
-
-	// Parse BatchExecute response
-	body := resp.String()
-	lines := strings.Split(body, "\n")
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, ")]}'") {
-			continue
-		}
-
-		var envelope []interface{}
-		if err := json.Unmarshal([]byte(line), &envelope); err != nil {
-			continue
-		}
-
-		for _, item := range envelope {
-			itemArr, ok := item.([]interface{})
-			if !ok || len(itemArr) < 3 || itemArr[0] != "wrb.fr" {
-				continue
-			}
-
-			payloadStr, ok := itemArr[2].(string)
-			if !ok {
-				continue
-			}
-
-			var payload []interface{}
-			if err := json.Unmarshal([]byte(payloadStr), &payload); err != nil {
-				continue
-			}
-
-			// Based on browser investigation:
-			// data[0][1][4] is the report object
-			// Index 0: Title, 1: Summary, 2: Steps (array)
-			if len(payload) > 0 {
-				// DEBUG: dump payload to file for inspection
-				if debugJSON, err2 := json.MarshalIndent(payload, "", "  "); err2 == nil {
-					_ = os.WriteFile("/tmp/kwdcne_payload.json", debugJSON, 0644)
-				}
-
-				data, ok := payload[0].([]interface{})
-				if !ok || len(data) < 2 {
-					continue
-				}
-
-				reportContainer, ok := data[1].([]interface{})
-				if !ok || len(reportContainer) < 5 {
-					continue
-				}
-
-				report, ok := reportContainer[4].([]interface{})
-				if !ok || len(report) < 3 {
-					continue
-				}
-
-				// Extract main text (usually Title + Summary)
-				title, _ := report[0].(string)
-				summary, _ := report[1].(string)
-				fullText := title + "\n\n" + summary
-
-				// Extract references from steps
-				var references []providers.Reference
-				steps, ok := report[2].([]interface{})
-				if ok {
-					for _, step := range steps {
-						stepArr, ok := step.([]interface{})
-						if !ok || len(stepArr) < 5 {
-							continue
-						}
-
-						resultObj, ok := stepArr[4].([]interface{})
-						if !ok || len(resultObj) < 3 {
-							continue
-						}
-
-						sourceArr, ok := resultObj[2].([]interface{})
-						if !ok || len(sourceArr) < 4 {
-							continue
-						}
-
-						// [favicon_url, target_url, title, snippet]
-						icon, _ := sourceArr[0].(string)
-						url, _ := sourceArr[1].(string)
-						refTitle, _ := sourceArr[2].(string)
-						snippet, _ := sourceArr[3].(string)
-
-						if url != "" {
-							references = append(references, providers.Reference{
-								Title:   refTitle,
-								URL:     url,
-								Snippet: snippet,
-								Icon:    icon,
-							})
-						}
-					}
-				}
-
-				return &providers.Response{
-					Text:           fullText,
-					ConversationID: conversationID,
-					References:     references,
-				}, nil
-			}
-		}
-	}
-
-	return nil, fmt.Errorf("failed to extract research data from response")
-}
-
-// ClearCookieCache deletes the cached cookie file for the current PSID
+// ClearCookieCache deletes the cached cookies for the current PSID
 func (c *Client) ClearCookieCache() error {
-	if c.cookies.Secure1PSID == "" {
+	c.cookies.mu.RLock()
+	psid, key := c.cookies.Secure1PSID, c.cacheKeyLocked()
+	c.cookies.mu.RUnlock()
+
+	if psid == "" {
 		return nil
 	}
-
-	hash := sha256.Sum256([]byte(c.cookies.Secure1PSID))
-	filename := filepath.Join(".cookies", hex.EncodeToString(hash[:])+".txt")
-
-	err := os.Remove(filename)
-	if err != nil && !os.IsNotExist(err) {
+	if err := c.cache.Delete(key); err != nil {
 		return err
 	}
-	
-	c.log.Debug("Cleared cookie cache", zap.String("file", filename))
+	c.log.Debug("Cleared cookie cache")
 	return nil
 }
@@ -0,0 +1,340 @@
+package gemini_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/providers"
+	"gemini-web-to-api/internal/providers/gemini"
+	"gemini-web-to-api/internal/providers/gemini/geminitest"
+
+	"go.uber.org/zap/zaptest"
+)
+
+// newClient starts a fake Gemini and returns an initialized client talking to it
+func newClient(t *testing.T) (*gemini.Client, *geminitest.Server) {
+	t.Helper()
+	fake := geminitest.NewServer()
+	t.Cleanup(fake.Close)
+	fake.Setenv(t)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	client, err := gemini.NewClient(cfg, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if err := client.Init(context.Background()); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, fake
+}
+
+func TestGenerateContent(t *testing.T) {
+	client, fake := newClient(t)
+
+	response, err := client.GenerateContent(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if response.Text != "You said: hello" {
+		t.Errorf("text = %q", response.Text)
+	}
+	if cid, _ := response.Metadata["cid"].(string); cid == "" {
+		t.Error("response has no conversation ID")
+	}
+	if got := fake.Prompts(); len(got) != 1 || got[0] != "hello" {
+		t.Errorf("prompts sent = %q", got)
+	}
+}
+
+func TestChatSessionContinuesConversation(t *testing.T) {
+	client, _ := newClient(t)
+	ctx := context.Background()
+
+	chat := client.StartChat()
+	first, err := chat.SendMessage(ctx, "one")
+	if err != nil {
+		t.Fatalf("first message: %v", err)
+	}
+	second, err := chat.SendMessage(ctx, "two")
+	if err != nil {
+		t.Fatalf("second message: %v", err)
+	}
+	if first.Metadata["cid"] != second.Metadata["cid"] {
+		t.Errorf("conversation changed: %v, then %v", first.Metadata["cid"], second.Metadata["cid"])
+	}
+}
+
+func TestStaleTokenIsRefreshed(t *testing.T) {
+	client, fake := newClient(t)
+	fake.ExpireToken()
+
+	if _, err := client.GenerateContent(context.Background(), "hello"); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if got := fake.Hits(geminitest.Generate); got != 2 {
+		t.Errorf("generate requests = %d, want 2", got)
+	}
+	if got := fake.Hits(geminitest.Init); got != 2 {
+		t.Errorf("token fetches = %d, want 2", got)
+	}
+}
+
+func TestStaleTokenIsRefreshedForBatchExecute(t *testing.T) {
+	client, fake := newClient(t)
+	fake.ExpireToken()
+	before := fake.Hits(geminitest.BatchExecute)
+
+	if _, err := client.ListConversations(context.Background(), 10); err != nil {
+		t.Fatalf("list conversations: %v", err)
+	}
+	if got := fake.Hits(geminitest.BatchExecute) - before; got != 2 {
+		t.Errorf("batchexecute requests = %d, want 2", got)
+	}
+	if got := fake.Hits(geminitest.Init); got != 2 {
+		t.Errorf("token fetches = %d, want 2", got)
+	}
+	if !client.IsHealthy() {
+		t.Errorf("client unhealthy: %s", client.UnhealthyReason())
+	}
+}
+
+func TestExpiredSessionIsRotated(t *testing.T) {
+	client, fake := newClient(t)
+	fake.ExpireSession()
+
+	if _, err := client.GenerateContent(context.Background(), "hello"); err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if got := fake.Hits(geminitest.RotateCookies); got != 1 {
+		t.Errorf("rotations = %d, want 1", got)
+	}
+	if !client.IsHealthy() {
+		t.Errorf("client unhealthy: %s", client.UnhealthyReason())
+	}
+}
+
+func TestGetCookiesReturnsRotatedCookies(t *testing.T) {
+	client, _ := newClient(t)
+	if err := client.RotateCookies(); err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+
+	cookies := client.GetCookies()
+	if cookies.Secure1PSID != geminitest.PSID || cookies.Secure1PSIDTS == "" || cookies.Secure1PSIDCC != "fake-psidcc" {
+		t.Errorf("cookies = PSID %q, PSIDTS %q, PSIDCC %q", cookies.Secure1PSID, cookies.Secure1PSIDTS, cookies.Secure1PSIDCC)
+	}
+}
+
+func TestRejectedCookiesMarkUnhealthy(t *testing.T) {
+	client, fake := newClient(t)
+	fake.ExpireSession()
+	fake.FailNext(geminitest.RotateCookies, geminitest.ServerError())
+
+	_, err := client.GenerateContent(context.Background(), "hello")
+	if kind := providers.AsError(err).Kind; kind != providers.ErrUnauthenticated {
+		t.Fatalf("error kind = %s, want %s (%v)", kind, providers.ErrUnauthenticated, err)
+	}
+	if client.IsHealthy() || client.UnhealthyReason() == "" {
+		t.Error("client should be unhealthy with a reason")
+	}
+}
+
+func TestTransientFailuresAreRetried(t *testing.T) {
+	client, fake := newClient(t)
+	fake.FailNext(geminitest.Generate, geminitest.ServerError(), geminitest.Disconnect(), geminitest.Malformed())
+
+	response, err := client.GenerateContent(context.Background(), "hello")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if response.Text != "You said: hello" {
+		t.Errorf("text = %q", response.Text)
+	}
+	if got := fake.Hits(geminitest.Generate); got != 4 {
+		t.Errorf("generate requests = %d, want 4", got)
+	}
+}
+
+func TestFailuresAreClassified(t *testing.T) {
+	tests := []struct {
+		name    string
+		failure geminitest.Failure
+		kind    providers.ErrorKind
+	}{
+		{"usage limit", geminitest.UsageLimit(), providers.ErrRateLimited},
+		{"rate limited beyond the longest wait", geminitest.RateLimited(time.Hour), providers.ErrRateLimited},
+		{"ip blocked", geminitest.IPBlocked(), providers.ErrUpstreamUnavailable},
+		{"unusual traffic", geminitest.BlockedPage(), providers.ErrUpstreamUnavailable},
+		{"model unavailable", geminitest.ModelUnavailable(), providers.ErrModelUnavailable},
+		{"content blocked", geminitest.ContentBlocked(), providers.ErrContentBlocked},
+		{"invalid request", geminitest.InvalidRequest(), providers.ErrInvalidRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, fake := newClient(t)
+			fake.FailNext(geminitest.Generate, tt.failure)
+
+			_, err := client.GenerateContent(context.Background(), "hello")
+			var providerErr *providers.Error
+			if !errors.As(err, &providerErr) {
+				t.Fatalf("error %v is not a provider error", err)
+			}
+			if providerErr.Kind != tt.kind {
+				t.Errorf("kind = %s, want %s", providerErr.Kind, tt.kind)
+			}
+			if got := fake.Hits(geminitest.Generate); got != 1 {
+				t.Errorf("generate requests = %d, want no retries", got)
+			}
+		})
+	}
+}
+
+func TestRateLimitCarriesRetryAfter(t *testing.T) {
+	client, fake := newClient(t)
+	fake.FailNext(geminitest.Generate, geminitest.RateLimited(time.Minute))
+
+	_, err := client.GenerateContent(context.Background(), "hello")
+	if got := providers.AsError(err).RetryAfter; got != time.Minute {
+		t.Errorf("retry after = %s, want 1m", got)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	client, fake := newClient(t)
+	fake.FailNext(geminitest.Generate, geminitest.Slow(300*time.Millisecond))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := client.GenerateContent(ctx, "hello")
+	if kind := providers.AsError(err).Kind; kind != providers.ErrTimeout {
+		t.Errorf("error kind = %s, want %s", kind, providers.ErrTimeout)
+	}
+}
+
+func TestBatchExecuteWaitsForRequestSlot(t *testing.T) {
+	t.Setenv("GEMINI_CONCURRENCY", "1")
+	client, fake := newClient(t)
+	started := make(chan struct{})
+	fake.SetReply(func(prompt string) string {
+		close(started)
+		time.Sleep(300 * time.Millisecond)
+		return "done"
+	})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, _ = client.GenerateContent(context.Background(), "hello")
+	}()
+	defer func() { <-done }()
+	<-started
+	before := fake.Hits(geminitest.BatchExecute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := client.ListConversations(ctx, 10); err == nil {
+		t.Fatal("listed conversations while the only slot was taken")
+	}
+	if got := fake.Hits(geminitest.BatchExecute) - before; got != 0 {
+		t.Errorf("batchexecute requests = %d while the only slot was taken, want 0", got)
+	}
+}
+
+func TestDeepResearch(t *testing.T) {
+	client, fake := newClient(t)
+
+	response, err := client.GenerateContent(context.Background(), "history of tea", providers.WithDeepResearch(true))
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	if got := fake.Hits(geminitest.Generate); got != 2 {
+		t.Errorf("generate requests = %d, want planning and execution", got)
+	}
+	if response.Text != "# Research report\n\nYou said: Start research" {
+		t.Errorf("text = %q", response.Text)
+	}
+}
+
+func TestRetrieveDeepResearch(t *testing.T) {
+	client, fake := newClient(t)
+	fake.AddResearch("c_research", geminitest.Research{
+		Title: "Tea",
+		Plan:  []string{"Find sources", "Summarize"},
+		Sources: []geminitest.Source{
+			{Title: "Tea - Wikipedia", URL: "https://en.wikipedia.org/wiki/Tea", Snippet: "Tea is a drink"},
+		},
+		Body: "# Tea\n\nTea is a drink.\n\n## Origins\n\nChina.",
+	})
+
+	report, err := client.RetrieveDeepResearch(context.Background(), "c_research")
+	if err != nil {
+		t.Fatalf("retrieve: %v", err)
+	}
+	if report.Title != "Tea" || len(report.Plan) != 2 {
+		t.Errorf("title %q, plan %q", report.Title, report.Plan)
+	}
+	if len(report.References) != 1 || report.References[0].URL != "https://en.wikipedia.org/wiki/Tea" {
+		t.Errorf("references = %+v", report.References)
+	}
+	if len(report.Sections) != 2 {
+		t.Errorf("sections = %+v", report.Sections)
+	}
+
+	if _, err := client.RetrieveDeepResearch(context.Background(), "c_unknown"); err == nil {
+		t.Error("unknown conversation should fail")
+	}
+}
+
+func TestModelsAreDiscovered(t *testing.T) {
+	client, _ := newClient(t)
+
+	for _, id := range []string{"gemini-2.5-flash", "gemini-2.5-pro"} {
+		m, ok := client.GetModel(id)
+		if !ok {
+			t.Fatalf("model %s was not discovered", id)
+		}
+		if m.Created != 1750118400 || m.Code != geminitest.ModelCodes[id] {
+			t.Errorf("%s: created %d, code %q", id, m.Created, m.Code)
+		}
+	}
+}
+
+func TestGems(t *testing.T) {
+	client, fake := newClient(t)
+	fake.AddGem(geminitest.Gem{ID: "g_coding", Name: "Coding Partner", Description: "Helps with code"})
+	if _, err := client.ListGems(context.Background()); err != nil {
+		t.Fatalf("list gems: %v", err)
+	}
+
+	m, ok := client.GetModel("gem:coding-partner")
+	if !ok {
+		t.Fatal("the Gem is not listed as a model")
+	}
+	if m.Created == 0 || m.DisplayName != "Coding Partner" {
+		t.Errorf("gem model = %+v", m)
+	}
+
+	ctx := context.Background()
+	if _, err := client.GenerateContent(ctx, "hello", providers.WithModel("gem:coding-partner")); err != nil {
+		t.Fatalf("generate with a gem model: %v", err)
+	}
+	if _, err := client.GenerateContent(ctx, "history of tea", providers.WithGem("Coding Partner"), providers.WithDeepResearch(true)); err != nil {
+		t.Fatalf("deep research with a gem: %v", err)
+	}
+	// The plain request, then Deep Research planning and execution
+	if got := fake.Gems(); len(got) != 3 || got[0] != "g_coding" || got[1] != "g_coding" || got[2] != "g_coding" {
+		t.Errorf("gems sent = %q", got)
+	}
+
+	_, err := client.GenerateContent(ctx, "hello", providers.WithModel("gem:unknown"))
+	if kind := providers.AsError(err).Kind; kind != providers.ErrModelUnavailable {
+		t.Errorf("unknown gem: error kind = %s", kind)
+	}
+}
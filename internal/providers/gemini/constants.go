@@ -1,13 +1,89 @@
 package gemini
 
+import (
+	"net/url"
+	"strings"
+
+	"gemini-web-to-api/internal/cookieimport"
+)
+
+// Paths of the web app endpoints, shared by Google's hosts and a fake server
+const (
+	PathInit          = "/app"
+	PathGenerate      = "/_/BardChatUi/data/assistant.lamda.BardFrontendService/StreamGenerate"
+	PathBatchExec     = "/_/BardChatUi/data/batchexecute"
+	PathRotateCookies = "/RotateCookies"
+)
+
 const (
 	EndpointGoogle        = "https://www.google.com"
-	EndpointInit          = "https://gemini.google.com/app"
-	EndpointGenerate      = "https://gemini.google.com/_/BardChatUi/data/assistant.lamda.BardFrontendService/StreamGenerate"
-	EndpointRotateCookies = "https://accounts.google.com/RotateCookies"
-	EndpointBatchExec     = "https://gemini.google.com/_/BardChatUi/data/batchexecute"
+	EndpointApp           = "https://gemini.google.com"
+	EndpointInit          = EndpointApp + PathInit
+	EndpointGenerate      = EndpointApp + PathGenerate
+	EndpointRotateCookies = "https://accounts.google.com" + PathRotateCookies
+	EndpointBatchExec     = EndpointApp + PathBatchExec
+)
+
+// Endpoints are the upstream URLs the client talks to
+type Endpoints struct {
+	Google        string
+	App           string // the app's origin, which the session cookies are scoped to
+	Init          string
+	Generate      string
+	RotateCookies string
+	BatchExec     string
+}
+
+// DefaultEndpoints are Google's
+var DefaultEndpoints = Endpoints{
+	Google:        EndpointGoogle,
+	App:           EndpointApp,
+	Init:          EndpointInit,
+	Generate:      EndpointGenerate,
+	RotateCookies: EndpointRotateCookies,
+	BatchExec:     EndpointBatchExec,
+}
+
+// EndpointsAt serves every endpoint from one base URL, such as a fake server for tests
+func EndpointsAt(baseURL string) Endpoints {
+	base := strings.TrimSuffix(baseURL, "/")
+	return Endpoints{
+		Google:        base,
+		App:           base,
+		Init:          base + PathInit,
+		Generate:      base + PathGenerate,
+		RotateCookies: base + PathRotateCookies,
+		BatchExec:     base + PathBatchExec,
+	}
+}
+
+// cookieScope returns the URL the session cookies are stored for in the jar, and the domain
+// they are widened to; off Google's hosts cookies stay host-only
+func (e Endpoints) cookieScope() (*url.URL, string) {
+	u, err := url.Parse(e.App)
+	if err != nil || u.Host == "" {
+		u, _ = url.Parse(EndpointApp)
+	}
+	u.Path = "/"
+	if strings.HasSuffix(u.Hostname(), "google.com") {
+		return u, cookieimport.GoogleDomain
+	}
+	return u, ""
+}
+
+// batchexecute RPC IDs used by the Gemini web app
+const (
+	RPCReadResearch       = "kwDCne"
+	RPCListConversations  = "MaZiqc"
+	RPCReadConversation   = "hNvQHb"
+	RPCUpdateConversation = "MUAZcd"
+	RPCDeleteConversation = "GzXR5e"
+	RPCListGems           = "CNgdBe"
 )
 
+// ModelHeader selects the model of a StreamGenerate request by its upstream code
+const ModelHeader = "x-goog-ext-525001261-jspb"
+
 var DefaultHeaders = map[string]string{
 	"Content-Type":  "application/x-www-form-urlencoded;charset=utf-8",
 	"Origin":        "https://gemini.google.com",
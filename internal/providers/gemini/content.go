@@ -0,0 +1,239 @@
+package gemini
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gemini-web-to-api/internal/providers"
+)
+
+// candidateMediaIndex is where a candidate carries its images: web images found by search at
+// [1], each as [[[url], ..., ..., ..., alt], ..., [title]], and images the model generated at
+// [7][0], each as [[..., ..., ..., [..., ..., ..., url]], ..., ..., [..., ..., ..., ..., ..., [alt]]]
+const candidateMediaIndex = 12
+
+// imagePlaceholder marks where a generated image goes in the answer text, by its index
+var imagePlaceholder = regexp.MustCompile(`https?://googleusercontent\.com/image_generation_content/(\d+)`)
+
+// candidateImages returns the images the model generated and those it found on the web
+func candidateImages(candidate []interface{}) (generated, web []providers.Image) {
+	media := arrayAt(candidate, candidateMediaIndex)
+	for _, entry := range arrayAt(media, 1) {
+		img, _ := entry.([]interface{})
+		url := stringAt(arrayAt(arrayAt(img, 0), 0), 0)
+		if url == "" {
+			continue
+		}
+		web = append(web, providers.Image{
+			URL:     url,
+			Title:   stringAt(arrayAt(img, 7), 0),
+			AltText: stringAt(arrayAt(img, 0), 4),
+		})
+	}
+	for _, entry := range arrayAt(arrayAt(media, 7), 0) {
+		img, _ := entry.([]interface{})
+		url := stringAt(arrayAt(arrayAt(img, 0), 3), 3)
+		if url == "" {
+			continue
+		}
+		generated = append(generated, providers.Image{
+			URL:     url,
+			Title:   fmt.Sprintf("Generated image %d", len(generated)+1),
+			AltText: stringAt(arrayAt(arrayAt(img, 3), 5), 0),
+		})
+	}
+	return generated, web
+}
+
+// placeImages replaces the placeholders of generated images in text with markdown images,
+// moving the citations that follow them. Placeholders without an image are removed.
+func placeImages(text string, generated []providers.Image, citations []providers.Citation) (string, []providers.Citation) {
+	matches := imagePlaceholder.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text, citations
+	}
+
+	var out strings.Builder
+	pos := 0
+	shifts := make([]int, len(matches)) // growth of the text once past each placeholder
+	for i, m := range matches {
+		out.WriteString(text[pos:m[0]])
+		if n, err := strconv.Atoi(text[m[2]:m[3]]); err == nil && n < len(generated) {
+			out.WriteString(markdownImage(generated[n]))
+		}
+		pos = m[1]
+		shifts[i] = out.Len() - pos
+	}
+	out.WriteString(text[pos:])
+
+	// An offset moves by the growth up to the last placeholder before it
+	move := func(offset int) (int, bool) {
+		shift := 0
+		for i, m := range matches {
+			if offset <= m[0] {
+				break
+			}
+			if offset < m[1] {
+				return 0, false // inside a placeholder
+			}
+			shift = shifts[i]
+		}
+		return offset + shift, true
+	}
+	var moved []providers.Citation
+	for _, citation := range citations {
+		start, ok1 := move(citation.Start)
+		end, ok2 := move(citation.End)
+		if ok1 && ok2 {
+			citation.Start, citation.End = start, end
+			moved = append(moved, citation)
+		}
+	}
+	return out.String(), moved
+}
+
+// markdownImage renders an image as a markdown image
+func markdownImage(img providers.Image) string {
+	alt := img.AltText
+	if alt == "" {
+		alt = img.Title
+	}
+	return fmt.Sprintf("![%s](%s)", alt, img.URL)
+}
+
+// markdownImageLine matches a line holding nothing but a markdown image
+var markdownImageLine = regexp.MustCompile(`^!\[([^\]]*)\]\((\S+)\)$`)
+
+// outputFences are the fence tags of blocks that hold the output of running code
+var outputFences = map[string]bool{"code_output": true, "output": true}
+
+// contentParts splits markdown text into typed parts: fenced code blocks, their execution
+// output, pipe tables and lone images, with the prose around them as text parts. Lone images
+// that were generated keep their details; web images, which the web app shows beside the
+// text, are appended as parts of their own.
+func contentParts(text string, generated, web []providers.Image) []providers.Part {
+	var (
+		parts     []providers.Part
+		textStart = -1 // start of the pending text part
+		pos       int  // start of the current line
+	)
+	flushText := func(end int) {
+		if textStart >= 0 && strings.TrimSpace(text[textStart:end]) != "" {
+			parts = append(parts, providers.Part{Type: providers.PartText, Text: text[textStart:end], Start: textStart, End: end})
+		}
+		textStart = -1
+	}
+	lineAt := func(at int) (string, int) { // the line starting at at, and the start of the next one
+		end := strings.IndexByte(text[at:], '\n')
+		if end < 0 {
+			return text[at:], len(text)
+		}
+		return text[at : at+end], at + end + 1
+	}
+
+	for pos < len(text) {
+		line, next := lineAt(pos)
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence := trimmed[:3]
+			tag := strings.TrimSpace(trimmed[3:])
+			var body []string
+			end := next
+			closed := false
+			for end < len(text) {
+				l, n := lineAt(end)
+				end = n
+				if strings.TrimSpace(l) == fence {
+					closed = true
+					break
+				}
+				body = append(body, l)
+			}
+			if !closed {
+				break // an unterminated fence is left as text
+			}
+			flushText(pos)
+			part := providers.Part{Type: providers.PartCode, Text: strings.Join(body, "\n"), Language: tag, Start: pos, End: end}
+			if outputFences[strings.ToLower(tag)] {
+				part.Type, part.Language, part.Outcome = providers.PartCodeResult, "", executionOutcome(part.Text)
+			}
+			parts = append(parts, part)
+			pos = end
+			continue
+
+		case strings.HasPrefix(trimmed, "|"):
+			var lines []string
+			end := pos
+			for end < len(text) {
+				l, n := lineAt(end)
+				if !strings.HasPrefix(strings.TrimSpace(l), "|") {
+					break
+				}
+				lines = append(lines, strings.TrimSpace(l))
+				end = n
+			}
+			table, ok := parseMarkdownTable(lines)
+			if !ok {
+				break
+			}
+			flushText(pos)
+			parts = append(parts, providers.Part{Type: providers.PartTable, Text: text[pos:end], Table: &table, Start: pos, End: end})
+			pos = end
+			continue
+
+		default:
+			if m := markdownImageLine.FindStringSubmatch(trimmed); m != nil {
+				flushText(pos)
+				img := &providers.Image{URL: m[2], AltText: m[1]}
+				for i := range generated {
+					if generated[i].URL == img.URL {
+						img = &generated[i]
+					}
+				}
+				parts = append(parts, providers.Part{Type: providers.PartImage, Image: img, Start: pos, End: next})
+				pos = next
+				continue
+			}
+		}
+
+		if textStart < 0 {
+			textStart = pos
+		}
+		pos = next
+	}
+	flushText(len(text))
+
+	for i := range web {
+		parts = append(parts, providers.Part{Type: providers.PartImage, Image: &web[i], Start: len(text), End: len(text)})
+	}
+	return parts
+}
+
+// executionOutcome tells a failed run by the traceback it printed
+func executionOutcome(output string) string {
+	if strings.Contains(output, "Traceback (most recent call last)") {
+		return "failed"
+	}
+	return "ok"
+}
+
+func arrayAt(v interface{}, i int) []interface{} {
+	arr, ok := v.([]interface{})
+	if !ok || i >= len(arr) {
+		return nil
+	}
+	out, _ := arr[i].([]interface{})
+	return out
+}
+
+func stringAt(arr []interface{}, i int) string {
+	if i >= len(arr) {
+		return ""
+	}
+	s, _ := arr[i].(string)
+	return s
+}
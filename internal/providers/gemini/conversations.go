@@ -0,0 +1,197 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gemini-web-to-api/internal/providers"
+
+	"go.uber.org/zap"
+)
+
+const (
+	defaultConversationListLimit = 20
+	defaultConversationTurnLimit = 10
+)
+
+// ListConversations returns the most recent conversations in the account history
+func (c *Client) ListConversations(ctx context.Context, limit int) ([]providers.Conversation, error) {
+	if limit <= 0 {
+		limit = defaultConversationListLimit
+	}
+
+	// [page_size, page_token, [pinned_only, nil, 1]]
+	payload, err := c.BatchExecute(ctx, RPCListConversations, []interface{}{limit, nil, []interface{}{0, nil, 1}})
+	if err != nil {
+		return nil, fmt.Errorf("list conversations failed: %w", err)
+	}
+
+	conversations := []providers.Conversation{}
+	if len(payload) == 0 {
+		return conversations, nil
+	}
+
+	entries, _ := payload[0].([]interface{})
+	for _, entry := range entries {
+		// [cid, title, pinned, ..., [seconds, nanos]]
+		entryArr, ok := entry.([]interface{})
+		if !ok || len(entryArr) < 2 {
+			continue
+		}
+
+		id, _ := entryArr[0].(string)
+		if id == "" {
+			continue
+		}
+		title, _ := entryArr[1].(string)
+
+		conv := providers.Conversation{
+			ID:        id,
+			Title:     title,
+			UpdatedAt: findTimestamp(entryArr[2:]),
+		}
+		if len(entryArr) > 2 {
+			conv.Pinned, _ = entryArr[2].(bool)
+		}
+		conversations = append(conversations, conv)
+
+		if len(conversations) >= limit {
+			break
+		}
+	}
+
+	return conversations, nil
+}
+
+// GetConversation returns the turns of a conversation, oldest first
+func (c *Client) GetConversation(ctx context.Context, conversationID string, limit int) ([]providers.ConversationTurn, error) {
+	if conversationID == "" {
+		return nil, errors.New("missing conversation ID")
+	}
+	if limit <= 0 {
+		limit = defaultConversationTurnLimit
+	}
+
+	payload, err := c.BatchExecute(ctx, RPCReadConversation, []interface{}{conversationID, limit, nil, 1, []interface{}{0}, []interface{}{4}, nil, 1})
+	if err != nil {
+		return nil, fmt.Errorf("read conversation failed: %w", err)
+	}
+
+	turns := []providers.ConversationTurn{}
+	if len(payload) == 0 {
+		return turns, nil
+	}
+
+	entries, _ := payload[0].([]interface{})
+	for _, entry := range entries {
+		// [[cid, rid], nil, [[prompt], ...], [[[rcid, [reply]], ...]], [seconds, nanos]]
+		entryArr, ok := entry.([]interface{})
+		if !ok || len(entryArr) < 4 {
+			continue
+		}
+
+		turn := providers.ConversationTurn{}
+
+		if ids, ok := entryArr[0].([]interface{}); ok && len(ids) > 1 {
+			turn.ResponseID, _ = ids[1].(string)
+		}
+
+		if promptArr, ok := entryArr[2].([]interface{}); ok && len(promptArr) > 0 {
+			if parts, ok := promptArr[0].([]interface{}); ok && len(parts) > 0 {
+				turn.Prompt, _ = parts[0].(string)
+			}
+		}
+
+		if replyArr, ok := entryArr[3].([]interface{}); ok && len(replyArr) > 0 {
+			if candidates, ok := replyArr[0].([]interface{}); ok && len(candidates) > 0 {
+				if candidate, ok := candidates[0].([]interface{}); ok && len(candidate) > 1 {
+					turn.ChoiceID, _ = candidate[0].(string)
+					if parts, ok := candidate[1].([]interface{}); ok && len(parts) > 0 {
+						turn.Reply, _ = parts[0].(string)
+					}
+				}
+			}
+		}
+
+		if len(entryArr) > 4 {
+			turn.CreatedAt = findTimestamp(entryArr[4:])
+		}
+
+		turns = append(turns, turn)
+	}
+
+	// Upstream returns the newest turn first
+	for i, j := 0, len(turns)-1; i < j; i, j = i+1, j-1 {
+		turns[i], turns[j] = turns[j], turns[i]
+	}
+
+	return turns, nil
+}
+
+// RenameConversation sets the title of a conversation
+func (c *Client) RenameConversation(ctx context.Context, conversationID string, title string) error {
+	if conversationID == "" {
+		return errors.New("missing conversation ID")
+	}
+	if title == "" {
+		return errors.New("title cannot be empty")
+	}
+
+	// [nil, [[field_mask], [cid, title]]]
+	_, err := c.BatchExecute(ctx, RPCUpdateConversation, []interface{}{nil, []interface{}{[]interface{}{"title"}, []interface{}{conversationID, title}}})
+	if err != nil {
+		return fmt.Errorf("rename conversation failed: %w", err)
+	}
+
+	c.log.Info("Conversation renamed", zap.String("conversation_id", conversationID))
+	return nil
+}
+
+// PinConversation pins or unpins a conversation
+func (c *Client) PinConversation(ctx context.Context, conversationID string, pinned bool) error {
+	if conversationID == "" {
+		return errors.New("missing conversation ID")
+	}
+
+	// [nil, [[field_mask], [cid, nil, pinned]]]
+	_, err := c.BatchExecute(ctx, RPCUpdateConversation, []interface{}{nil, []interface{}{[]interface{}{"pinned"}, []interface{}{conversationID, nil, pinned}}})
+	if err != nil {
+		return fmt.Errorf("pin conversation failed: %w", err)
+	}
+
+	c.log.Info("Conversation pin updated", zap.String("conversation_id", conversationID), zap.Bool("pinned", pinned))
+	return nil
+}
+
+// DeleteConversation removes a conversation from the account history
+func (c *Client) DeleteConversation(ctx context.Context, conversationID string) error {
+	if conversationID == "" {
+		return errors.New("missing conversation ID")
+	}
+
+	_, err := c.BatchExecute(ctx, RPCDeleteConversation, []interface{}{conversationID})
+	if err != nil {
+		return fmt.Errorf("delete conversation failed: %w", err)
+	}
+
+	c.log.Info("Conversation deleted", zap.String("conversation_id", conversationID))
+	return nil
+}
+
+// findTimestamp returns the first [seconds, nanos] pair among fields
+func findTimestamp(fields []interface{}) time.Time {
+	for _, field := range fields {
+		pair, ok := field.([]interface{})
+		if !ok || len(pair) != 2 {
+			continue
+		}
+		sec, ok1 := pair[0].(float64)
+		nanos, ok2 := pair[1].(float64)
+		if ok1 && ok2 && sec > 0 {
+			return time.Unix(int64(sec), int64(nanos))
+		}
+	}
+	return time.Time{}
+}
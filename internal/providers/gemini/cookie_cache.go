@@ -0,0 +1,274 @@
+package gemini
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gemini-web-to-api/internal/config"
+
+	"go.uber.org/zap"
+)
+
+// CachedCookies is the cookie set persisted for one account
+type CachedCookies struct {
+	Account   string            `json:"account,omitempty"`
+	Cookies   map[string]string `json:"cookies"` // name -> value, session cookies included
+	RotatedAt time.Time         `json:"rotated_at"`
+	SavedAt   time.Time         `json:"saved_at"`
+}
+
+// CookieCache persists rotated cookies between restarts, keyed by an opaque account key.
+// Load returns an error wrapping os.ErrNotExist when nothing is cached.
+type CookieCache interface {
+	Load(key string) (*CachedCookies, error)
+	Save(key string, cookies *CachedCookies) error
+	Delete(key string) error
+}
+
+// KeySource provides the encryption key of the cookie cache
+type KeySource interface {
+	Key() ([]byte, error)
+}
+
+// EnvKey is a key given directly: 32 bytes encoded as hex or base64, or a passphrase that is hashed
+type EnvKey string
+
+func (k EnvKey) Key() ([]byte, error) {
+	return decodeKey(string(k)), nil
+}
+
+// FileKey reads the key from a file, generating a random one when the file does not exist
+type FileKey string
+
+func (k FileKey) Key() ([]byte, error) {
+	path := string(k)
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return decodeKey(strings.TrimSpace(string(data))), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read cookie cache key file: %w", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(path, []byte(hex.EncodeToString(key)+"\n"), 0600); err != nil {
+		return nil, fmt.Errorf("failed to create cookie cache key file: %w", err)
+	}
+	return key, nil
+}
+
+// decodeKey accepts a 32-byte key as hex or base64; anything else is treated as a passphrase
+func decodeKey(s string) []byte {
+	if b, err := hex.DecodeString(s); err == nil && len(b) == 32 {
+		return b
+	}
+	if b, err := base64.StdEncoding.DecodeString(s); err == nil && len(b) == 32 {
+		return b
+	}
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
+
+// NewCookieCache returns the encrypted file cache when a key is configured, the plain file cache otherwise
+func NewCookieCache(cfg config.CookieCacheConfig, log *zap.Logger) (CookieCache, error) {
+	dir := cfg.Dir
+	if dir == "" {
+		dir = ".cookies"
+	}
+
+	var source KeySource
+	switch {
+	case cfg.Key != "":
+		source = EnvKey(cfg.Key)
+	case cfg.KeyFile != "":
+		source = FileKey(cfg.KeyFile)
+	default:
+		log.Warn("Cookie cache is not encrypted; set COOKIE_CACHE_KEY or COOKIE_CACHE_KEY_FILE", zap.String("dir", dir))
+		return &FileCookieCache{Dir: dir}, nil
+	}
+
+	key, err := source.Key()
+	if err != nil {
+		return nil, err
+	}
+	return NewEncryptedFileCookieCache(dir, key)
+}
+
+// FileCookieCache stores each account's cookies as a plain JSON file
+type FileCookieCache struct {
+	Dir string
+}
+
+func (f *FileCookieCache) path(key string) string {
+	return filepath.Join(f.Dir, key+".json")
+}
+
+func (f *FileCookieCache) Load(key string) (*CachedCookies, error) {
+	data, err := os.ReadFile(f.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return loadLegacyCache(f.Dir, key)
+		}
+		return nil, err
+	}
+	return decodeCachedCookies(data)
+}
+
+func (f *FileCookieCache) Save(key string, cookies *CachedCookies) error {
+	data, err := json.Marshal(cookies)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(f.path(key), data, 0600)
+}
+
+func (f *FileCookieCache) Delete(key string) error {
+	return removeCacheFiles(f.path(key), legacyCachePath(f.Dir, key))
+}
+
+// EncryptedFileCookieCache stores each account's cookies AES-GCM encrypted
+type EncryptedFileCookieCache struct {
+	Dir  string
+	aead cipher.AEAD
+}
+
+func NewEncryptedFileCookieCache(dir string, key []byte) (*EncryptedFileCookieCache, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cookie cache key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &EncryptedFileCookieCache{Dir: dir, aead: aead}, nil
+}
+
+func (e *EncryptedFileCookieCache) path(key string) string {
+	return filepath.Join(e.Dir, key+".enc")
+}
+
+func (e *EncryptedFileCookieCache) Load(key string) (*CachedCookies, error) {
+	data, err := os.ReadFile(e.path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return loadLegacyCache(e.Dir, key)
+		}
+		return nil, err
+	}
+
+	nonceSize := e.aead.NonceSize()
+	if len(data) < nonceSize {
+		return nil, errors.New("cookie cache file is truncated")
+	}
+	// The account key is bound as additional data so files cannot be swapped between accounts
+	plain, err := e.aead.Open(nil, data[:nonceSize], data[nonceSize:], []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt cookie cache (wrong key?): %w", err)
+	}
+	return decodeCachedCookies(plain)
+}
+
+func (e *EncryptedFileCookieCache) Save(key string, cookies *CachedCookies) error {
+	plain, err := json.Marshal(cookies)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, e.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	sealed := e.aead.Seal(nonce, nonce, plain, []byte(key))
+	if err := writeFileAtomic(e.path(key), sealed, 0600); err != nil {
+		return err
+	}
+
+	// Do not leave a plaintext copy from before encryption was enabled
+	_ = removeCacheFiles(filepath.Join(e.Dir, key+".json"), legacyCachePath(e.Dir, key))
+	return nil
+}
+
+func (e *EncryptedFileCookieCache) Delete(key string) error {
+	return removeCacheFiles(e.path(key), filepath.Join(e.Dir, key+".json"), legacyCachePath(e.Dir, key))
+}
+
+func decodeCachedCookies(data []byte) (*CachedCookies, error) {
+	var cached CachedCookies
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, fmt.Errorf("invalid cookie cache: %w", err)
+	}
+	return &cached, nil
+}
+
+// legacyCachePath is where older versions stored the bare __Secure-1PSIDTS value
+func legacyCachePath(dir, key string) string {
+	return filepath.Join(dir, key+".txt")
+}
+
+func loadLegacyCache(dir, key string) (*CachedCookies, error) {
+	data, err := os.ReadFile(legacyCachePath(dir, key))
+	if err != nil {
+		return nil, err
+	}
+	ts := strings.TrimSpace(string(data))
+	if ts == "" {
+		return nil, fmt.Errorf("empty cache file: %w", os.ErrNotExist)
+	}
+	return &CachedCookies{Cookies: map[string]string{"__Secure-1PSIDTS": ts}}, nil
+}
+
+func removeCacheFiles(paths ...string) error {
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic writes to a temporary file in the same directory and renames it into place,
+// so a crash never leaves a partially written file behind
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
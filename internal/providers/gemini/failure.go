@@ -0,0 +1,189 @@
+package gemini
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gemini-web-to-api/internal/providers"
+)
+
+// FailureKind classifies why an upstream request failed
+type FailureKind string
+
+const (
+	FailureAuth      FailureKind = "auth_expired" // session token or cookies no longer accepted
+	FailureRateLimit FailureKind = "rate_limited"
+	FailureBlocked   FailureKind = "blocked" // IP or account blocked, CAPTCHA page
+	FailureParse     FailureKind = "parse_error"
+	FailureNetwork   FailureKind = "network"
+	FailureUpstream  FailureKind = "upstream"        // any other non-200 answer
+	FailureRefused   FailureKind = "content_blocked" // the safety filters withheld the answer
+	FailureInvalid   FailureKind = "invalid_request" // the request was rejected as malformed or too large
+)
+
+// UpstreamError is a classified failure of a request to Gemini
+type UpstreamError struct {
+	Kind   FailureKind
+	Status int // HTTP status, 0 when no response was received
+	Code   int // Gemini error code from the response payload, if any
+	Err    error
+
+	RetryAfter time.Duration // from the Retry-After header, zero when absent
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Kind, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// FailureKindOf returns the kind of a classified error, or "" for any other error
+func FailureKindOf(err error) FailureKind {
+	if upstreamErr, ok := asUpstreamError(err); ok {
+		return upstreamErr.Kind
+	}
+	return ""
+}
+
+func asUpstreamError(err error) (*UpstreamError, bool) {
+	var upstreamErr *UpstreamError
+	ok := errors.As(err, &upstreamErr)
+	return upstreamErr, ok
+}
+
+// Error codes the web app reports inside an otherwise successful response,
+// as observed by other clients of the same protocol
+const (
+	errorCodeUsageLimit  = 1037
+	errorCodeIPBlocked   = 1060
+	errorCodeModelHeader = 1052
+
+	// The RPC layer reports a request it cannot accept with the google.rpc INVALID_ARGUMENT code
+	errorCodeInvalidArgument = 3
+)
+
+// errorCodePattern finds the error code of a failed wrb.fr item: ["wrb.fr",null,null,null,null,[1037]]
+var errorCodePattern = regexp.MustCompile(`\["wrb\.fr",null,null,null,null,\[(\d+)\]`)
+
+// refusalPattern finds the block reason of an answer the safety filters withheld, which
+// comes instead of the candidates
+var refusalPattern = regexp.MustCompile(`\\?"(SAFETY|PROHIBITED_CONTENT|BLOCKLIST|SPII|RECITATION)\\?"`)
+
+// classifyStatus classifies a non-200 response
+func classifyStatus(status int, header http.Header, body string) *UpstreamError {
+	err := &UpstreamError{
+		Kind:       FailureUpstream,
+		Status:     status,
+		Err:        fmt.Errorf("request failed with status %d", status),
+		RetryAfter: parseRetryAfter(header),
+	}
+	switch {
+	case isBlockedPage(body):
+		err.Kind = FailureBlocked
+	case status == http.StatusTooManyRequests:
+		err.Kind = FailureRateLimit
+	case status == http.StatusRequestEntityTooLarge:
+		err.Kind = FailureInvalid
+		err.Err = errors.New("request is too large")
+	// A stale SNlM0e token is answered with 400, expired cookies with 401 or a login redirect
+	case status == http.StatusBadRequest, status == http.StatusUnauthorized, isLoginPage(body):
+		err.Kind = FailureAuth
+	case status == http.StatusForbidden:
+		err.Kind = FailureBlocked
+	}
+	return err
+}
+
+// classifyParseFailure classifies a 200 response that carried no answer
+func classifyParseFailure(body string, parseErr error) *UpstreamError {
+	err := &UpstreamError{Kind: FailureParse, Status: http.StatusOK, Err: parseErr}
+	if isLoginPage(body) {
+		err.Kind = FailureAuth
+		return err
+	}
+	if m := errorCodePattern.FindStringSubmatch(body); m != nil {
+		err.Code, _ = strconv.Atoi(m[1])
+		switch err.Code {
+		case errorCodeUsageLimit:
+			err.Kind = FailureRateLimit
+			err.Err = fmt.Errorf("usage limit exceeded (code %d)", err.Code)
+		case errorCodeIPBlocked:
+			err.Kind = FailureBlocked
+			err.Err = fmt.Errorf("IP temporarily blocked (code %d)", err.Code)
+		case errorCodeModelHeader:
+			err.Kind = FailureUpstream
+			err.Err = fmt.Errorf("model not available for this account (code %d)", err.Code)
+		case errorCodeInvalidArgument:
+			err.Kind = FailureInvalid
+			err.Err = fmt.Errorf("request rejected as invalid (code %d)", err.Code)
+		default:
+			err.Kind = FailureUpstream
+			err.Err = fmt.Errorf("gemini returned error code %d", err.Code)
+		}
+		return err
+	}
+	if m := refusalPattern.FindStringSubmatch(body); m != nil {
+		err.Kind = FailureRefused
+		err.Err = fmt.Errorf("answer withheld by the safety filters (%s)", m[1])
+	}
+	return err
+}
+
+// toProviderError translates a failure into the provider error taxonomy, keeping it as the cause.
+// Messages never include upstream response bytes.
+func toProviderError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	var providerErr *providers.Error
+	if errors.As(err, &providerErr) {
+		return err
+	}
+	if ctx.Err() != nil || errors.Is(err, context.DeadlineExceeded) {
+		return providers.NewError(providers.ErrTimeout, "the request to Gemini timed out", err)
+	}
+
+	upstreamErr, ok := asUpstreamError(err)
+	if !ok {
+		return providers.NewError(providers.ErrUpstreamUnavailable, "the request to Gemini failed", err)
+	}
+	switch upstreamErr.Kind {
+	case FailureAuth:
+		return providers.NewError(providers.ErrUnauthenticated, "the Gemini session has expired; the server's cookies need to be updated", err)
+	case FailureRateLimit:
+		rateErr := providers.NewError(providers.ErrRateLimited, "Gemini usage limit reached, try again later", err)
+		rateErr.RetryAfter = upstreamErr.RetryAfter
+		return rateErr
+	case FailureBlocked:
+		return providers.NewError(providers.ErrUpstreamUnavailable, "Gemini is temporarily blocking requests from this server", err)
+	case FailureParse:
+		return providers.NewError(providers.ErrUpstreamUnavailable, "Gemini returned a response that could not be read", err)
+	case FailureNetwork:
+		return providers.NewError(providers.ErrUpstreamUnavailable, "Gemini could not be reached", err)
+	case FailureRefused:
+		return providers.NewError(providers.ErrContentBlocked, "Gemini declined to answer the prompt", err)
+	case FailureInvalid:
+		return providers.NewError(providers.ErrInvalidRequest, "Gemini rejected the request as invalid", err)
+	}
+	if upstreamErr.Code == errorCodeModelHeader {
+		return providers.NewError(providers.ErrModelUnavailable, "the model is not available for this account", err)
+	}
+	return providers.NewError(providers.ErrUpstreamUnavailable, "Gemini returned an error", err)
+}
+
+func isLoginPage(body string) bool {
+	return strings.Contains(body, "accounts.google.com/ServiceLogin") ||
+		strings.Contains(body, "accounts.google.com/v3/signin")
+}
+
+func isBlockedPage(body string) bool {
+	return strings.Contains(body, "unusual traffic") || strings.Contains(body, "google.com/sorry/")
+}
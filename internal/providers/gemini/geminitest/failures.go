@@ -0,0 +1,154 @@
+package geminitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf16"
+)
+
+// Failure is a scripted answer that replaces the normal one for a single request
+type Failure struct {
+	Status int         // 0 serves the normal answer, after Delay
+	Header http.Header // extra response headers
+	Body   string
+	Delay  time.Duration // before answering
+	Drop   bool          // close the connection without answering
+}
+
+// ServerError answers 500, as during an upstream outage
+func ServerError() Failure {
+	return Failure{Status: http.StatusInternalServerError, Body: "Internal Server Error"}
+}
+
+// RateLimited answers 429 asking the client to come back after retryAfter
+func RateLimited(retryAfter time.Duration) Failure {
+	header := http.Header{}
+	if retryAfter > 0 {
+		header.Set("Retry-After", strconv.Itoa(int(retryAfter.Seconds())))
+	}
+	return Failure{Status: http.StatusTooManyRequests, Header: header}
+}
+
+// UsageLimit answers 200 with the error code Gemini uses when the account's quota is spent
+func UsageLimit() Failure {
+	return errorCodeFailure(1037)
+}
+
+// IPBlocked answers 200 with the error code Gemini uses for a temporarily blocked IP
+func IPBlocked() Failure {
+	return errorCodeFailure(1060)
+}
+
+// ModelUnavailable answers 200 with the error code for a model the account cannot use
+func ModelUnavailable() Failure {
+	return errorCodeFailure(1052)
+}
+
+// ContentBlocked answers 200 with a frame that carries the safety filters' block reason
+// instead of the candidates, as for a prompt Gemini refuses to answer
+func ContentBlocked() Failure {
+	return Failure{Status: http.StatusOK, Body: frames(
+		[]interface{}{wrbFrame(nil, []interface{}{nil, []interface{}{"c_blocked", "r_blocked"}, nil, nil, nil, nil, nil, nil, "PROHIBITED_CONTENT"})},
+	)}
+}
+
+// InvalidRequest answers 200 with the INVALID_ARGUMENT code of a request Gemini cannot accept
+func InvalidRequest() Failure {
+	return errorCodeFailure(3)
+}
+
+// BlockedPage answers with Google's unusual traffic page
+func BlockedPage() Failure {
+	return Failure{
+		Status: http.StatusTooManyRequests,
+		Body: `<html><body>Our systems have detected unusual traffic from your computer network. ` +
+			`<a href="https://www.google.com/sorry/index">Why did this happen?</a></body></html>`,
+	}
+}
+
+// LoginPage answers 200 with the sign-in page served when the cookies have expired
+func LoginPage() Failure {
+	return Failure{Status: http.StatusOK, Body: loginPage}
+}
+
+// Malformed answers 200 with a body that is not in the frame format
+func Malformed() Failure {
+	return Failure{Status: http.StatusOK, Body: ")]}'\n\n<html>something changed</html>"}
+}
+
+// Disconnect closes the connection without answering
+func Disconnect() Failure {
+	return Failure{Drop: true}
+}
+
+// Slow serves the normal answer after d
+func Slow(d time.Duration) Failure {
+	return Failure{Delay: d}
+}
+
+func errorCodeFailure(code int) Failure {
+	return Failure{Status: http.StatusOK, Body: frames(
+		[]interface{}{[]interface{}{"wrb.fr", nil, nil, nil, nil, []interface{}{code}}},
+		[]interface{}{[]interface{}{"di", 45}, []interface{}{"af.httprm", 44, "-6418345187473283853", 9}},
+	)}
+}
+
+// serve answers with the failure and reports whether the normal answer should follow
+func (f *Failure) serve(w http.ResponseWriter, r *http.Request) bool {
+	if f.Delay > 0 {
+		select {
+		case <-time.After(f.Delay):
+		case <-r.Context().Done():
+			return false
+		}
+	}
+	if f.Drop {
+		if hijacker, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hijacker.Hijack(); err == nil {
+				conn.Close()
+			}
+		}
+		return false
+	}
+	if f.Status == 0 {
+		return true
+	}
+	for name, values := range f.Header {
+		w.Header()[name] = values
+	}
+	w.WriteHeader(f.Status)
+	fmt.Fprint(w, f.Body)
+	return false
+}
+
+// wrbFrame is the envelope of an RPC result: ["wrb.fr", rpcID, "<payload as JSON>", ...]
+func wrbFrame(rpcID interface{}, payload interface{}) []interface{} {
+	data, _ := json.Marshal(payload)
+	return []interface{}{"wrb.fr", rpcID, string(data), nil, nil, nil, "generic"}
+}
+
+// errorFrame is the envelope of a failed RPC
+func errorFrame(rpcID string, code int) []interface{} {
+	return []interface{}{"wrb.fr", rpcID, nil, nil, nil, []interface{}{code}, "generic"}
+}
+
+// writeFrames writes chunks the way the web app streams them
+func writeFrames(w http.ResponseWriter, chunks ...interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	fmt.Fprint(w, frames(chunks...))
+}
+
+// frames encodes chunks behind the anti-XSSI prefix, each preceded by its length in UTF-16
+// code units on a line of its own
+func frames(chunks ...interface{}) string {
+	out := ")]}'\n"
+	for _, chunk := range chunks {
+		data, _ := json.Marshal(chunk)
+		line := string(data) + "\n"
+		out += fmt.Sprintf("\n%d\n%s", len(utf16.Encode([]rune(line))), line)
+	}
+	return out
+}
@@ -0,0 +1,591 @@
+// Package geminitest provides a fake of the Gemini web app for hermetic tests.
+// It serves the session bootstrap page, StreamGenerate, batchexecute and cookie rotation in
+// the wire format of gemini.google.com, keeps track of the session the way Google does, and
+// can be scripted to fail in the ways the real service fails.
+package geminitest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf16"
+
+	"gemini-web-to-api/internal/providers/gemini"
+)
+
+// Endpoint names a fake endpoint, for scripting failures and counting requests
+type Endpoint string
+
+const (
+	Init          Endpoint = "init"
+	Generate      Endpoint = "generate"
+	BatchExecute  Endpoint = "batchexecute"
+	RotateCookies Endpoint = "rotate_cookies"
+)
+
+// The account cookies the fake accepts when it starts
+const (
+	PSID   = "fake-psid"
+	PSIDTS = "fake-psidts-0"
+)
+
+// ModelCodes are the upstream codes of the models the app page lists
+var ModelCodes = map[string]string{
+	"gemini-2.5-flash": "71c2d248d3b102ff",
+	"gemini-2.5-pro":   "4af6c7f5da75d65d",
+}
+
+// ReplyFunc produces the model's answer to a prompt
+type ReplyFunc func(prompt string) string
+
+// Gem is a custom Gem of the account, listed by the CNgdBe RPC
+type Gem struct {
+	ID          string
+	Name        string
+	Description string
+}
+
+// Research is a Deep Research report served by the kwDCne RPC
+type Research struct {
+	Title   string
+	Plan    []string
+	Sources []Source
+	Body    string // markdown report
+}
+
+// Source is a web page a research step browsed, or a search result an answer cites
+type Source struct {
+	Title   string
+	URL     string
+	Snippet string
+}
+
+// Image is an image an answer shows, found on the web or generated by the model
+type Image struct {
+	URL   string
+	Title string
+	Alt   string
+}
+
+// Citation marks the first occurrence of Text in an answer as supported by sources, by index
+type Citation struct {
+	Text    string
+	Sources []int
+}
+
+// Server is a running fake; URL is its base URL, to be used with gemini.EndpointsAt or
+// GEMINI_BASE_URL
+type Server struct {
+	*httptest.Server
+
+	mu            sync.Mutex
+	psidts        string
+	token         string
+	generation    int // bumped when the token or the cookies are renewed
+	conversations int
+	reply         ReplyFunc
+	thinking      ReplyFunc
+	sources       []Source
+	citations     []Citation
+	generated     []Image
+	webImages     []Image
+	research      map[string]Research
+	failures      map[Endpoint][]Failure
+	hits          map[Endpoint]int
+	prompts       []string
+	models        []string
+	gems          []Gem
+	gemsUsed      []string
+}
+
+// NewServer starts a fake that accepts the PSID and PSIDTS cookies and echoes prompts back
+func NewServer() *Server {
+	s := &Server{
+		psidts:   PSIDTS,
+		token:    "fake-at-0",
+		reply:    func(prompt string) string { return "You said: " + prompt },
+		research: make(map[string]Research),
+		failures: make(map[Endpoint][]Failure),
+		hits:     make(map[Endpoint]int),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handleRoot)
+	mux.HandleFunc(gemini.PathInit, s.scripted(Init, s.handleInit))
+	mux.HandleFunc(gemini.PathGenerate, s.scripted(Generate, s.handleGenerate))
+	mux.HandleFunc(gemini.PathBatchExec, s.scripted(BatchExecute, s.handleBatchExecute))
+	mux.HandleFunc(gemini.PathRotateCookies, s.scripted(RotateCookies, s.handleRotateCookies))
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Setenv points the configuration read by config.Load at the fake: its URL and cookies, a
+// temporary cookie cache, no config file and short retry delays
+func (s *Server) Setenv(t testing.TB) {
+	t.Helper()
+	t.Setenv("GEMINI_BASE_URL", s.URL)
+	t.Setenv("GEMINI_1PSID", PSID)
+	t.Setenv("GEMINI_1PSIDTS", PSIDTS)
+	t.Setenv("COOKIE_CACHE_DIR", t.TempDir())
+	t.Setenv("CONFIG_FILE", "")
+	t.Setenv("GEMINI_RETRY_BASE_DELAY", "1")
+	t.Setenv("GEMINI_RETRY_MAX_DELAY", "10")
+}
+
+// SetReply replaces how the fake answers prompts
+func (s *Server) SetReply(fn ReplyFunc) {
+	s.mu.Lock()
+	s.reply = fn
+	s.mu.Unlock()
+}
+
+// SetThinking makes the fake answer like a thinking model, with fn's reasoning for each prompt
+func (s *Server) SetThinking(fn ReplyFunc) {
+	s.mu.Lock()
+	s.thinking = fn
+	s.mu.Unlock()
+}
+
+// SetCitations makes the fake answer like a web-search answer citing sources
+func (s *Server) SetCitations(sources []Source, citations ...Citation) {
+	s.mu.Lock()
+	s.sources, s.citations = sources, citations
+	s.mu.Unlock()
+}
+
+// SetImages makes the fake answer with images: generated ones are placed after the reply
+// text by placeholders, web ones are shown beside it
+func (s *Server) SetImages(generated, web []Image) {
+	s.mu.Lock()
+	s.generated, s.webImages = generated, web
+	s.mu.Unlock()
+}
+
+// AddResearch serves a Deep Research report for a conversation
+func (s *Server) AddResearch(conversationID string, research Research) {
+	s.mu.Lock()
+	s.research[conversationID] = research
+	s.mu.Unlock()
+}
+
+// AddGem lists a custom Gem in the account
+func (s *Server) AddGem(gem Gem) {
+	s.mu.Lock()
+	s.gems = append(s.gems, gem)
+	s.mu.Unlock()
+}
+
+// FailNext makes the next requests to an endpoint fail, one failure per request, in order
+func (s *Server) FailNext(endpoint Endpoint, failures ...Failure) {
+	s.mu.Lock()
+	s.failures[endpoint] = append(s.failures[endpoint], failures...)
+	s.mu.Unlock()
+}
+
+// ExpireToken makes the current SNlM0e token stale, as Google does after a while:
+// StreamGenerate and batchexecute answer 400 until the client fetches a new one
+func (s *Server) ExpireToken() {
+	s.mu.Lock()
+	s.renewLocked()
+	s.mu.Unlock()
+}
+
+// ExpireSession stops accepting the current __Secure-1PSIDTS: the app serves the login page
+// until the client rotates its cookies
+func (s *Server) ExpireSession() {
+	s.mu.Lock()
+	s.renewLocked()
+	s.psidts = fmt.Sprintf("fake-psidts-expired-%d", s.generation)
+	s.mu.Unlock()
+}
+
+// Hits counts the requests an endpoint received, scripted failures included
+func (s *Server) Hits(endpoint Endpoint) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[endpoint]
+}
+
+// Prompts returns the prompts StreamGenerate received, in order
+func (s *Server) Prompts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.prompts...)
+}
+
+// Models returns the model each StreamGenerate request selected, in order; empty for a
+// request that left the choice to the app
+func (s *Server) Models() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.models...)
+}
+
+// Gems returns the Gem ID each StreamGenerate request ran with, in order; empty for a
+// request without a Gem
+func (s *Server) Gems() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.gemsUsed...)
+}
+
+// requestedModel maps the model code a request carries back to the model's ID; an unknown
+// code is returned as is
+func requestedModel(r *http.Request) string {
+	var header []interface{}
+	if err := json.Unmarshal([]byte(r.Header.Get("x-goog-ext-525001261-jspb")), &header); err != nil || len(header) < 5 {
+		return ""
+	}
+	code, _ := header[4].(string)
+	for id, c := range ModelCodes {
+		if c == code {
+			return id
+		}
+	}
+	return code
+}
+
+func (s *Server) renewLocked() {
+	s.generation++
+	s.token = fmt.Sprintf("fake-at-%d", s.generation)
+}
+
+// scripted counts a request and answers it with the next scripted failure, if any
+func (s *Server) scripted(endpoint Endpoint, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.hits[endpoint]++
+		var failure *Failure
+		if queued := s.failures[endpoint]; len(queued) > 0 {
+			failure = &queued[0]
+			s.failures[endpoint] = queued[1:]
+		}
+		s.mu.Unlock()
+
+		if failure == nil || failure.serve(w, r) {
+			next(w, r)
+		}
+	}
+}
+
+// handleRoot stands in for www.google.com and the app's landing page
+func (s *Server) handleRoot(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{Name: "NID", Value: "fake-nid", Path: "/"})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprint(w, "<!doctype html><title>Google</title>")
+}
+
+// handleInit serves the app page carrying the SNlM0e token, or the login page
+func (s *Server) handleInit(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if !s.signedIn(r) {
+		fmt.Fprint(w, loginPage)
+		return
+	}
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+	fmt.Fprintf(w, `<!doctype html><html><head><title>Gemini</title></head><body><script data-id="_gd">`+
+		`window.WIZ_global_data = {"SNlM0e":"%s","cfb2h":"boq_assistant-bard-web-server","models":`+
+		`[["gemini-2.5-flash","%s",1750118400],["gemini-2.5-pro","%s",1750118400]]};</script></body></html>`,
+		token, ModelCodes["gemini-2.5-flash"], ModelCodes["gemini-2.5-pro"])
+}
+
+// handleRotateCookies issues a new __Secure-1PSIDTS to a client holding the account's PSID
+func (s *Server) handleRotateCookies(w http.ResponseWriter, r *http.Request) {
+	if cookieValue(r, "__Secure-1PSID") != PSID {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	s.mu.Lock()
+	s.generation++
+	s.psidts = fmt.Sprintf("fake-psidts-%d", s.generation)
+	psidts := s.psidts
+	s.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{Name: "__Secure-1PSIDTS", Value: psidts, Path: "/"})
+	http.SetCookie(w, &http.Cookie{Name: "__Secure-1PSIDCC", Value: "fake-psidcc", Path: "/"})
+	fmt.Fprint(w, ")]}'\n\n"+`[["identity.hfcr",600]]`)
+}
+
+// handleGenerate answers a StreamGenerate request in its length-prefixed frame format
+func (s *Server) handleGenerate(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+
+	var outer []interface{}
+	if err := json.Unmarshal([]byte(r.PostFormValue("f.req")), &outer); err != nil || len(outer) < 2 {
+		http.Error(w, "bad f.req", http.StatusBadRequest)
+		return
+	}
+	innerJSON, _ := outer[1].(string)
+	var inner []interface{}
+	if err := json.Unmarshal([]byte(innerJSON), &inner); err != nil || len(inner) == 0 {
+		http.Error(w, "bad inner request", http.StatusBadRequest)
+		return
+	}
+	prompt := firstString(inner[0])
+
+	s.mu.Lock()
+	s.prompts = append(s.prompts, prompt)
+	s.models = append(s.models, requestedModel(r))
+	gemID := ""
+	if len(inner) > 19 {
+		gemID, _ = inner[19].(string)
+	}
+	s.gemsUsed = append(s.gemsUsed, gemID)
+	cid := ""
+	if len(inner) > 2 {
+		cid = firstString(inner[2])
+	}
+	if cid == "" {
+		s.conversations++
+		cid = fmt.Sprintf("c_fake%04d", s.conversations)
+	}
+	reply, thinking := s.reply, s.thinking
+	sources, citations := s.sources, s.citations
+	generated, webImages := s.generated, s.webImages
+	s.mu.Unlock()
+
+	rid := fmt.Sprintf("r_fake%d", time.Now().UnixNano())
+	rcid := "rc_" + rid[2:]
+	state := map[string]interface{}{"18": rid}
+
+	deepResearch := len(inner) > 54 && inner[54] != nil
+	var text string
+	switch {
+	case deepResearch && len(outer) > 3:
+		text = "# Research report\n\n" + reply(prompt)
+	case deepResearch:
+		text = "Here's a research plan:\n(1) Search the web\n(2) Write the report"
+		state["26"] = fmt.Sprintf("!fake-state-%s-%s", cid, rid)
+	default:
+		text = reply(prompt)
+		for i := range generated {
+			text += fmt.Sprintf("\n\nhttp://googleusercontent.com/image_generation_content/%d", i)
+		}
+	}
+
+	candidate := []interface{}{rcid, []interface{}{text}, []interface{}{}, nil, nil, nil, true}
+	if len(sources) > 0 && !deepResearch {
+		candidate[2] = grounding(text, sources, citations)
+	}
+	if len(generated)+len(webImages) > 0 && !deepResearch {
+		candidate = append(candidate, make([]interface{}, 13-len(candidate))...)
+		candidate[12] = media(generated, webImages)
+	}
+	if thinking != nil && !deepResearch {
+		// Thinking models carry their reasoning at candidate[37] as [[text]]
+		candidate = append(candidate, make([]interface{}, 37-len(candidate))...)
+		candidate = append(candidate, []interface{}{[]interface{}{thinking(prompt)}})
+	}
+
+	head := []interface{}{nil, []interface{}{cid, rid}, map[string]interface{}{"18": rid}}
+	body := []interface{}{nil, []interface{}{cid, rid}, state, nil, []interface{}{candidate}}
+
+	writeFrames(w,
+		[]interface{}{wrbFrame(nil, head)},
+		[]interface{}{wrbFrame(nil, body)},
+		[]interface{}{[]interface{}{"di", 1234}, []interface{}{"af.httprm", 1233, "-4811337640329488339", 14}},
+		[]interface{}{[]interface{}{"e", 4, nil, nil, 2048}},
+	)
+}
+
+// grounding encodes sources and citations the way web-search answers carry them at candidate[2]:
+// [[[icon, url, title, snippet], ...], [[start, end, [source index, ...]], ...]], offsets in
+// UTF-16 code units
+func grounding(text string, sources []Source, citations []Citation) []interface{} {
+	encodedSources := []interface{}{}
+	for _, source := range sources {
+		encodedSources = append(encodedSources, []interface{}{"", source.URL, source.Title, source.Snippet})
+	}
+	encodedCitations := []interface{}{}
+	for _, citation := range citations {
+		at := strings.Index(text, citation.Text)
+		if at < 0 {
+			continue
+		}
+		start := len(utf16.Encode([]rune(text[:at])))
+		end := start + len(utf16.Encode([]rune(citation.Text)))
+		indexes := []interface{}{}
+		for _, i := range citation.Sources {
+			indexes = append(indexes, i)
+		}
+		encodedCitations = append(encodedCitations, []interface{}{start, end, indexes})
+	}
+	return []interface{}{encodedSources, encodedCitations}
+}
+
+// media encodes images the way answers carry them at candidate[12]: web images at [1],
+// generated ones at [7][0]
+func media(generated, web []Image) []interface{} {
+	encodedWeb := []interface{}{}
+	for _, img := range web {
+		encodedWeb = append(encodedWeb, []interface{}{
+			[]interface{}{[]interface{}{img.URL}, nil, nil, nil, img.Alt},
+			nil, nil, nil, nil, nil, nil,
+			[]interface{}{img.Title},
+		})
+	}
+	encodedGenerated := []interface{}{}
+	for _, img := range generated {
+		encodedGenerated = append(encodedGenerated, []interface{}{
+			[]interface{}{nil, nil, nil, []interface{}{nil, nil, nil, img.URL}},
+			nil, nil,
+			[]interface{}{nil, nil, nil, nil, nil, []interface{}{img.Alt}},
+		})
+	}
+	return []interface{}{nil, encodedWeb, nil, nil, nil, nil, nil, []interface{}{encodedGenerated}}
+}
+
+// handleBatchExecute answers batchexecute RPCs: kwDCne with the stored research, anything
+// else with an empty result
+func (s *Server) handleBatchExecute(w http.ResponseWriter, r *http.Request) {
+	if !s.authorized(w, r) {
+		return
+	}
+
+	rpcID := r.URL.Query().Get("rpcids")
+	var payload interface{} = []interface{}{}
+	if rpcID == gemini.RPCReadResearch {
+		var fReq []interface{}
+		_ = json.Unmarshal([]byte(r.PostFormValue("f.req")), &fReq)
+		var args []interface{}
+		if call := nestedStrings(fReq); len(call) > 1 {
+			_ = json.Unmarshal([]byte(call[1]), &args)
+		}
+		conversationID := firstString(args)
+
+		s.mu.Lock()
+		research, ok := s.research[conversationID]
+		s.mu.Unlock()
+		if !ok {
+			writeFrames(w, []interface{}{errorFrame(rpcID, 5)})
+			return
+		}
+		payload = research.payload()
+	}
+	if rpcID == gemini.RPCListGems {
+		payload = s.gemList(r)
+	}
+
+	writeFrames(w,
+		[]interface{}{wrbFrame(rpcID, payload), []interface{}{"di", 87}, []interface{}{"af.httprm", 87, "-3328155491413417460", 3}},
+		[]interface{}{[]interface{}{"e", 4, nil, nil, 512}},
+	)
+}
+
+// authorized rejects requests with a stale token (400, as Google answers) or without the
+// account's cookies (401)
+func (s *Server) authorized(w http.ResponseWriter, r *http.Request) bool {
+	s.mu.Lock()
+	token := s.token
+	s.mu.Unlock()
+	if !s.signedIn(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return false
+	}
+	if r.PostFormValue("at") != token {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, ")]}'\n\n"+`[["er",null,null,null,null,400,null,null,null,3],["di",10],["af.httprm",10,"-1",0]]`)
+		return false
+	}
+	return true
+}
+
+func (s *Server) signedIn(r *http.Request) bool {
+	s.mu.Lock()
+	psidts := s.psidts
+	s.mu.Unlock()
+	return cookieValue(r, "__Secure-1PSID") == PSID && cookieValue(r, "__Secure-1PSIDTS") == psidts
+}
+
+// payload builds the kwDCne answer: the report sits at data[0][1][4] as
+// [title, plan, steps, ..., body], each step browsing one source
+func (r Research) payload() []interface{} {
+	var plan []string
+	for i, step := range r.Plan {
+		plan = append(plan, fmt.Sprintf("(%d) %s", i+1, step))
+	}
+	steps := []interface{}{}
+	for _, src := range r.Sources {
+		steps = append(steps, []interface{}{
+			"Browsing " + src.Title, []interface{}{src.Title}, nil, nil,
+			[]interface{}{nil, nil, []interface{}{"https://www.google.com/s2/favicons?domain=" + src.URL, src.URL, src.Title, src.Snippet}},
+		})
+	}
+	report := []interface{}{r.Title, strings.Join(plan, "\n"), steps, nil, []interface{}{r.Body}}
+	return []interface{}{[]interface{}{nil, []interface{}{nil, nil, nil, nil, report}}}
+}
+
+// cookieValue reads a cookie from the Cookie header, which the client sets by hand on some
+// requests and through its cookie jar on others
+func cookieValue(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// firstString returns the first string found in nested arrays
+// gemList answers a CNgdBe request: the account's custom Gems for kind 2, no predefined ones
+func (s *Server) gemList(r *http.Request) []interface{} {
+	var fReq []interface{}
+	_ = json.Unmarshal([]byte(r.PostFormValue("f.req")), &fReq)
+	var args []interface{}
+	if call := nestedStrings(fReq); len(call) > 1 {
+		_ = json.Unmarshal([]byte(call[1]), &args)
+	}
+	if len(args) == 0 || args[0] != float64(2) {
+		return []interface{}{}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var entries []interface{}
+	for _, g := range s.gems {
+		entries = append(entries, []interface{}{g.ID, []interface{}{g.Name, g.Description}, []interface{}{"You are " + g.Name}})
+	}
+	return []interface{}{nil, nil, entries}
+}
+
+func firstString(v interface{}) string {
+	if strs := nestedStrings(v); len(strs) > 0 {
+		return strs[0]
+	}
+	return ""
+}
+
+// nestedStrings returns the strings of the innermost array holding any, depth first
+func nestedStrings(v interface{}) []string {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+	var strs []string
+	for _, item := range arr {
+		if s, ok := item.(string); ok {
+			strs = append(strs, s)
+		}
+	}
+	if len(strs) > 0 {
+		return strs
+	}
+	for _, item := range arr {
+		if inner := nestedStrings(item); len(inner) > 0 {
+			return inner
+		}
+	}
+	return nil
+}
+
+const loginPage = `<!doctype html><html><head><title>Gemini</title></head><body>` +
+	`<a href="https://accounts.google.com/ServiceLogin?passive=1209600&continue=https://gemini.google.com/app">Sign in</a>` +
+	`</body></html>`
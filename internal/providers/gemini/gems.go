@@ -0,0 +1,227 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"gemini-web-to-api/internal/providers"
+
+	"go.uber.org/zap"
+)
+
+// GemModelPrefix marks model IDs that route to a Gem, e.g. "gem:coding-partner"
+const GemModelPrefix = "gem:"
+
+const (
+	gemCacheTTL      = 5 * time.Minute
+	gemFetchTimeout  = 15 * time.Second
+	gemListSystem    = 4 // predefined Gems, including hidden ones
+	gemListCustom    = 2 // Gems created by the account
+	gemInnerPosition = 19
+)
+
+// Gem is a custom persona with persistent instructions, managed in the Gemini web UI
+type Gem struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Prompt      string `json:"prompt,omitempty"`
+	Predefined  bool   `json:"predefined"`
+}
+
+// ModelID returns the model ID the Gem is exposed as
+func (g Gem) ModelID() string {
+	return GemModelPrefix + slugify(g.Name)
+}
+
+type gemCache struct {
+	mu         sync.RWMutex
+	gems       []Gem
+	fetchedAt  time.Time
+	refreshing bool             // a background refresh is running
+	firstSeen  map[string]int64 // when each Gem was first listed, by ID, as its creation time
+}
+
+// ListGems fetches the predefined and custom Gems of the account
+func (c *Client) ListGems(ctx context.Context) ([]Gem, error) {
+	var gems []Gem
+	for _, kind := range []int{gemListCustom, gemListSystem} {
+		payload, err := c.BatchExecute(ctx, RPCListGems, []interface{}{kind})
+		if err != nil {
+			return nil, fmt.Errorf("list gems failed: %w", err)
+		}
+		gems = append(gems, parseGems(payload, kind == gemListSystem)...)
+	}
+
+	now := time.Now()
+	c.gems.mu.Lock()
+	if c.gems.firstSeen == nil {
+		c.gems.firstSeen = make(map[string]int64)
+	}
+	for _, g := range gems {
+		if _, ok := c.gems.firstSeen[g.ID]; !ok {
+			c.gems.firstSeen[g.ID] = now.Unix()
+		}
+	}
+	c.gems.gems = gems
+	c.gems.fetchedAt = now
+	c.gems.mu.Unlock()
+
+	return gems, nil
+}
+
+// cachedGems returns the known Gems. Once the cache has expired they are refreshed in the
+// background, and the cached list is served until the refresh is done.
+func (c *Client) cachedGems() []Gem {
+	c.gems.mu.RLock()
+	gems, fetchedAt := c.gems.gems, c.gems.fetchedAt
+	c.gems.mu.RUnlock()
+
+	if time.Since(fetchedAt) >= gemCacheTTL && c.sessionToken() != "" {
+		c.refreshGems()
+	}
+	return gems
+}
+
+// refreshGems re-lists the Gems in the background, unless a refresh is already running
+func (c *Client) refreshGems() {
+	c.gems.mu.Lock()
+	if c.gems.refreshing {
+		c.gems.mu.Unlock()
+		return
+	}
+	c.gems.refreshing = true
+	c.gems.mu.Unlock()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), gemFetchTimeout)
+		defer cancel()
+
+		_, err := c.ListGems(ctx)
+		c.gems.mu.Lock()
+		defer c.gems.mu.Unlock()
+		c.gems.refreshing = false
+		if err != nil {
+			c.log.Warn("Failed to refresh Gems, using cached list", zap.Error(err))
+			// Avoid hammering upstream on every /models call while it is failing
+			c.gems.fetchedAt = time.Now()
+		}
+	}()
+}
+
+// applyGem resolves the Gem a request asks for, by Gem option or "gem:" model ID, and sets
+// config.GemID to the Gem's ID
+func (c *Client) applyGem(config *providers.GenerateConfig) error {
+	key := config.GemID
+	if key == "" && strings.HasPrefix(config.Model, GemModelPrefix) {
+		key = config.Model
+	}
+	if key == "" {
+		return nil
+	}
+	gem, err := c.resolveGem(key)
+	if err != nil {
+		return err
+	}
+	config.GemID = gem.ID
+	return nil
+}
+
+// resolveGem finds the Gem a "gem:" model ID, name or Gem ID refers to
+func (c *Client) resolveGem(model string) (*Gem, error) {
+	key := strings.TrimPrefix(model, GemModelPrefix)
+	for _, g := range c.cachedGems() {
+		if slugify(g.Name) == slugify(key) || strings.EqualFold(g.Name, key) || g.ID == key {
+			gem := g
+			return &gem, nil
+		}
+	}
+	return nil, providers.NewError(providers.ErrModelUnavailable, fmt.Sprintf("unknown gem model: %s", model), nil)
+}
+
+// gemModels exposes the account's Gems as models
+func (c *Client) gemModels() []providers.ModelInfo {
+	gems := c.cachedGems()
+	c.gems.mu.RLock()
+	defer c.gems.mu.RUnlock()
+
+	var models []providers.ModelInfo
+	for _, g := range gems {
+		ownedBy := "user"
+		if g.Predefined {
+			ownedBy = "google"
+		}
+		models = append(models, providers.ModelInfo{
+			ID:          g.ModelID(),
+			Created:     c.gems.firstSeen[g.ID],
+			OwnedBy:     ownedBy,
+			Provider:    "gemini",
+			DisplayName: g.Name,
+			Description: g.Description,
+		})
+	}
+	return models
+}
+
+// parseGems reads [gem_id, [name, description], [prompt, ...], ...] entries
+func parseGems(payload []interface{}, predefined bool) []Gem {
+	if len(payload) < 3 {
+		return nil
+	}
+	entries, ok := payload[2].([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var gems []Gem
+	for _, entry := range entries {
+		entryArr, ok := entry.([]interface{})
+		if !ok || len(entryArr) < 2 {
+			continue
+		}
+
+		gem := Gem{Predefined: predefined}
+		gem.ID, _ = entryArr[0].(string)
+
+		if info, ok := entryArr[1].([]interface{}); ok && len(info) > 0 {
+			gem.Name, _ = info[0].(string)
+			if len(info) > 1 {
+				gem.Description, _ = info[1].(string)
+			}
+		}
+
+		if len(entryArr) > 2 {
+			if prompt, ok := entryArr[2].([]interface{}); ok && len(prompt) > 0 {
+				gem.Prompt, _ = prompt[0].(string)
+			}
+		}
+
+		if gem.ID == "" || gem.Name == "" {
+			continue
+		}
+		gems = append(gems, gem)
+	}
+	return gems
+}
+
+// slugify lowercases a name and joins its words with dashes
+func slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
@@ -0,0 +1,118 @@
+package gemini
+
+import (
+	"sort"
+	"unicode/utf16"
+
+	"gemini-web-to-api/internal/providers"
+)
+
+// candidateGroundingIndex is where a candidate answered with Google Search carries its sources
+// and citations, as [[source, ...], [citation, ...]]. A source has the shape of a research
+// source, [icon, url, title, snippet]; a citation is [start, end, [source index, ...]] with
+// offsets in UTF-16 code units of the candidate text.
+const candidateGroundingIndex = 2
+
+// candidateGrounding returns the sources of a web-search answer and the spans of text they
+// support. Citations pointing outside the text or at unknown sources are dropped.
+func candidateGrounding(candidate []interface{}, text string) ([]providers.Reference, []providers.Citation) {
+	if len(candidate) <= candidateGroundingIndex {
+		return nil, nil
+	}
+	grounding, ok := candidate[candidateGroundingIndex].([]interface{})
+	if !ok || len(grounding) == 0 {
+		return nil, nil
+	}
+
+	var refs []providers.Reference
+	if sources, ok := grounding[0].([]interface{}); ok {
+		for _, source := range sources {
+			// One reference per source entry, even an unusable one, so that indexes line up
+			found := parseSources(source)
+			if len(found) == 0 {
+				found = []providers.Reference{{}}
+			}
+			refs = append(refs, found[0])
+		}
+	}
+	if len(refs) == 0 {
+		return nil, nil
+	}
+
+	var citations []providers.Citation
+	if len(grounding) > 1 {
+		entries, _ := grounding[1].([]interface{})
+		offsets := utf16Offsets(text)
+		for _, entry := range entries {
+			if citation, ok := parseCitation(entry, offsets, refs); ok {
+				citations = append(citations, citation)
+			}
+		}
+	}
+	sort.SliceStable(citations, func(i, j int) bool { return citations[i].Start < citations[j].Start })
+
+	// Keep only the sources that are usable, renumbering the citations
+	index := make(map[int]int, len(refs))
+	var kept []providers.Reference
+	for i, ref := range refs {
+		if ref.URL != "" {
+			index[i] = len(kept)
+			kept = append(kept, ref)
+		}
+	}
+	for i := range citations {
+		var renumbered []int
+		for _, ref := range citations[i].References {
+			if n, ok := index[ref]; ok {
+				renumbered = append(renumbered, n)
+			}
+		}
+		citations[i].References = renumbered
+	}
+	n := 0
+	for _, citation := range citations {
+		if len(citation.References) > 0 {
+			citations[n] = citation
+			n++
+		}
+	}
+	return kept, citations[:n]
+}
+
+// parseCitation reads a [start, end, [source index, ...]] entry
+func parseCitation(entry interface{}, offsets []int, refs []providers.Reference) (providers.Citation, bool) {
+	arr, ok := entry.([]interface{})
+	if !ok || len(arr) < 3 {
+		return providers.Citation{}, false
+	}
+	start, ok1 := arr[0].(float64)
+	end, ok2 := arr[1].(float64)
+	indexes, ok3 := arr[2].([]interface{})
+	if !ok1 || !ok2 || !ok3 || start < 0 || end <= start || int(end) >= len(offsets) {
+		return providers.Citation{}, false
+	}
+
+	citation := providers.Citation{Start: offsets[int(start)], End: offsets[int(end)]}
+	if citation.Start < 0 || citation.End < 0 {
+		return providers.Citation{}, false // inside a surrogate pair
+	}
+	for _, v := range indexes {
+		if i, ok := v.(float64); ok && int(i) >= 0 && int(i) < len(refs) {
+			citation.References = append(citation.References, int(i))
+		}
+	}
+	return citation, len(citation.References) > 0
+}
+
+// utf16Offsets maps each UTF-16 offset of text to its byte offset, -1 where the UTF-16 offset
+// falls inside a character. The slice has an entry for the end of the text.
+func utf16Offsets(text string) []int {
+	offsets := make([]int, 0, len(text)+1)
+	for i, r := range text {
+		offsets = append(offsets, i)
+		if utf16.RuneLen(r) == 2 {
+			offsets = append(offsets, -1)
+		}
+	}
+	return append(offsets, len(text))
+}
@@ -0,0 +1,469 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"gemini-web-to-api/internal/providers"
+
+	"go.uber.org/zap"
+)
+
+// parsedResponse is what the layout strategies extract from a StreamGenerate response
+type parsedResponse struct {
+	text       string
+	thinking   string
+	references []providers.Reference
+	citations  []providers.Citation
+	generated  []providers.Image // images the model made, placed in text by placeholders
+	webImages  []providers.Image
+	cid        string
+	rid        string
+	rcid       string
+	stateToken string
+}
+
+// layoutStrategy reads one known layout of the StreamGenerate payload. Names carry the layout
+// revision: when Google changes the layout, a new strategy goes in front of the old ones
+// instead of the old one being edited, so responses in either layout keep parsing.
+type layoutStrategy struct {
+	name  string
+	parse func(payload []interface{}, into *parsedResponse) // fills fields that are still empty
+}
+
+// layoutStrategies are tried in order; the first one that finds the answer text wins.
+// Any strategy but the first means the layout has drifted.
+var layoutStrategies = []layoutStrategy{
+	{name: "positional-v2", parse: parsePositional},
+	{name: "shape-v1", parse: parseByShape},
+}
+
+// parseResponse parses Gemini's response format.
+// It scans ALL wrb.fr items across all lines to collect:
+//   - response text (from candidates)
+//   - conversation metadata (cid, rid, rcid)
+//   - state token (from dict key "26" in a secondary item, or legacy "!" prefix strings)
+func (c *Client) parseResponse(text string) (*providers.Response, error) {
+	payloads := decodePayloads(text)
+
+	for i, strategy := range layoutStrategies {
+		var parsed parsedResponse
+		for _, payload := range payloads {
+			strategy.parse(payload, &parsed)
+		}
+		if parsed.text == "" {
+			continue
+		}
+
+		c.parser.record(strategy.name)
+		if i > 0 {
+			c.reportDrift(strategy.name, payloads)
+		}
+		text, citations := placeImages(parsed.text, parsed.generated, parsed.citations)
+		return &providers.Response{
+			Text:       text,
+			Thinking:   parsed.thinking,
+			Images:     append(append([]providers.Image{}, parsed.generated...), parsed.webImages...),
+			References: parsed.references,
+			Citations:  citations,
+			Parts:      contentParts(text, parsed.generated, parsed.webImages),
+			Metadata: map[string]any{
+				"cid":         parsed.cid,
+				"rid":         parsed.rid,
+				"rcid":        parsed.rcid,
+				"state_token": parsed.stateToken,
+			},
+		}, nil
+	}
+
+	// Bodies without payloads are error codes or pages, classified by the caller
+	if len(payloads) > 0 {
+		c.parser.record("")
+		c.reportDrift("", payloads)
+	}
+	sample := text
+	if len(sample) > 500 {
+		sample = sample[:500]
+	}
+	return nil, fmt.Errorf("failed to parse response. Sample: %s", sample)
+}
+
+// decodePayloads returns the decoded payload of every wrb.fr item in the response
+func decodePayloads(text string) [][]interface{} {
+	var payloads [][]interface{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		line = strings.TrimPrefix(line, ")]}'")
+
+		var root []interface{}
+		if err := json.Unmarshal([]byte(line), &root); err != nil {
+			continue
+		}
+
+		for _, item := range root {
+			itemArray, ok := item.([]interface{})
+			if !ok || len(itemArray) < 3 {
+				continue
+			}
+
+			payloadStr, ok := itemArray[2].(string)
+			if !ok {
+				continue
+			}
+
+			var payload []interface{}
+			if err := json.Unmarshal([]byte(payloadStr), &payload); err != nil {
+				continue
+			}
+			payloads = append(payloads, payload)
+		}
+	}
+	return payloads
+}
+
+// parsePositional reads the layout the web app has used since conversations got a
+// [cid, rid] pair: candidates at payload[4] as [rcid, [text]], state token at payload[2]["26"],
+// reasoning of thinking models at candidate[37][0][0], web-search sources at candidate[2],
+// images at candidate[12]
+func parsePositional(payload []interface{}, into *parsedResponse) {
+	// Extract cid/rid from payload[1] (string or []string)
+	if len(payload) > 1 && into.cid == "" {
+		switch v := payload[1].(type) {
+		case string:
+			into.cid = v
+		case []interface{}:
+			if len(v) > 0 {
+				if s, ok := v[0].(string); ok {
+					into.cid = s
+				}
+			}
+			if len(v) > 1 && into.rid == "" {
+				if s, ok := v[1].(string); ok {
+					into.rid = s
+				}
+			}
+		}
+	}
+
+	// Extract text from candidates at payload[4]
+	if into.text == "" && len(payload) > 4 {
+		candidates, ok := payload[4].([]interface{})
+		if ok && len(candidates) > 0 {
+			firstCandidate, ok := candidates[0].([]interface{})
+			if ok && len(firstCandidate) >= 2 {
+				contentParts, ok := firstCandidate[1].([]interface{})
+				if ok && len(contentParts) > 0 {
+					if s, ok := contentParts[0].(string); ok {
+						into.text = s
+						into.thinking = candidateThinking(firstCandidate)
+						into.references, into.citations = candidateGrounding(firstCandidate, s)
+						into.generated, into.webImages = candidateImages(firstCandidate)
+						if id, ok := firstCandidate[0].(string); ok {
+							into.rcid = id
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Extract state token: new format is a dict with key "26" at payload[2]
+	if into.stateToken == "" && len(payload) > 2 {
+		if m, ok := payload[2].(map[string]interface{}); ok {
+			if s, ok := m["26"].(string); ok && len(s) > 10 {
+				into.stateToken = s
+			}
+		}
+	}
+
+	// Legacy state token: recursive search for string starting with '!'
+	if into.stateToken == "" {
+		into.stateToken = extractStateToken(payload)
+	}
+}
+
+// candidateThinkingIndex is where a candidate of a thinking model carries its reasoning, as [[text]]
+const candidateThinkingIndex = 37
+
+// candidateThinking returns the reasoning text of a candidate, empty for models that do not think
+func candidateThinking(candidate []interface{}) string {
+	if len(candidate) <= candidateThinkingIndex {
+		return ""
+	}
+	outer, ok := candidate[candidateThinkingIndex].([]interface{})
+	if !ok || len(outer) == 0 {
+		return ""
+	}
+	inner, ok := outer[0].([]interface{})
+	if !ok || len(inner) == 0 {
+		return ""
+	}
+	thinking, _ := inner[0].(string)
+	return thinking
+}
+
+// Identifier shapes: conversation "c_…", response "r_…" and candidate "rc_…" IDs
+var (
+	conversationIDPattern = regexp.MustCompile(`^c_[0-9A-Za-z]+$`)
+	responseIDPattern     = regexp.MustCompile(`^r_[0-9A-Za-z]+$`)
+	candidateIDPattern    = regexp.MustCompile(`^rc_[0-9A-Za-z]+$`)
+)
+
+// parseByShape finds the answer wherever it moved to: IDs by their prefix, and the text as
+// the first string of the array that follows a candidate ID, [rcid, [text, ...], ...]
+func parseByShape(payload []interface{}, into *parsedResponse) {
+	walkPayload(payload, 0, func(v interface{}) {
+		switch val := v.(type) {
+		case string:
+			switch {
+			case into.cid == "" && conversationIDPattern.MatchString(val):
+				into.cid = val
+			case into.rid == "" && responseIDPattern.MatchString(val):
+				into.rid = val
+			}
+		case []interface{}:
+			if into.text != "" || len(val) < 2 {
+				return
+			}
+			id, ok := val[0].(string)
+			if !ok || !candidateIDPattern.MatchString(id) {
+				return
+			}
+			if parts, ok := val[1].([]interface{}); ok && len(parts) > 0 {
+				if s, ok := parts[0].(string); ok && s != "" {
+					into.text = s
+					into.thinking = candidateThinking(val)
+					into.references, into.citations = candidateGrounding(val, s)
+					into.generated, into.webImages = candidateImages(val)
+					into.rcid = id
+				}
+			}
+		}
+	})
+
+	if into.stateToken == "" {
+		into.stateToken = extractStateToken(payload)
+	}
+}
+
+// maxPayloadDepth bounds the walk over payloads, which nest about ten levels deep
+const maxPayloadDepth = 32
+
+// walkPayload calls visit on v and everything nested in it, depth first
+func walkPayload(v interface{}, depth int, visit func(interface{})) {
+	if depth > maxPayloadDepth {
+		return
+	}
+	visit(v)
+	switch val := v.(type) {
+	case []interface{}:
+		for _, item := range val {
+			walkPayload(item, depth+1, visit)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			walkPayload(val[key], depth+1, visit)
+		}
+	}
+}
+
+func extractStateToken(v interface{}) string {
+	switch val := v.(type) {
+	case string:
+		if strings.HasPrefix(val, "!") && len(val) > 20 {
+			return val
+		}
+	case []interface{}:
+		for _, item := range val {
+			if token := extractStateToken(item); token != "" {
+				return token
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range val {
+			if token := extractStateToken(item); token != "" {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+// DriftReport describes a response whose layout the primary strategy did not recognize.
+// Layouts show structure only: strings are replaced by their kind and length.
+type DriftReport struct {
+	At        time.Time `json:"at"`
+	Strategy  string    `json:"strategy,omitempty"` // the fallback that parsed it, empty if none did
+	Layouts   []string  `json:"layouts"`            // skeleton of each wrb.fr payload
+	TextPaths []string  `json:"text_paths"`         // where the longest strings are, likely the answer
+}
+
+// ParserStatus counts responses by the layout strategy that parsed them
+type ParserStatus struct {
+	Strategies map[string]int `json:"strategies"`
+	Fallbacks  int            `json:"fallbacks"` // parsed by a strategy other than the first
+	Failures   int            `json:"failures"`  // parsed by none
+	LastDrift  *DriftReport   `json:"last_drift,omitempty"`
+}
+
+type parserStats struct {
+	mu        sync.Mutex
+	counts    map[string]int
+	failures  int
+	lastDrift *DriftReport
+}
+
+// record counts a parsed response; an empty strategy counts a failure
+func (s *parserStats) record(strategy string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if strategy == "" {
+		s.failures++
+		return
+	}
+	if s.counts == nil {
+		s.counts = make(map[string]int)
+	}
+	s.counts[strategy]++
+}
+
+func (s *parserStats) status() ParserStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	status := ParserStatus{Strategies: make(map[string]int), Failures: s.failures}
+	for name, n := range s.counts {
+		status.Strategies[name] = n
+		if name != layoutStrategies[0].name {
+			status.Fallbacks += n
+		}
+	}
+	if s.lastDrift != nil {
+		drift := *s.lastDrift
+		status.LastDrift = &drift
+	}
+	return status
+}
+
+// reportDrift logs the layout of a response the primary strategy could not read and keeps it
+// for the admin status
+func (c *Client) reportDrift(strategy string, payloads [][]interface{}) {
+	report := newDriftReport(strategy, payloads)
+	c.parser.mu.Lock()
+	c.parser.lastDrift = report
+	c.parser.mu.Unlock()
+
+	fields := []zap.Field{
+		zap.String("primary", layoutStrategies[0].name),
+		zap.Strings("layouts", report.Layouts),
+		zap.Strings("text_paths", report.TextPaths),
+	}
+	if strategy == "" {
+		c.log.Error("Unknown Gemini response layout, no parser strategy matched", fields...)
+		return
+	}
+	c.log.Warn("Gemini response layout drifted, parsed with a fallback strategy",
+		append(fields, zap.String("strategy", strategy))...)
+}
+
+// maxTextPaths is how many string locations a drift report lists
+const maxTextPaths = 5
+
+func newDriftReport(strategy string, payloads [][]interface{}) *DriftReport {
+	report := &DriftReport{At: time.Now(), Strategy: strategy}
+
+	type located struct {
+		path   string
+		length int
+	}
+	var found []located
+	for i, payload := range payloads {
+		report.Layouts = append(report.Layouts, layoutSkeleton(payload, 0))
+		collectStrings(payload, fmt.Sprintf("payload%d", i), 0, func(path string, s string) {
+			found = append(found, located{path, len(s)})
+		})
+	}
+
+	sort.SliceStable(found, func(i, j int) bool { return found[i].length > found[j].length })
+	for i := 0; i < len(found) && i < maxTextPaths; i++ {
+		report.TextPaths = append(report.TextPaths, fmt.Sprintf("%s (%d bytes)", found[i].path, found[i].length))
+	}
+	return report
+}
+
+// layoutSkeleton renders a payload's structure without its content, e.g.
+// [null,[cid,rid],{"26":token},null,[[rcid,[str(42)]]]]
+func layoutSkeleton(v interface{}, depth int) string {
+	if depth > maxPayloadDepth {
+		return "…"
+	}
+	switch val := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case float64:
+		return "num"
+	case string:
+		switch {
+		case conversationIDPattern.MatchString(val):
+			return "cid"
+		case responseIDPattern.MatchString(val):
+			return "rid"
+		case candidateIDPattern.MatchString(val):
+			return "rcid"
+		case strings.HasPrefix(val, "!") && len(val) > 20:
+			return "token"
+		}
+		return fmt.Sprintf("str(%d)", len(val))
+	case []interface{}:
+		parts := make([]string, len(val))
+		for i, item := range val {
+			parts[i] = layoutSkeleton(item, depth+1)
+		}
+		return "[" + strings.Join(parts, ",") + "]"
+	case map[string]interface{}:
+		keys := make([]string, 0, len(val))
+		for key := range val {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		parts := make([]string, len(keys))
+		for i, key := range keys {
+			parts[i] = fmt.Sprintf("%q:%s", key, layoutSkeleton(val[key], depth+1))
+		}
+		return "{" + strings.Join(parts, ",") + "}"
+	}
+	return "?"
+}
+
+// collectStrings calls visit with the index path of every string in v, e.g. payload0[4][0][1][0]
+func collectStrings(v interface{}, path string, depth int, visit func(path, s string)) {
+	if depth > maxPayloadDepth {
+		return
+	}
+	switch val := v.(type) {
+	case string:
+		visit(path, val)
+	case []interface{}:
+		for i, item := range val {
+			collectStrings(item, fmt.Sprintf("%s[%d]", path, i), depth+1, visit)
+		}
+	case map[string]interface{}:
+		for key, item := range val {
+			collectStrings(item, fmt.Sprintf("%s[%q]", path, key), depth+1, visit)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package gemini
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"gemini-web-to-api/internal/providers"
+
+	"go.uber.org/zap/zaptest"
+)
+
+// streamBody wraps payloads in wrb.fr items the way StreamGenerate frames them
+func streamBody(payloads ...interface{}) string {
+	out := ")]}'\n"
+	for _, payload := range payloads {
+		data, _ := json.Marshal(payload)
+		item, _ := json.Marshal([]interface{}{[]interface{}{"wrb.fr", nil, string(data)}})
+		out += fmt.Sprintf("\n%d\n%s\n", len(item)+1, item)
+	}
+	return out
+}
+
+func TestParseResponseLayouts(t *testing.T) {
+	token := "!state-token-0123456789abcdef"
+	tests := []struct {
+		name     string
+		body     string
+		strategy string
+	}{
+		{
+			name: "current layout",
+			body: streamBody([]interface{}{nil, []interface{}{"c_1a2b", "r_3c4d"}, map[string]interface{}{"26": token}, nil,
+				[]interface{}{[]interface{}{"rc_5e6f", []interface{}{"Hello"}}}}),
+			strategy: "positional-v2",
+		},
+		{
+			name: "candidates moved and wrapped",
+			body: streamBody([]interface{}{nil, nil, []interface{}{"c_1a2b", "r_3c4d"}, nil, nil, nil,
+				[]interface{}{nil, []interface{}{[]interface{}{"rc_5e6f", []interface{}{"Hello"}, nil, true}}}, token}),
+			strategy: "shape-v1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := &Client{log: zaptest.NewLogger(t)}
+			response, err := c.parseResponse(tt.body)
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if response.Text != "Hello" {
+				t.Errorf("text = %q", response.Text)
+			}
+			for key, want := range map[string]string{"cid": "c_1a2b", "rid": "r_3c4d", "rcid": "rc_5e6f", "state_token": token} {
+				if response.Metadata[key] != want {
+					t.Errorf("%s = %v, want %s", key, response.Metadata[key], want)
+				}
+			}
+
+			status := c.parser.status()
+			if status.Strategies[tt.strategy] != 1 {
+				t.Errorf("strategies = %v, want %s", status.Strategies, tt.strategy)
+			}
+			wantFallbacks := 0
+			if tt.strategy != layoutStrategies[0].name {
+				wantFallbacks = 1
+			}
+			if status.Fallbacks != wantFallbacks || (status.LastDrift != nil) != (wantFallbacks > 0) {
+				t.Errorf("fallbacks = %d, drift report %+v", status.Fallbacks, status.LastDrift)
+			}
+		})
+	}
+}
+
+func TestUnknownLayoutIsReported(t *testing.T) {
+	c := &Client{log: zaptest.NewLogger(t)}
+	body := streamBody([]interface{}{nil, []interface{}{"c_1a2b"}, nil, []interface{}{"an answer nobody can find"}})
+
+	if _, err := c.parseResponse(body); err == nil {
+		t.Fatal("parse should fail")
+	}
+	status := c.parser.status()
+	if status.Failures != 1 || status.LastDrift == nil {
+		t.Fatalf("status = %+v", status)
+	}
+	if got := status.LastDrift.Layouts; len(got) != 1 || got[0] != "[null,[cid],null,[str(25)]]" {
+		t.Errorf("layouts = %q", got)
+	}
+	if got := status.LastDrift.TextPaths; len(got) == 0 || !strings.HasPrefix(got[0], "payload0[3][0]") {
+		t.Errorf("text paths = %q", got)
+	}
+
+	if _, err := c.parseResponse(")]}'\n\n25\n[[\"e\",4,null,null,2048]]\n"); err == nil {
+		t.Fatal("parse should fail")
+	}
+	if c.parser.status().Failures != 1 {
+		t.Error("a body without payloads should not count as drift")
+	}
+}
+
+func TestContentParts(t *testing.T) {
+	text := "Here is the sum:\n\n```python\nprint(1 + 1)\n```\n```code_output\n2\n```\n\n" +
+		"| n | square |\n|---|---|\n| 2 | 4 |\n\nhttp://googleusercontent.com/image_generation_content/0\n\nDone."
+	generated := []providers.Image{{URL: "https://example.com/chart.png", AltText: "chart"}}
+	web := []providers.Image{{URL: "https://example.com/photo.jpg", Title: "Photo"}}
+	citations := []providers.Citation{{Start: strings.Index(text, "Done"), End: len(text), References: []int{0}}}
+
+	text, citations = placeImages(text, generated, citations)
+	if got := text[citations[0].Start:citations[0].End]; got != "Done." {
+		t.Errorf("citation moved to %q", got)
+	}
+
+	parts := contentParts(text, generated, web)
+	var types []string
+	for _, part := range parts {
+		types = append(types, string(part.Type))
+		if part.Start != part.End && part.Type == providers.PartText && text[part.Start:part.End] != part.Text {
+			t.Errorf("text part %q does not match its range", part.Text)
+		}
+	}
+	if got, want := strings.Join(types, ","), "text,code,code_result,table,image,text,image"; got != want {
+		t.Fatalf("parts = %s, want %s", got, want)
+	}
+	if parts[1].Language != "python" || parts[1].Text != "print(1 + 1)" || parts[2].Text != "2" || parts[2].Outcome != "ok" {
+		t.Errorf("code = %+v, result = %+v", parts[1], parts[2])
+	}
+	if table := parts[3].Table; len(table.Rows) != 1 || table.Rows[0][1] != "4" {
+		t.Errorf("table = %+v", table)
+	}
+	if parts[4].Image.URL != generated[0].URL || parts[6].Image.Title != "Photo" {
+		t.Errorf("images = %+v, %+v", parts[4].Image, parts[6].Image)
+	}
+}
+
+func TestDiscoverModels(t *testing.T) {
+	body := `<script>var hint = "try gemini-3-ultra-preview";` +
+		`window.WIZ_global_data = {"SNlM0e":"at","models":[["gemini-2.5-flash","c1",1750118400],["gemini-2.5-pro"],["gemini-2.5-flash","c1"]]};` +
+		`window.other = {"models":[["gemini-1.0-pro"]]};</script>`
+	got := discoverModels(body)
+	if len(got) != 2 {
+		t.Fatalf("models = %+v, want the two entries of the bootstrap list", got)
+	}
+	if got[0].ID != "gemini-2.5-flash" || got[0].Code != "c1" || got[0].Created != 1750118400 {
+		t.Errorf("first model = %+v", got[0])
+	}
+	if got[1].ID != "gemini-2.5-pro" || got[1].Code != "" || got[1].Created != 0 {
+		t.Errorf("second model = %+v", got[1])
+	}
+	if got := discoverModels(`<p>gemini-2.5-flash</p>`); got != nil {
+		t.Errorf("page without bootstrap data: %+v", got)
+	}
+}
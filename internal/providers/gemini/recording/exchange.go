@@ -0,0 +1,154 @@
+// Package recording captures upstream HTTP exchanges as sanitized fixture files and serves
+// them back, so that a response the parsers failed on in production can become a regression test.
+package recording
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Redacted replaces secrets in recorded exchanges
+const Redacted = "REDACTED"
+
+// Exchange is one recorded request and its response
+type Exchange struct {
+	Name       string    `json:"name"` // what was called, e.g. "StreamGenerate" or "batchexecute-kwDCne"
+	RecordedAt time.Time `json:"recorded_at"`
+	Request    Request   `json:"request"`
+	Response   Response  `json:"response"`
+}
+
+type Request struct {
+	Method string      `json:"method"`
+	URL    string      `json:"url"`
+	Header http.Header `json:"header,omitempty"`
+	Form   url.Values  `json:"form,omitempty"`
+}
+
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// Headers that carry credentials and are never recorded
+var secretHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "X-Goog-Api-Key"}
+
+// Form fields and query parameters that carry the session token
+var secretParams = []string{"at"}
+
+// tokenPattern finds an SNlM0e token in a page that slipped into a recording
+var tokenPattern = regexp.MustCompile(`("SNlM0e":")[^"]+`)
+
+// nameOf names an exchange after the endpoint and the batchexecute RPCs it called
+func nameOf(u *url.URL) string {
+	name := path.Base(u.Path)
+	if rpcIDs := u.Query().Get("rpcids"); rpcIDs != "" {
+		name += "-" + strings.ReplaceAll(rpcIDs, ",", "-")
+	}
+	return name
+}
+
+// sanitize removes credentials: cookie and auth headers, the session token wherever it
+// appears, and every value in secrets (cookie values, tokens) found in URL, form or body
+func (e *Exchange) sanitize(secrets []string) {
+	for _, name := range secretHeaders {
+		e.Request.Header.Del(name)
+		e.Response.Header.Del(name)
+	}
+
+	if u, err := url.Parse(e.Request.URL); err == nil {
+		query := u.Query()
+		redactParams(query)
+		u.RawQuery = query.Encode()
+		e.Request.URL = u.String()
+	}
+	redactParams(e.Request.Form)
+
+	scrub := func(s string) string {
+		s = tokenPattern.ReplaceAllString(s, "${1}"+Redacted)
+		for _, secret := range secrets {
+			if len(secret) >= 8 {
+				s = strings.ReplaceAll(s, secret, Redacted)
+			}
+		}
+		return s
+	}
+	e.Request.URL = scrub(e.Request.URL)
+	for key, values := range e.Request.Form {
+		for i := range values {
+			values[i] = scrub(values[i])
+		}
+		e.Request.Form[key] = values
+	}
+	e.Response.Body = scrub(e.Response.Body)
+}
+
+func redactParams(values url.Values) {
+	for _, name := range secretParams {
+		if values.Has(name) {
+			values.Set(name, Redacted)
+		}
+	}
+}
+
+// Write saves the exchange as a JSON file in dir and returns its path
+func (e *Exchange) Write(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	data, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	file, err := os.CreateTemp(dir, e.RecordedAt.UTC().Format("20060102T150405")+"-"+e.Name+"-*.json")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// Load reads a recorded exchange
+func Load(path string) (*Exchange, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var e Exchange
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("invalid recording %s: %w", path, err)
+	}
+	return &e, nil
+}
+
+// LoadDir reads all recordings in dir, in file name order (which is recording order)
+func LoadDir(dir string) ([]*Exchange, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	exchanges := make([]*Exchange, 0, len(paths))
+	for _, p := range paths {
+		e, err := Load(p)
+		if err != nil {
+			return nil, err
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges, nil
+}
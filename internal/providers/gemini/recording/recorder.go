@@ -0,0 +1,182 @@
+package recording
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Mode selects which exchanges are recorded
+type Mode string
+
+const (
+	ModeOff      Mode = "off"
+	ModeFailures Mode = "failures" // only exchanges the client reports as failed
+	ModeAll      Mode = "all"
+)
+
+// Recorder writes sanitized exchanges to fixture files
+type Recorder struct {
+	dir     string
+	mode    Mode
+	secrets func() []string // current cookie values and tokens, scrubbed from recordings
+	log     *zap.Logger
+}
+
+// New returns a recorder writing to dir, or nil when mode is off.
+// secrets is called for every exchange, so that rotated cookies are scrubbed too.
+func New(dir string, mode Mode, secrets func() []string, log *zap.Logger) *Recorder {
+	if mode == "" || mode == ModeOff {
+		return nil
+	}
+	return &Recorder{dir: dir, mode: mode, secrets: secrets, log: log}
+}
+
+// Wrap returns a transport that records the exchanges made through base
+func (r *Recorder) Wrap(base http.RoundTripper) http.RoundTripper {
+	if r == nil {
+		return base
+	}
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{recorder: r, base: base}
+}
+
+// Capture holds the last exchange made with a request context, so that the client can save
+// it once it knows the response could not be used
+type Capture struct {
+	mu       sync.Mutex
+	exchange *Exchange
+}
+
+type captureKey struct{}
+
+// WithCapture returns a context whose exchanges are kept in the returned Capture.
+// A context that already has a capture keeps it, so nested calls share it.
+func (r *Recorder) WithCapture(ctx context.Context) (context.Context, *Capture) {
+	if r == nil || r.mode != ModeFailures {
+		return ctx, nil
+	}
+	if capture, ok := ctx.Value(captureKey{}).(*Capture); ok {
+		return ctx, capture
+	}
+	capture := &Capture{}
+	return context.WithValue(ctx, captureKey{}, capture), capture
+}
+
+// SaveFailure writes the captured exchange when only failures are recorded, and returns the
+// file it was written to
+func (r *Recorder) SaveFailure(capture *Capture) string {
+	if r == nil || capture == nil {
+		return ""
+	}
+	capture.mu.Lock()
+	exchange := capture.exchange
+	capture.mu.Unlock()
+	if exchange == nil {
+		return ""
+	}
+	return r.write(exchange)
+}
+
+func (r *Recorder) write(exchange *Exchange) string {
+	path, err := exchange.Write(r.dir)
+	if err != nil {
+		r.log.Warn("Failed to save upstream recording", zap.String("name", exchange.Name), zap.Error(err))
+		return ""
+	}
+	r.log.Info("Saved upstream recording", zap.String("name", exchange.Name), zap.String("file", path))
+	return path
+}
+
+type transport struct {
+	recorder *Recorder
+	base     http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	exchange := &Exchange{
+		Name:       nameOf(req.URL),
+		RecordedAt: time.Now(),
+		Request: Request{
+			Method: req.Method,
+			URL:    req.URL.String(),
+			Header: req.Header.Clone(),
+			Form:   requestForm(req),
+		},
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return resp, nil
+	}
+
+	exchange.Response = Response{
+		Status: resp.StatusCode,
+		Header: resp.Header.Clone(),
+		Body:   decodedBody(resp.Header, body),
+	}
+	exchange.Response.Header.Del("Content-Encoding")
+	exchange.sanitize(t.recorder.secrets())
+
+	if t.recorder.mode == ModeAll {
+		t.recorder.write(exchange)
+	}
+	if capture, ok := req.Context().Value(captureKey{}).(*Capture); ok {
+		capture.mu.Lock()
+		capture.exchange = exchange
+		capture.mu.Unlock()
+	}
+	return resp, nil
+}
+
+// requestForm reads a url-encoded request body without consuming it
+func requestForm(req *http.Request) url.Values {
+	if req.GetBody == nil || !strings.HasPrefix(req.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+		return nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil
+	}
+	defer body.Close()
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil
+	}
+	form, _ := url.ParseQuery(string(data))
+	return form
+}
+
+// decodedBody undoes gzip compression the transport left in place
+func decodedBody(header http.Header, body []byte) string {
+	if !strings.Contains(header.Get("Content-Encoding"), "gzip") {
+		return string(body)
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return string(body)
+	}
+	defer gz.Close()
+	decoded, err := io.ReadAll(gz)
+	if err != nil {
+		return string(body)
+	}
+	return string(decoded)
+}
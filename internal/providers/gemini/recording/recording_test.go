@@ -0,0 +1,104 @@
+package recording
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+const psid = "g.a000secret-cookie-value"
+
+func TestRecordAndReplay(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{Name: "__Secure-1PSIDTS", Value: "sidts-rotated"})
+		fmt.Fprintf(w, `)]}'%s{"SNlM0e":"token-123456789","echo":%q}`, "\n", psid)
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	recorder := New(dir, ModeAll, func() []string { return []string{psid, "short"} }, zaptest.NewLogger(t))
+	client := &http.Client{Transport: recorder.Wrap(http.DefaultTransport)}
+
+	form := url.Values{"at": {"token-123456789"}, "f.req": {`["hello"]`}}
+	req, _ := http.NewRequest(http.MethodPost, upstream.URL+"/data/batchexecute?rpcids=kwDCne&at=token-123456789",
+		strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Cookie", "__Secure-1PSID="+psid)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	live, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !strings.Contains(string(live), psid) {
+		t.Fatalf("recording changed the live response: %q", live)
+	}
+
+	exchanges, err := LoadDir(dir)
+	if err != nil || len(exchanges) != 1 {
+		t.Fatalf("recordings = %d, %v", len(exchanges), err)
+	}
+	e := exchanges[0]
+	if e.Name != "batchexecute-kwDCne" {
+		t.Errorf("name = %q", e.Name)
+	}
+	if e.Request.Form.Get("f.req") != `["hello"]` || e.Request.Form.Get("at") != Redacted {
+		t.Errorf("form = %v", e.Request.Form)
+	}
+	if e.Request.Header.Get("Cookie") != "" || e.Response.Header.Get("Set-Cookie") != "" {
+		t.Error("cookie headers were recorded")
+	}
+	for _, s := range []string{e.Request.URL, e.Response.Body} {
+		if strings.Contains(s, psid) || strings.Contains(s, "token-123456789") {
+			t.Errorf("secret recorded in %q", s)
+		}
+	}
+
+	replayed, err := (&http.Client{Transport: NewReplay(e)}).Post("http://replay.invalid/data/batchexecute?rpcids=kwDCne", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(replayed.Body)
+	if string(body) != e.Response.Body {
+		t.Errorf("replayed body = %q", body)
+	}
+	if _, err := (&http.Client{Transport: NewReplay(e)}).Get("http://replay.invalid/data/batchexecute?rpcids=kwDCne"); err == nil {
+		t.Error("a request with another method should not match")
+	}
+}
+
+func TestCaptureOnlySavesFailures(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<html>changed</html>")
+	}))
+	defer upstream.Close()
+
+	dir := t.TempDir()
+	recorder := New(dir, ModeFailures, func() []string { return nil }, zaptest.NewLogger(t))
+	client := &http.Client{Transport: recorder.Wrap(nil)}
+
+	ctx, capture := recorder.WithCapture(context.Background())
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, upstream.URL+"/StreamGenerate", nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if exchanges, _ := LoadDir(dir); len(exchanges) != 0 {
+		t.Fatalf("recorded %d exchanges before a failure was reported", len(exchanges))
+	}
+	if path := recorder.SaveFailure(capture); path == "" {
+		t.Fatal("failure was not saved")
+	}
+	if exchanges, _ := LoadDir(dir); len(exchanges) != 1 || exchanges[0].Response.Body != "<html>changed</html>" {
+		t.Errorf("recordings = %+v", exchanges)
+	}
+}
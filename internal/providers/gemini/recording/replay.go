@@ -0,0 +1,56 @@
+package recording
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Replay is a transport that answers requests with recorded exchanges instead of calling
+// upstream. A request is matched by method and by what it called (endpoint and RPC IDs);
+// several recordings for the same call are served in the order they were recorded.
+type Replay struct {
+	mu     sync.Mutex
+	queues map[string][]*Exchange
+}
+
+// NewReplay returns a transport serving exchanges
+func NewReplay(exchanges ...*Exchange) *Replay {
+	r := &Replay{queues: make(map[string][]*Exchange)}
+	for _, e := range exchanges {
+		key := e.Request.Method + " " + e.Name
+		r.queues[key] = append(r.queues[key], e)
+	}
+	return r
+}
+
+func (r *Replay) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+	key := req.Method + " " + nameOf(req.URL)
+
+	r.mu.Lock()
+	queue := r.queues[key]
+	if len(queue) == 0 {
+		r.mu.Unlock()
+		return nil, fmt.Errorf("no recording left for %s", key)
+	}
+	e := queue[0]
+	r.queues[key] = queue[1:]
+	r.mu.Unlock()
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Response.Status, http.StatusText(e.Response.Status)),
+		StatusCode:    e.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Response.Header.Clone(),
+		Body:          io.NopCloser(strings.NewReader(e.Response.Body)),
+		ContentLength: int64(len(e.Response.Body)),
+		Request:       req,
+	}, nil
+}
@@ -0,0 +1,86 @@
+package gemini
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gemini-web-to-api/internal/providers/gemini/recording"
+	"gemini-web-to-api/internal/queue"
+
+	"github.com/imroc/req/v3"
+	"go.uber.org/zap/zaptest"
+)
+
+// TestRecordedResponses replays every fixture in testdata/recordings through the parsers.
+// To turn an upstream response the client failed on into a regression test, run with
+// GEMINI_RECORD=failures, fix the parser and copy the saved file here.
+func TestRecordedResponses(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "recordings", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		t.Fatal("no recordings in testdata/recordings")
+	}
+
+	for _, path := range paths {
+		exchange, err := recording.Load(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			c := replayClient(t, exchange)
+			switch {
+			case exchange.Name == "StreamGenerate":
+				response, err := c.parseResponse(exchange.Response.Body)
+				if err != nil {
+					t.Fatalf("parse: %v", err)
+				}
+				if response.Text == "" {
+					t.Error("response has no text")
+				}
+			case exchange.Name == "batchexecute-"+RPCReadResearch:
+				report, err := c.RetrieveDeepResearch(context.Background(), researchIDOf(t, exchange))
+				if err != nil {
+					t.Fatalf("retrieve: %v", err)
+				}
+				if report.Title == "" || len(report.Sections) == 0 {
+					t.Errorf("incomplete report: title %q, %d sections", report.Title, len(report.Sections))
+				}
+			default:
+				t.Skipf("no replay check for %s", exchange.Name)
+			}
+		})
+	}
+}
+
+// replayClient returns a client whose requests are answered by the recorded exchanges
+func replayClient(t *testing.T, exchanges ...*recording.Exchange) *Client {
+	httpClient := req.NewClient()
+	httpClient.GetClient().Transport = recording.NewReplay(exchanges...)
+	return &Client{
+		httpClient: httpClient,
+		cookies:    &CookieStore{},
+		at:         recording.Redacted,
+		endpoints:  DefaultEndpoints,
+		budget:     newRetryBudget(0),
+		limiter:    queue.NewLimiter(1, 0, 0),
+		log:        zaptest.NewLogger(t),
+	}
+}
+
+// researchIDOf finds the conversation ID a kwDCne request asked for
+func researchIDOf(t *testing.T, exchange *recording.Exchange) string {
+	fReq := exchange.Request.Form.Get("f.req")
+	start := strings.Index(fReq, `c_`)
+	if start < 0 {
+		t.Fatalf("no conversation ID in %q", fReq)
+	}
+	end := strings.IndexAny(fReq[start:], `\"`)
+	if end < 0 {
+		t.Fatalf("no conversation ID in %q", fReq)
+	}
+	return fReq[start : start+end]
+}
@@ -0,0 +1,371 @@
+package gemini
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gemini-web-to-api/internal/providers"
+
+	"go.uber.org/zap"
+)
+
+// planStepPattern matches the numbered plan lines Gemini puts in the report summary, e.g. "(3) Identify ..."
+var planStepPattern = regexp.MustCompile(`^\((\d+)\)\s*(.+)$`)
+
+// RetrieveDeepResearch fetches the full research report, steps and references for a given conversation
+func (c *Client) RetrieveDeepResearch(ctx context.Context, conversationID string) (*providers.ResearchReport, error) {
+	c.log.Info("Retrieving Deep Research content", zap.String("conversation_id", conversationID))
+
+	ctx, capture := c.recorder.WithCapture(ctx)
+	payload, err := c.BatchExecute(ctx, RPCReadResearch, []interface{}{conversationID})
+	if err != nil {
+		return nil, fmt.Errorf("retrieval failed: %w", err)
+	}
+
+	report := parseResearchPayload(payload)
+	if report == nil {
+		err := fmt.Errorf("failed to extract research data from response")
+		c.saveFailure(capture, err)
+		return nil, err
+	}
+	report.ConversationID = conversationID
+
+	c.log.Debug("Parsed Deep Research report",
+		zap.String("conversation_id", conversationID),
+		zap.Int("sections", len(report.Sections)),
+		zap.Int("steps", len(report.Steps)),
+		zap.Int("references", len(report.References)),
+	)
+	return report, nil
+}
+
+// parseResearchPayload turns a decoded kwDCne payload into a ResearchReport.
+// Based on browser investigation, data[0][1][4] is the report object:
+//   - index 0: title
+//   - index 1: summary (the numbered research plan)
+//   - index 2: browsing steps, each carrying its result at step[4] with the source at result[2]
+//   - later indexes: the rendered report body (markdown)
+func parseResearchPayload(payload []interface{}) *providers.ResearchReport {
+	if len(payload) == 0 {
+		return nil
+	}
+
+	data, ok := payload[0].([]interface{})
+	if !ok || len(data) < 2 {
+		return nil
+	}
+
+	reportContainer, ok := data[1].([]interface{})
+	if !ok || len(reportContainer) < 5 {
+		return nil
+	}
+
+	raw, ok := reportContainer[4].([]interface{})
+	if !ok || len(raw) < 3 {
+		return nil
+	}
+
+	title, _ := raw[0].(string)
+	summary, _ := raw[1].(string)
+
+	report := &providers.ResearchReport{
+		Title:   title,
+		Summary: summary,
+		Plan:    parsePlan(summary),
+	}
+
+	if steps, ok := raw[2].([]interface{}); ok {
+		report.Steps = parseResearchSteps(steps)
+	}
+
+	seen := make(map[string]bool)
+	for _, step := range report.Steps {
+		for _, src := range step.Sources {
+			if seen[src.URL] {
+				continue
+			}
+			seen[src.URL] = true
+			report.References = append(report.References, src)
+		}
+	}
+
+	report.Body = findReportBody(raw[3:], summary)
+	if report.Body == "" {
+		// Reports that have not finished rendering only carry title and plan
+		report.Body = strings.TrimSpace(title + "\n\n" + summary)
+	}
+	report.Sections = parseReportSections(report.Body)
+
+	return report
+}
+
+// parsePlan extracts the ordered "(n) ..." lines from the report summary
+func parsePlan(summary string) []string {
+	var plan []string
+	for _, line := range strings.Split(summary, "\n") {
+		m := planStepPattern.FindStringSubmatch(strings.TrimSpace(line))
+		if len(m) == 3 {
+			plan = append(plan, strings.TrimSpace(m[2]))
+		}
+	}
+	return plan
+}
+
+// parseResearchSteps walks the step array keeping upstream order.
+// Consecutive entries with the same description are the same step browsing several sources,
+// so they are merged into one ResearchStep.
+func parseResearchSteps(rawSteps []interface{}) []providers.ResearchStep {
+	var steps []providers.ResearchStep
+	for _, rawStep := range rawSteps {
+		stepArr, ok := rawStep.([]interface{})
+		if !ok {
+			continue
+		}
+
+		description, queries := parseStepHeader(stepArr)
+
+		var sources []providers.Reference
+		if len(stepArr) > 4 {
+			if resultObj, ok := stepArr[4].([]interface{}); ok && len(resultObj) > 2 {
+				sources = parseSources(resultObj[2])
+			}
+		}
+
+		if description == "" && len(queries) == 0 && len(sources) == 0 {
+			continue
+		}
+
+		if n := len(steps); n > 0 && description != "" && steps[n-1].Description == description {
+			steps[n-1].Queries = appendUnique(steps[n-1].Queries, queries...)
+			steps[n-1].Sources = append(steps[n-1].Sources, sources...)
+			continue
+		}
+
+		steps = append(steps, providers.ResearchStep{
+			Index:       len(steps) + 1,
+			Description: description,
+			Queries:     queries,
+			Sources:     sources,
+		})
+	}
+	return steps
+}
+
+// parseStepHeader reads the step fields before the result object:
+// the first plain string is the description, nested string lists are the search queries.
+func parseStepHeader(stepArr []interface{}) (string, []string) {
+	var (
+		description string
+		queries     []string
+	)
+
+	limit := len(stepArr)
+	if limit > 4 {
+		limit = 4
+	}
+
+	for _, field := range stepArr[:limit] {
+		switch v := field.(type) {
+		case string:
+			if description == "" && v != "" && !isURL(v) {
+				description = v
+			}
+		case []interface{}:
+			for _, q := range flattenStrings(v, 2) {
+				if q != "" && !isURL(q) {
+					queries = appendUnique(queries, q)
+				}
+			}
+		}
+	}
+	return description, queries
+}
+
+// parseSources accepts either a single [favicon_url, target_url, title, snippet] entry or a list of them
+func parseSources(v interface{}) []providers.Reference {
+	arr, ok := v.([]interface{})
+	if !ok || len(arr) == 0 {
+		return nil
+	}
+
+	if _, nested := arr[0].([]interface{}); nested {
+		var refs []providers.Reference
+		for _, item := range arr {
+			refs = append(refs, parseSources(item)...)
+		}
+		return refs
+	}
+
+	if len(arr) < 4 {
+		return nil
+	}
+
+	icon, _ := arr[0].(string)
+	url, _ := arr[1].(string)
+	title, _ := arr[2].(string)
+	snippet, _ := arr[3].(string)
+	if url == "" {
+		return nil
+	}
+
+	return []providers.Reference{{
+		Title:   title,
+		URL:     url,
+		Snippet: snippet,
+		Icon:    icon,
+	}}
+}
+
+// findReportBody returns the longest multi-line string in the remaining report fields,
+// which is the rendered markdown report once research has completed.
+func findReportBody(fields []interface{}, summary string) string {
+	var body string
+	for _, s := range flattenStrings(fields, 4) {
+		if s == summary || !strings.Contains(s, "\n") || isURL(s) {
+			continue
+		}
+		if len(s) > len(body) {
+			body = s
+		}
+	}
+	return strings.TrimSpace(body)
+}
+
+// parseReportSections splits a markdown report into heading-delimited sections
+// holding their paragraphs and pipe tables.
+func parseReportSections(body string) []providers.ReportSection {
+	var (
+		sections  []providers.ReportSection
+		current   = providers.ReportSection{}
+		paragraph []string
+		table     []string
+	)
+
+	flushParagraph := func() {
+		if len(paragraph) > 0 {
+			current.Paragraphs = append(current.Paragraphs, strings.Join(paragraph, "\n"))
+			paragraph = nil
+		}
+	}
+	flushTable := func() {
+		if len(table) > 0 {
+			if t, ok := parseMarkdownTable(table); ok {
+				current.Tables = append(current.Tables, t)
+			} else {
+				paragraph = append(paragraph, table...)
+			}
+			table = nil
+		}
+	}
+	flushSection := func() {
+		flushTable()
+		flushParagraph()
+		if current.Heading != "" || len(current.Paragraphs) > 0 || len(current.Tables) > 0 {
+			sections = append(sections, current)
+		}
+	}
+
+	for _, line := range strings.Split(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case strings.HasPrefix(trimmed, "#"):
+			flushSection()
+			level := len(trimmed) - len(strings.TrimLeft(trimmed, "#"))
+			current = providers.ReportSection{
+				Heading: strings.TrimSpace(trimmed[level:]),
+				Level:   level,
+			}
+		case strings.HasPrefix(trimmed, "|"):
+			flushParagraph()
+			table = append(table, trimmed)
+		case trimmed == "":
+			flushTable()
+			flushParagraph()
+		default:
+			flushTable()
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flushSection()
+
+	return sections
+}
+
+// parseMarkdownTable parses "| a | b |" rows; the second row must be the "|---|" separator
+func parseMarkdownTable(lines []string) (providers.ReportTable, bool) {
+	if len(lines) < 2 || !isTableSeparator(lines[1]) {
+		return providers.ReportTable{}, false
+	}
+
+	table := providers.ReportTable{Headers: splitTableRow(lines[0])}
+	for _, line := range lines[2:] {
+		table.Rows = append(table.Rows, splitTableRow(line))
+	}
+	return table, true
+}
+
+func isTableSeparator(line string) bool {
+	cells := splitTableRow(line)
+	if len(cells) == 0 {
+		return false
+	}
+	for _, cell := range cells {
+		if strings.Trim(cell, "-: ") != "" || !strings.Contains(cell, "-") {
+			return false
+		}
+	}
+	return true
+}
+
+func splitTableRow(line string) []string {
+	line = strings.TrimSpace(line)
+	line = strings.TrimPrefix(line, "|")
+	line = strings.TrimSuffix(line, "|")
+
+	var cells []string
+	for _, cell := range strings.Split(line, "|") {
+		cells = append(cells, strings.TrimSpace(cell))
+	}
+	return cells
+}
+
+// flattenStrings collects every string in v up to the given nesting depth
+func flattenStrings(v interface{}, depth int) []string {
+	switch val := v.(type) {
+	case string:
+		return []string{val}
+	case []interface{}:
+		if depth <= 0 {
+			return nil
+		}
+		var out []string
+		for _, item := range val {
+			out = append(out, flattenStrings(item, depth-1)...)
+		}
+		return out
+	}
+	return nil
+}
+
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		exists := false
+		for _, existing := range list {
+			if existing == v {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
@@ -0,0 +1,151 @@
+package gemini
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gemini-web-to-api/internal/providers"
+)
+
+// TestParsePlan reads the plan of the shipped example, a research plan Gemini wrote
+func TestParsePlan(t *testing.T) {
+	data, err := os.ReadFile("../../../examples/deep_research_sample.json")
+	if err != nil {
+		t.Fatalf("read example: %v", err)
+	}
+	var sample providers.Response
+	if err := json.Unmarshal(data, &sample); err != nil {
+		t.Fatalf("decode example: %v", err)
+	}
+
+	plan := parsePlan(sample.Text)
+	if len(plan) != 6 {
+		t.Fatalf("plan = %q, want 6 steps", plan)
+	}
+	if !strings.HasPrefix(plan[0], "Find the official release date") || !strings.HasPrefix(plan[5], "Explore technical blogs") {
+		t.Errorf("plan = %q", plan)
+	}
+}
+
+// researchPayload wraps a report object in the kwDCne envelope parseResearchPayload reads.
+// The payloads below are written by hand in that layout, not captured from Gemini.
+func researchPayload(raw ...interface{}) []interface{} {
+	return []interface{}{[]interface{}{nil, []interface{}{nil, nil, nil, nil, raw}}}
+}
+
+func researchSource(url, title string) []interface{} {
+	return []interface{}{"https://www.google.com/s2/favicons?domain=" + url, url, title, title + " snippet"}
+}
+
+func TestParseResearchPayload(t *testing.T) {
+	steps := []interface{}{
+		[]interface{}{"Finding the release date", []interface{}{"go release date"}, nil, nil,
+			[]interface{}{nil, nil, researchSource("https://go.dev/doc/go1.24", "Go 1.24 Release Notes")}},
+		// The same step browsing a second source, merged into the first
+		[]interface{}{"Finding the release date", []interface{}{"go release date", "go support policy"}, nil, nil,
+			[]interface{}{nil, nil, []interface{}{
+				researchSource("https://go.dev/doc/devel/release", "Release History"),
+				researchSource("https://go.dev/doc/go1.24", "Go 1.24 Release Notes"),
+			}}},
+		[]interface{}{"Checking patch releases", nil, nil, nil,
+			[]interface{}{nil, nil, researchSource("https://go.dev/doc/devel/release#go1.24.minor", "Minor releases")}},
+	}
+	body := "# Go 1.24\n\nReleased in February 2025.\n\n## Support\n\n| Version | Status |\n| --- | --- |\n| Go 1.24 | Supported |"
+
+	tests := []struct {
+		name       string
+		payload    []interface{}
+		wantNil    bool
+		title      string
+		plan       int
+		steps      []string
+		references int
+		headings   []string
+		tables     int
+	}{
+		{name: "empty", payload: nil, wantNil: true},
+		{name: "no report object", payload: []interface{}{[]interface{}{nil, []interface{}{nil}}}, wantNil: true},
+		{name: "report object too short", payload: researchPayload("Title", "(1) Plan"), wantNil: true},
+		{
+			name:    "unfinished report",
+			payload: researchPayload("Go 1.24", "(1) Find the date\n(2) Check the patches", []interface{}{}),
+			title:   "Go 1.24",
+			plan:    2,
+		},
+		{
+			name:       "finished report",
+			payload:    researchPayload("Go 1.24", "(1) Find the date\n(2) Check the patches", steps, nil, 1, []interface{}{[]interface{}{body, nil, []interface{}{"en"}}}, "Research complete.\nThe report is ready."),
+			title:      "Go 1.24",
+			plan:       2,
+			steps:      []string{"Finding the release date", "Checking patch releases"},
+			references: 3,
+			headings:   []string{"Go 1.24", "Support"},
+			tables:     1,
+		},
+	}
+	for _, tt := range tests {
+		report := parseResearchPayload(tt.payload)
+		if tt.wantNil {
+			if report != nil {
+				t.Errorf("%s: parsed %+v, want nil", tt.name, report)
+			}
+			continue
+		}
+		if report == nil {
+			t.Errorf("%s: not recognized as a report", tt.name)
+			continue
+		}
+
+		if report.Title != tt.title || len(report.Plan) != tt.plan {
+			t.Errorf("%s: title %q, plan %q", tt.name, report.Title, report.Plan)
+		}
+		var descriptions []string
+		for _, step := range report.Steps {
+			descriptions = append(descriptions, step.Description)
+		}
+		if !reflect.DeepEqual(descriptions, tt.steps) {
+			t.Errorf("%s: steps = %q, want %q", tt.name, descriptions, tt.steps)
+		}
+		if len(report.References) != tt.references {
+			t.Errorf("%s: %d references, want %d", tt.name, len(report.References), tt.references)
+		}
+		var headings []string
+		tables := 0
+		for _, section := range report.Sections {
+			if section.Heading != "" {
+				headings = append(headings, section.Heading)
+			}
+			tables += len(section.Tables)
+		}
+		if !reflect.DeepEqual(headings, tt.headings) || tables != tt.tables {
+			t.Errorf("%s: headings %q with %d tables, want %q with %d", tt.name, headings, tables, tt.headings, tt.tables)
+		}
+	}
+}
+
+func TestParseResearchStepsMergesRepeatedStep(t *testing.T) {
+	steps := parseResearchSteps([]interface{}{
+		[]interface{}{"Searching", []interface{}{"a"}, nil, nil, []interface{}{nil, nil, researchSource("https://a.example", "A")}},
+		[]interface{}{"Searching", []interface{}{"a", "b"}, nil, nil, []interface{}{nil, nil, researchSource("https://b.example", "B")}},
+		[]interface{}{"Reading", nil, nil, nil, nil},
+	})
+
+	want := []providers.ResearchStep{
+		{
+			Index:       1,
+			Description: "Searching",
+			Queries:     []string{"a", "b"},
+			Sources: []providers.Reference{
+				{Title: "A", URL: "https://a.example", Snippet: "A snippet", Icon: "https://www.google.com/s2/favicons?domain=https://a.example"},
+				{Title: "B", URL: "https://b.example", Snippet: "B snippet", Icon: "https://www.google.com/s2/favicons?domain=https://b.example"},
+			},
+		},
+		{Index: 2, Description: "Reading"},
+	}
+	if !reflect.DeepEqual(steps, want) {
+		t.Errorf("steps = %+v", steps)
+	}
+}
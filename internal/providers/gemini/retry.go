@@ -0,0 +1,214 @@
+package gemini
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"gemini-web-to-api/internal/config"
+
+	"go.uber.org/zap"
+)
+
+// RetryPolicy decides whether and when a failed upstream call is retried
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration // before the first retry, doubled for each further one
+	MaxDelay   time.Duration // cap of a single wait, also the longest Retry-After honored
+}
+
+func retryPolicyOf(cfg *config.Config) RetryPolicy {
+	policy := RetryPolicy{
+		MaxRetries: cfg.Gemini.MaxRetries,
+		BaseDelay:  time.Duration(cfg.Gemini.RetryBaseDelay) * time.Millisecond,
+		MaxDelay:   time.Duration(cfg.Gemini.RetryMaxDelay) * time.Millisecond,
+	}
+	if policy.MaxRetries < 0 {
+		policy.MaxRetries = 0
+	}
+	if policy.MaxDelay < policy.BaseDelay {
+		policy.MaxDelay = policy.BaseDelay
+	}
+	return policy
+}
+
+// delay returns how long to wait before retry n (1-based), or false when err is not worth retrying.
+// Network errors, unreadable answers and 5xx responses are retried with exponential backoff;
+// a rate limit only when the upstream says when to come back; auth failures are handled by
+// re-authenticating instead.
+func (p RetryPolicy) delay(err error, n int) (time.Duration, bool) {
+	upstreamErr, ok := asUpstreamError(err)
+	if !ok {
+		return 0, false
+	}
+	switch upstreamErr.Kind {
+	case FailureNetwork, FailureParse:
+		return p.backoff(n), true
+	case FailureUpstream:
+		if upstreamErr.Status >= http.StatusInternalServerError {
+			return p.backoff(n), true
+		}
+	case FailureRateLimit:
+		if upstreamErr.RetryAfter > 0 && upstreamErr.RetryAfter <= p.MaxDelay {
+			return upstreamErr.RetryAfter, true
+		}
+	}
+	return 0, false
+}
+
+// backoff doubles the base delay for every retry, capped at MaxDelay, and keeps a random
+// half of it so that clients failing together do not retry together
+func (p RetryPolicy) backoff(n int) time.Duration {
+	d := p.BaseDelay
+	for i := 1; i < n && d < p.MaxDelay; i++ {
+		d *= 2
+	}
+	if d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1))
+}
+
+// retryBudget caps retries at a share of recent requests so that an outage is not amplified:
+// every request earns ratio tokens, every retry spends one
+type retryBudget struct {
+	mu     sync.Mutex
+	tokens float64
+	ratio  float64
+	max    float64
+}
+
+const retryBudgetBurst = 10 // retries available before any request has been counted
+
+func newRetryBudget(percent int) *retryBudget {
+	return &retryBudget{
+		tokens: retryBudgetBurst,
+		ratio:  float64(percent) / 100,
+		max:    retryBudgetBurst,
+	}
+}
+
+func (b *retryBudget) setPercent(percent int) {
+	b.mu.Lock()
+	b.ratio = float64(percent) / 100
+	b.mu.Unlock()
+}
+
+func (b *retryBudget) deposit() {
+	b.mu.Lock()
+	b.tokens += b.ratio
+	if b.tokens > b.max {
+		b.tokens = b.max
+	}
+	b.mu.Unlock()
+}
+
+func (b *retryBudget) withdraw() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// withRetry runs attempt until it succeeds or the retry policy gives up.
+// An auth failure is recovered once by re-authenticating, then retried right away.
+func (c *Client) withRetry(ctx context.Context, op string, attempt func() error) error {
+	c.mu.RLock()
+	policy := c.retry
+	c.mu.RUnlock()
+	c.budget.deposit()
+
+	recovered := false
+	for n := 0; ; n++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		started := time.Now()
+		err := attempt()
+		if err == nil {
+			if n > 0 {
+				c.log.Info("Upstream request succeeded after retry", zap.String("op", op), zap.Int("attempt", n))
+			}
+			return nil
+		}
+
+		if FailureKindOf(err) == FailureAuth {
+			if recovered {
+				c.markUnhealthy("session rejected after re-authentication: " + err.Error())
+				return err
+			}
+			recovered = true
+			c.log.Warn("Session expired, re-authenticating", zap.String("op", op), zap.Error(err))
+			if authErr := c.reauthSince(started); authErr != nil {
+				return authErr
+			}
+			continue
+		}
+
+		if n >= policy.MaxRetries {
+			return err
+		}
+		delay, ok := policy.delay(err, n+1)
+		if !ok {
+			return err
+		}
+		if !c.budget.withdraw() {
+			c.log.Warn("Retry budget exhausted, not retrying", zap.String("op", op), zap.Error(err))
+			return err
+		}
+
+		c.log.Warn("Retrying upstream request",
+			zap.String("op", op),
+			zap.Int("attempt", n+1),
+			zap.Int("max_retries", policy.MaxRetries),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// reauthSince re-authenticates unless another request already did after since
+func (c *Client) reauthSince(since time.Time) error {
+	c.mu.RLock()
+	refreshed := c.tokenAt.After(since)
+	c.mu.RUnlock()
+	if refreshed {
+		return nil
+	}
+	return c.reauth()
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date
+func parseRetryAfter(header http.Header) time.Duration {
+	value := header.Get("Retry-After")
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
@@ -18,54 +18,47 @@ type ChatSession struct {
 	history  []providers.Message
 }
 
-// SendMessage sends a message in the chat session
+// SendMessage sends a message in the chat session. Failures are returned as *providers.Error.
 func (s *ChatSession) SendMessage(ctx context.Context, message string, options ...providers.GenerateOption) (*providers.Response, error) {
-	s.client.reqMu.Lock()
-	defer s.client.reqMu.Unlock()
-	
-	if s.client.at == "" {
+	response, err := s.sendMessage(ctx, message, options...)
+	if err != nil {
+		return nil, toProviderError(ctx, err)
+	}
+	return response, nil
+}
+
+func (s *ChatSession) sendMessage(ctx context.Context, message string, options ...providers.GenerateOption) (*providers.Response, error) {
+	release, err := s.client.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	if s.client.sessionToken() == "" {
 		return nil, fmt.Errorf("client not initialized")
 	}
 
-	config := &providers.GenerateConfig{}
+	config := &providers.GenerateConfig{Model: s.model}
 	for _, opt := range options {
 		opt(config)
 	}
 
+	if err := s.client.applyGem(config); err != nil {
+		return nil, err
+	}
+
 	if config.DeepResearch {
-		return s.sendDeepResearchMessage(ctx, message, options...)
+		return s.sendDeepResearchMessage(ctx, message, config.GemID)
 	}
 
 	// Build conversation context
-	inner := []interface{}{
-		[]interface{}{message},
-		nil,
-		s.buildMetadata(),
-	}
+	inner := buildGenerateInner(message, s.buildMetadata(), config.GemID)
 
 	innerJSON, _ := json.Marshal(inner)
 	outer := []interface{}{nil, string(innerJSON)}
 	outerJSON, _ := json.Marshal(outer)
 
-	formData := map[string]string{
-		"at":    s.client.at,
-		"f.req": string(outerJSON),
-	}
-
-	resp, err := s.client.httpClient.R().
-		SetFormData(formData).
-		SetQueryParam("at", s.client.at).
-		Post(EndpointGenerate)
-
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("chat failed with status: %d", resp.StatusCode)
-	}
-
-	response, err := s.client.parseResponse(resp.String())
+	response, err := s.client.generate(ctx, config.Model, outerJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -86,7 +79,7 @@ func (s *ChatSession) SendMessage(ctx context.Context, message string, options .
 	return response, nil
 }
 
-func (s *ChatSession) sendDeepResearchMessage(ctx context.Context, message string, options ...providers.GenerateOption) (*providers.Response, error) {
+func (s *ChatSession) sendDeepResearchMessage(ctx context.Context, message string, gemID string) (*providers.Response, error) {
 	// Phase 1: Planning
 	reqID := uuid.New().String()
 
@@ -103,17 +96,15 @@ func (s *ChatSession) sendDeepResearchMessage(ctx context.Context, message strin
 	inner[54] = []interface{}{[]interface{}{[]interface{}{[]interface{}{[]interface{}{1}}}}} // Deep Research nested flag
 	inner[55] = []interface{}{[]interface{}{1}}
 	inner[59] = reqID
+	if gemID != "" {
+		inner[gemInnerPosition] = gemID
+	}
 
 	innerJSON, _ := json.Marshal(inner)
 	outer := []interface{}{nil, string(innerJSON)}
 	outerJSON, _ := json.Marshal(outer)
 
-	resp1, err := s.client.doRequest(ctx, outerJSON)
-	if err != nil {
-		return nil, err
-	}
-
-	res1, err := s.client.parseResponse(resp1.String())
+	res1, err := s.client.generate(ctx, "", outerJSON)
 	if err != nil {
 		return nil, err
 	}
@@ -136,17 +127,13 @@ func (s *ChatSession) sendDeepResearchMessage(ctx context.Context, message strin
 	inner2[54] = inner[54]
 	inner2[55] = inner[55]
 	inner2[59] = reqID
+	inner2[gemInnerPosition] = inner[gemInnerPosition]
 
 	innerJSON2, _ := json.Marshal(inner2)
 	outer2 := []interface{}{nil, string(innerJSON2), nil, stateToken}
 	outerJSON2, _ := json.Marshal(outer2)
 
-	resp2, err := s.client.doRequest(ctx, outerJSON2)
-	if err != nil {
-		return nil, err
-	}
-
-	response, err := s.client.parseResponse(resp2.String())
+	response, err := s.client.generate(ctx, "", outerJSON2)
 	if err != nil {
 		return nil, err
 	}
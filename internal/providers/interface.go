@@ -1,6 +1,9 @@
 package providers
 
-import "context"
+import (
+	"context"
+	"time"
+)
 
 // Provider defines the interface that all AI providers must implement
 type Provider interface {
@@ -25,8 +28,23 @@ type Provider interface {
 	// ListModels returns models supported by this provider
 	ListModels() []ModelInfo
 
-	// RetrieveDeepResearch fetches the full research report and references for a given conversation
-	RetrieveDeepResearch(ctx context.Context, conversationID string) (*Response, error)
+	// RetrieveDeepResearch fetches the full research report, steps and references for a given conversation
+	RetrieveDeepResearch(ctx context.Context, conversationID string) (*ResearchReport, error)
+
+	// ListConversations returns the most recent conversations in the account history
+	ListConversations(ctx context.Context, limit int) ([]Conversation, error)
+
+	// GetConversation returns the turns of a conversation
+	GetConversation(ctx context.Context, conversationID string, limit int) ([]ConversationTurn, error)
+
+	// RenameConversation sets the title of a conversation
+	RenameConversation(ctx context.Context, conversationID string, title string) error
+
+	// PinConversation pins or unpins a conversation
+	PinConversation(ctx context.Context, conversationID string, pinned bool) error
+
+	// DeleteConversation removes a conversation from the account history
+	DeleteConversation(ctx context.Context, conversationID string) error
 }
 
 // ChatSession represents a multi-turn conversation
@@ -47,6 +65,7 @@ type ChatSession interface {
 // Response represents a provider's response
 type Response struct {
 	Text          string              `json:"text"`
+	Thinking      string              `json:"thinking,omitempty"` // reasoning of thinking models, shown before the answer
 	Images        []Image             `json:"images,omitempty"`
 	Candidates    []Candidate         `json:"candidates,omitempty"`
 	Metadata      map[string]any      `json:"metadata,omitempty"`
@@ -54,6 +73,8 @@ type Response struct {
 	ConversationID string             `json:"conversation_id,omitempty"`
 	ResponseID    string              `json:"response_id,omitempty"`
 	References    []Reference         `json:"references,omitempty"`
+	Citations     []Citation          `json:"citations,omitempty"` // spans of Text backed by References
+	Parts         []Part              `json:"parts,omitempty"`     // Text split into typed parts, in order
 }
 
 // Message represents a single message in conversation
@@ -72,6 +93,30 @@ type Image struct {
 	Height      int    `json:"height,omitempty"`
 }
 
+// PartType is the kind of content a Part holds
+type PartType string
+
+const (
+	PartText       PartType = "text"
+	PartCode       PartType = "code"        // a fenced code block
+	PartCodeResult PartType = "code_result" // the output of running the code block before it
+	PartImage      PartType = "image"
+	PartTable      PartType = "table"
+)
+
+// Part is a typed piece of a response. Start and End locate its markdown in Response.Text;
+// they are equal for images shown outside the text.
+type Part struct {
+	Type     PartType     `json:"type"`
+	Text     string       `json:"text,omitempty"`     // prose, code or execution output
+	Language string       `json:"language,omitempty"` // of code, as tagged on its fence
+	Outcome  string       `json:"outcome,omitempty"`  // of an execution: "ok" or "failed"
+	Image    *Image       `json:"image,omitempty"`
+	Table    *ReportTable `json:"table,omitempty"`
+	Start    int          `json:"start"`
+	End      int          `json:"end"`
+}
+
 // Candidate represents an alternative response
 type Candidate struct {
 	ID      string `json:"id"`
@@ -86,6 +131,64 @@ type Reference struct {
 	Icon    string `json:"icon,omitempty"`
 }
 
+// Citation ties a span of a response's text to the references that support it
+type Citation struct {
+	Start      int   `json:"start"` // byte offsets into the text
+	End        int   `json:"end"`
+	References []int `json:"references"` // indexes into Response.References
+}
+
+// ResearchReport is the structured result of a Deep Research conversation
+type ResearchReport struct {
+	ConversationID string          `json:"conversation_id"`
+	Title          string          `json:"title"`
+	Summary        string          `json:"summary,omitempty"`
+	Plan           []string        `json:"plan,omitempty"`
+	Body           string          `json:"body,omitempty"`
+	Sections       []ReportSection `json:"sections,omitempty"`
+	Steps          []ResearchStep  `json:"steps,omitempty"`
+	References     []Reference     `json:"references,omitempty"`
+}
+
+// ReportSection is a heading-delimited part of the report body
+type ReportSection struct {
+	Heading    string        `json:"heading,omitempty"`
+	Level      int           `json:"level,omitempty"`
+	Paragraphs []string      `json:"paragraphs,omitempty"`
+	Tables     []ReportTable `json:"tables,omitempty"`
+}
+
+// ReportTable is a table found in the report body
+type ReportTable struct {
+	Headers []string   `json:"headers,omitempty"`
+	Rows    [][]string `json:"rows,omitempty"`
+}
+
+// ResearchStep is a single browsing step performed during research
+type ResearchStep struct {
+	Index       int         `json:"index"`
+	Description string      `json:"description,omitempty"`
+	Queries     []string    `json:"queries,omitempty"`
+	Sources     []Reference `json:"sources,omitempty"`
+}
+
+// Conversation is an entry of the account's conversation history
+type Conversation struct {
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	Pinned    bool      `json:"pinned"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ConversationTurn is a single prompt/reply exchange in a conversation
+type ConversationTurn struct {
+	ResponseID string    `json:"response_id,omitempty"`
+	ChoiceID   string    `json:"choice_id,omitempty"`
+	Prompt     string    `json:"prompt"`
+	Reply      string    `json:"reply"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 // SessionMetadata contains information to restore a session
 type SessionMetadata struct {
 	ConversationID string         `json:"conversation_id"`
@@ -105,6 +208,7 @@ type GenerateConfig struct {
 	Temperature  float64
 	MaxTokens    int
 	DeepResearch bool
+	GemID        string
 }
 
 // ChatOption configures chat session behavior
@@ -144,9 +248,23 @@ func WithChatMetadata(metadata *SessionMetadata) ChatOption {
 	}
 }
 
+// WithGem routes the request to a Gem (custom persona) by its name or ID
+func WithGem(gemID string) GenerateOption {
+	return func(c *GenerateConfig) {
+		c.GemID = gemID
+	}
+}
+
 // WithDeepResearch enables Deep Research mode
 func WithDeepResearch(enabled bool) GenerateOption {
 	return func(c *GenerateConfig) {
 		c.DeepResearch = enabled
 	}
 }
+
+// WithTemperature passes on the sampling temperature a request asked for
+func WithTemperature(temperature float64) GenerateOption {
+	return func(c *GenerateConfig) {
+		c.Temperature = temperature
+	}
+}
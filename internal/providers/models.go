@@ -1,32 +1,266 @@
 package providers
 
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.yaml.in/yaml/v3"
+)
+
 // ModelInfo contains basic information about an AI model
 type ModelInfo struct {
-	ID       string `json:"id"`
-	Created  int64  `json:"created"`
-	OwnedBy  string `json:"owned_by"`
-	Provider string `json:"provider"` // "gemini", "claude", etc.
+	ID            string   `json:"id"`
+	Created       int64    `json:"created"`
+	OwnedBy       string   `json:"owned_by"`
+	Provider      string   `json:"provider"` // "gemini", "claude", etc.
+	DisplayName   string   `json:"display_name,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	Capabilities  []string `json:"capabilities,omitempty"`
+	AliasOf       string   `json:"alias_of,omitempty"`
+	ContextWindow int      `json:"context_window,omitempty"` // prompt tokens the model accepts, 0 when unknown
+	Code          string   `json:"-"`                        // upstream code the web app selects the model by, empty when unknown
 }
 
-// SupportedModels is the central registry of all models supported by the system.
-// In the future, this could be loaded from a configuration file or database.
-var SupportedModels = []ModelInfo{
+// DefaultModels is used until the account's models have been discovered,
+// or when discovery finds nothing in the app bootstrap data.
+var DefaultModels = []ModelInfo{
 	{
-		ID:       "gemini-1.5-pro",
-		Created:  1715644800, // May 14, 2024
+		ID:       "gemini-2.5-flash",
+		Created:  1750118400, // June 17, 2025
 		OwnedBy:  "google",
 		Provider: "gemini",
 	},
 	{
-		ID:       "gemini-1.5-flash",
-		Created:  1715644800,
+		ID:       "gemini-2.5-pro",
+		Created:  1750118400,
 		OwnedBy:  "google",
 		Provider: "gemini",
 	},
-	{
-		ID:       "gpt-4o",
-		Created:  1715558400, // May 13, 2024
-		OwnedBy:  "openai-alias",
-		Provider: "gemini", // Served via Gemini proxy
-	},
+}
+
+// ModelOverlay is the YAML file merged over discovered models
+type ModelOverlay struct {
+	Models []ModelOverride `yaml:"models"`
+}
+
+// ModelOverride adds or adjusts a model; aliases are exposed as models of their own
+type ModelOverride struct {
+	ID            string   `yaml:"id"`
+	DisplayName   string   `yaml:"display_name"`
+	Description   string   `yaml:"description"`
+	OwnedBy       string   `yaml:"owned_by"`
+	Capabilities  []string `yaml:"capabilities"`
+	ContextWindow int      `yaml:"context_window"`
+	Aliases       []string `yaml:"aliases"`
+	Hidden        bool     `yaml:"hidden"`
+}
+
+// ModelRegistry holds the models the logged-in account can use,
+// merging discovered models with the overlay file.
+type ModelRegistry struct {
+	mu          sync.RWMutex
+	log         *zap.Logger
+	overlayPath string
+	overlay     ModelOverlay
+	discovered  []ModelInfo
+	models      []ModelInfo
+	index       map[string]ModelInfo
+	updatedAt   time.Time
+}
+
+// NewModelRegistry creates a registry seeded with DefaultModels and the overlay file, if any
+func NewModelRegistry(overlayPath string, log *zap.Logger) *ModelRegistry {
+	r := &ModelRegistry{
+		log:         log,
+		overlayPath: overlayPath,
+	}
+	if err := r.ReloadOverlay(); err != nil {
+		log.Warn("Failed to load model overlay", zap.String("file", overlayPath), zap.Error(err))
+	}
+	return r
+}
+
+// ReloadOverlay re-reads the overlay file; a missing file means no overlay
+func (r *ModelRegistry) ReloadOverlay() error {
+	var overlay ModelOverlay
+	if r.overlayPath != "" {
+		data, err := os.ReadFile(r.overlayPath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if err == nil {
+			if err := yaml.Unmarshal(data, &overlay); err != nil {
+				return fmt.Errorf("invalid model overlay %s: %w", r.overlayPath, err)
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.overlay = overlay
+	r.rebuild()
+	return nil
+}
+
+// SetDiscovered replaces the discovered models. A model the bootstrap data gives no creation
+// time keeps the one already known for it, if any.
+func (r *ModelRegistry) SetDiscovered(models []ModelInfo) {
+	discovered := make([]ModelInfo, 0, len(models))
+	for _, m := range models {
+		m.OwnedBy = "google"
+		m.Provider = "gemini"
+		discovered = append(discovered, m)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, m := range discovered {
+		if m.Created != 0 {
+			continue
+		}
+		if known, ok := r.index[m.ID]; ok && known.AliasOf == "" {
+			discovered[i].Created = known.Created
+		} else if def, ok := defaultModel(m.ID); ok {
+			discovered[i].Created = def.Created
+		}
+	}
+	r.discovered = discovered
+	r.rebuild()
+}
+
+// defaultModel returns the entry of DefaultModels with the given ID
+func defaultModel(id string) (ModelInfo, bool) {
+	for _, m := range DefaultModels {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return ModelInfo{}, false
+}
+
+// List returns all visible models, aliases included
+func (r *ModelRegistry) List() []ModelInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]ModelInfo(nil), r.models...)
+}
+
+// Get returns a model or alias by ID
+func (r *ModelRegistry) Get(id string) (ModelInfo, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	m, ok := r.index[id]
+	return m, ok
+}
+
+// Resolve maps an alias to the model it points at; other IDs are returned unchanged
+func (r *ModelRegistry) Resolve(id string) string {
+	if m, ok := r.Get(id); ok && m.AliasOf != "" {
+		return m.AliasOf
+	}
+	return id
+}
+
+// UpdatedAt returns when the model list last changed
+func (r *ModelRegistry) UpdatedAt() time.Time {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.updatedAt
+}
+
+// rebuild merges base models with the overlay. Callers must hold r.mu.
+func (r *ModelRegistry) rebuild() {
+	base := r.discovered
+	if len(base) == 0 {
+		base = DefaultModels
+	}
+
+	byID := make(map[string]ModelInfo, len(base))
+	var order []string
+	for _, m := range base {
+		if _, exists := byID[m.ID]; !exists {
+			order = append(order, m.ID)
+		}
+		byID[m.ID] = m
+	}
+
+	hidden := make(map[string]bool)
+	var aliases []ModelInfo
+	for _, o := range r.overlay.Models {
+		if o.ID == "" {
+			continue
+		}
+		m, exists := byID[o.ID]
+		if !exists {
+			m = ModelInfo{ID: o.ID, OwnedBy: "google", Provider: "gemini"}
+			order = append(order, o.ID)
+		}
+		if o.DisplayName != "" {
+			m.DisplayName = o.DisplayName
+		}
+		if o.Description != "" {
+			m.Description = o.Description
+		}
+		if o.OwnedBy != "" {
+			m.OwnedBy = o.OwnedBy
+		}
+		if len(o.Capabilities) > 0 {
+			m.Capabilities = o.Capabilities
+		}
+		if o.ContextWindow > 0 {
+			m.ContextWindow = o.ContextWindow
+		}
+		byID[o.ID] = m
+		hidden[o.ID] = o.Hidden
+
+		for _, alias := range o.Aliases {
+			alias = strings.TrimSpace(alias)
+			if alias == "" || alias == o.ID {
+				continue
+			}
+			aliases = append(aliases, ModelInfo{
+				ID:            alias,
+				Created:       m.Created,
+				OwnedBy:       m.OwnedBy,
+				Provider:      m.Provider,
+				DisplayName:   m.DisplayName,
+				Description:   m.Description,
+				Capabilities:  m.Capabilities,
+				AliasOf:       o.ID,
+				ContextWindow: m.ContextWindow,
+				Code:          m.Code,
+			})
+		}
+	}
+
+	index := make(map[string]ModelInfo, len(byID)+len(aliases))
+	models := make([]ModelInfo, 0, len(order)+len(aliases))
+	for _, id := range order {
+		m := byID[id]
+		index[id] = m
+		if !hidden[id] {
+			models = append(models, m)
+		}
+	}
+
+	sort.SliceStable(aliases, func(i, j int) bool { return aliases[i].ID < aliases[j].ID })
+	for _, a := range aliases {
+		if _, exists := index[a.ID]; exists {
+			r.log.Warn("Model alias shadows an existing model, ignoring", zap.String("alias", a.ID))
+			continue
+		}
+		index[a.ID] = a
+		models = append(models, a)
+	}
+
+	r.models = models
+	r.index = index
+	r.updatedAt = time.Now()
 }
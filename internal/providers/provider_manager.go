@@ -97,7 +97,7 @@ func (pm *ProviderManager) InitAllProviders(ctx context.Context) {
 		if err := provider.Init(ctx); err != nil {
 			// For Gemini specifically, log a more detailed error since authentication issues are common
 			if name == "gemini" {
-				pm.log.Error("Gemini provider initialization failed - check your cookies in config.yml. Common issues:", 
+				pm.log.Error("Gemini provider initialization failed - check the account cookies in your config file or environment. Common issues:", 
 					zap.String("provider", name), 
 					zap.Error(err),
 					zap.String("tip1", "__Secure-1PSID may be expired"),
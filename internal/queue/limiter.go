@@ -0,0 +1,205 @@
+// Package queue limits how many requests run against an upstream account at once.
+// Requests beyond the limit wait in one FIFO queue per priority; free slots are shared
+// between the priorities by weight, so lower priorities are slowed down but never starved.
+// Running requests are never preempted.
+package queue
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrQueueFull    = errors.New("too many requests queued")
+	ErrQueueTimeout = errors.New("timed out waiting in the request queue")
+)
+
+// Limiter is a counting semaphore that grants slots by weighted round-robin between
+// priorities, and in arrival order within a priority
+type Limiter struct {
+	mu       sync.Mutex
+	limit    int
+	maxQueue int           // waiting requests allowed over all priorities, 0 for no limit
+	maxWait  time.Duration // longest wait for a slot, 0 for no limit
+	weights  Weights
+	current  [numPriorities]int // smooth weighted round-robin state
+	active   int
+	waiting  [numPriorities]list.List // of chan struct{}, closed when the slot is granted
+}
+
+func NewLimiter(limit, maxQueue int, maxWait time.Duration) *Limiter {
+	l := &Limiter{weights: DefaultWeights}
+	l.SetLimits(limit, maxQueue, maxWait)
+	return l
+}
+
+// SetLimits changes the limits; raising the concurrency admits waiting requests right away
+func (l *Limiter) SetLimits(limit, maxQueue int, maxWait time.Duration) {
+	if limit < 1 {
+		limit = 1
+	}
+	l.mu.Lock()
+	l.limit = limit
+	l.maxQueue = maxQueue
+	l.maxWait = maxWait
+	l.grantLocked()
+	l.mu.Unlock()
+}
+
+// SetWeights changes how free slots are shared between priorities; weights below 1 count as 1
+func (l *Limiter) SetWeights(weights Weights) {
+	for i := range weights {
+		if weights[i] < 1 {
+			weights[i] = 1
+		}
+	}
+	l.mu.Lock()
+	l.weights = weights
+	l.current = [numPriorities]int{}
+	l.mu.Unlock()
+}
+
+// Acquire waits for a free slot, queued with the priority set on ctx.
+// The returned release must be called once the request is done.
+// It fails with ErrQueueFull when the queue is at its depth limit, ErrQueueTimeout when the
+// wait exceeds the limit, or the context's error when the caller gives up first; a request
+// that gives up is removed from the queue immediately.
+// The wait is recorded in the Stats attached to ctx, if any.
+func (l *Limiter) Acquire(ctx context.Context) (release func(), err error) {
+	start := time.Now()
+	stats := StatsFrom(ctx)
+	priority := PriorityFrom(ctx)
+	if stats != nil {
+		stats.Priority = priority
+	}
+
+	l.mu.Lock()
+	queued := l.queuedLocked()
+	if l.active < l.limit && queued == 0 {
+		l.active++
+		l.mu.Unlock()
+		return l.releaseFunc(), nil
+	}
+	if l.maxQueue > 0 && queued >= l.maxQueue {
+		l.mu.Unlock()
+		return nil, ErrQueueFull
+	}
+	ready := make(chan struct{})
+	elem := l.waiting[priority].PushBack(ready)
+	maxWait := l.maxWait
+	l.mu.Unlock()
+
+	if stats != nil {
+		stats.Position = queued + 1
+	}
+	defer func() {
+		if stats != nil {
+			stats.Wait = time.Since(start)
+		}
+	}()
+
+	var timeout <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case <-ready:
+		return l.releaseFunc(), nil
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrQueueTimeout
+	}
+
+	l.mu.Lock()
+	select {
+	case <-ready:
+		// The slot was granted while giving up; pass it on
+		l.mu.Unlock()
+		l.releaseFunc()()
+		return nil, err
+	default:
+		l.waiting[priority].Remove(elem)
+	}
+	l.mu.Unlock()
+	return nil, err
+}
+
+// Load reports the running and waiting requests
+func (l *Limiter) Load() (active, queued int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active, l.queuedLocked()
+}
+
+// QueuedByPriority reports the waiting requests of each priority
+func (l *Limiter) QueuedByPriority() map[string]int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	queued := make(map[string]int, numPriorities)
+	for p := range l.waiting {
+		queued[Priority(p).String()] = l.waiting[p].Len()
+	}
+	return queued
+}
+
+func (l *Limiter) queuedLocked() int {
+	n := 0
+	for p := range l.waiting {
+		n += l.waiting[p].Len()
+	}
+	return n
+}
+
+func (l *Limiter) releaseFunc() func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.mu.Lock()
+			l.active--
+			l.grantLocked()
+			l.mu.Unlock()
+		})
+	}
+}
+
+// grantLocked hands free slots to waiting requests
+func (l *Limiter) grantLocked() {
+	for l.active < l.limit {
+		p, ok := l.nextLocked()
+		if !ok {
+			return
+		}
+		ready := l.waiting[p].Remove(l.waiting[p].Front()).(chan struct{})
+		l.active++
+		close(ready)
+	}
+}
+
+// nextLocked picks the priority to serve next by smooth weighted round-robin over the
+// priorities with waiting requests: with weights 6:3:1 and all queues busy, 6 of every
+// 10 slots go to interactive requests, spread out rather than in a burst
+func (l *Limiter) nextLocked() (Priority, bool) {
+	best, total := -1, 0
+	for p := range l.waiting {
+		if l.waiting[p].Len() == 0 {
+			continue
+		}
+		l.current[p] += l.weights[p]
+		total += l.weights[p]
+		if best < 0 || l.current[p] > l.current[best] {
+			best = p
+		}
+	}
+	if best < 0 {
+		return 0, false
+	}
+	l.current[best] -= total
+	return Priority(best), true
+}
@@ -0,0 +1,179 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitQueued waits until n requests are waiting in the limiter
+func waitQueued(t *testing.T, l *Limiter, n int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, queued := l.Load(); queued == n {
+			return
+		}
+		if time.Now().After(deadline) {
+			_, queued := l.Load()
+			t.Fatalf("queued = %d, want %d", queued, n)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// grantOrder queues the requests one at a time behind a held slot, in the order given,
+// then frees the slot and returns the order in which they were served
+func grantOrder(t *testing.T, l *Limiter, priorities []Priority) []int {
+	t.Helper()
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+
+	var (
+		mu    sync.Mutex
+		order []int
+		wg    sync.WaitGroup
+	)
+	for i, p := range priorities {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := l.Acquire(WithPriority(context.Background(), p))
+			if err != nil {
+				t.Errorf("request %d: %v", i, err)
+				return
+			}
+			mu.Lock()
+			order = append(order, i)
+			mu.Unlock()
+			release()
+		}()
+		waitQueued(t, l, i+1)
+	}
+
+	release()
+	wg.Wait()
+	return order
+}
+
+func TestLimiterFIFOWithinPriority(t *testing.T) {
+	l := NewLimiter(1, 0, 0)
+	order := grantOrder(t, l, []Priority{PriorityBatch, PriorityBatch, PriorityBatch, PriorityBatch, PriorityBatch})
+	for i, got := range order {
+		if got != i {
+			t.Fatalf("served in order %v, want arrival order", order)
+		}
+	}
+}
+
+func TestLimiterSharesSlotsByWeight(t *testing.T) {
+	l := NewLimiter(1, 0, 0)
+
+	// Ten requests of each priority, research first so arrival order cannot explain the result
+	var priorities []Priority
+	for _, p := range []Priority{PriorityResearch, PriorityBatch, PriorityInteractive} {
+		for i := 0; i < 10; i++ {
+			priorities = append(priorities, p)
+		}
+	}
+	order := grantOrder(t, l, priorities)
+
+	var served [numPriorities]int
+	for _, i := range order[:10] {
+		served[priorities[i]]++
+	}
+	if served != [numPriorities]int{6, 3, 1} {
+		t.Errorf("first 10 slots went interactive:batch:research = %v, want 6:3:1", served)
+	}
+}
+
+func TestLimiterRemovesCancelledRequest(t *testing.T) {
+	l := NewLimiter(1, 0, 0)
+	release, err := l.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := l.Acquire(ctx)
+		done <- err
+	}()
+	waitQueued(t, l, 1)
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v, want context.Canceled", err)
+	}
+	if active, queued := l.Load(); active != 1 || queued != 0 {
+		t.Errorf("active %d, queued %d after cancel; want the request removed", active, queued)
+	}
+}
+
+func TestLimiterPassesOnSlotGrantedDuringCancel(t *testing.T) {
+	// Which of the granted slot and the cancellation a waiter sees first is up to the
+	// scheduler, so try until the slot has been granted to a request that gave up
+	passed := 0
+	for i := 0; i < 50; i++ {
+		l := NewLimiter(1, 0, 0)
+		if _, err := l.Acquire(context.Background()); err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		first := make(chan error)
+		go func() {
+			release, err := l.Acquire(ctx)
+			if err == nil {
+				release()
+			}
+			first <- err
+		}()
+		waitQueued(t, l, 1)
+
+		second := make(chan error)
+		go func() {
+			release, err := l.Acquire(context.Background())
+			if err == nil {
+				release()
+			}
+			second <- err
+		}()
+		waitQueued(t, l, 2)
+
+		// Cancel the first waiter and free the held slot, which goes to it, at once
+		l.mu.Lock()
+		cancel()
+		l.active--
+		l.grantLocked()
+		l.mu.Unlock()
+
+		err := <-first
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("first waiter: %v", err)
+			}
+			passed++
+		}
+		select {
+		case err := <-second:
+			if err != nil {
+				t.Fatalf("second waiter: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("the slot was not passed on to the next waiter")
+		}
+		if active, queued := l.Load(); active != 0 || queued != 0 {
+			t.Fatalf("active %d, queued %d; a slot leaked", active, queued)
+		}
+	}
+	if passed == 0 {
+		t.Error("no waiter gave up after its slot was granted")
+	}
+}
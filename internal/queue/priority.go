@@ -0,0 +1,61 @@
+package queue
+
+import (
+	"context"
+	"strings"
+)
+
+// Priority is the scheduling class of a request
+type Priority int
+
+const (
+	PriorityInteractive Priority = iota // chat and completions a person is waiting for
+	PriorityBatch                       // scripted bulk requests
+	PriorityResearch                    // Deep Research and other long jobs
+
+	numPriorities = 3
+)
+
+// DefaultWeights share free slots 6:3:1 between interactive, batch and research requests
+var DefaultWeights = Weights{6, 3, 1}
+
+// Weights are the relative shares of free slots each priority receives while several are waiting
+type Weights [numPriorities]int
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityBatch:
+		return "batch"
+	case PriorityResearch:
+		return "research"
+	}
+	return "interactive"
+}
+
+// ParsePriority reads a priority name as used in headers and config
+func ParsePriority(s string) (Priority, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "interactive":
+		return PriorityInteractive, true
+	case "batch":
+		return PriorityBatch, true
+	case "research":
+		return PriorityResearch, true
+	}
+	return PriorityInteractive, false
+}
+
+type priorityKey struct{}
+
+// WithPriority sets the priority the limiter queues a request with
+func WithPriority(ctx context.Context, p Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, p)
+}
+
+// PriorityFrom returns the priority set on ctx, interactive by default
+func PriorityFrom(ctx context.Context) Priority {
+	if p, ok := ctx.Value(priorityKey{}).(Priority); ok {
+		return p
+	}
+	return PriorityInteractive
+}
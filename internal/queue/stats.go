@@ -0,0 +1,27 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Stats records how a request went through the queue, for reporting in response headers
+type Stats struct {
+	Wait     time.Duration // time spent waiting for a slot
+	Position int           // requests waiting ahead on arrival plus one, 0 when a slot was free
+	Priority Priority
+}
+
+type statsKey struct{}
+
+// WithStats attaches a Stats to ctx that the limiter fills in
+func WithStats(ctx context.Context) (context.Context, *Stats) {
+	stats := &Stats{}
+	return context.WithValue(ctx, statsKey{}, stats), stats
+}
+
+// StatsFrom returns the Stats attached to ctx, or nil
+func StatsFrom(ctx context.Context) *Stats {
+	stats, _ := ctx.Value(statsKey{}).(*Stats)
+	return stats
+}
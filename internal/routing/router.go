@@ -0,0 +1,169 @@
+package routing
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/prompts"
+
+	"go.uber.org/zap"
+)
+
+// API flavors a rule can be scoped to
+const (
+	FlavorOpenAI = "openai"
+	FlavorClaude = "claude"
+	FlavorGemini = "gemini"
+)
+
+// Route is the outcome of resolving an incoming model name
+type Route struct {
+	Model        string // Gemini model to use, echoed back to the client
+	DeepResearch bool
+	Gem          string // Gem name or ID, empty when not routed to a Gem
+	SystemPrompt string // default system prompt, used when the request has none
+	Template     string // prompt template named by the rule, empty for the configured default
+	Rule         int    // index of the matching rule, -1 when no rule matched
+}
+
+type rule struct {
+	config.RouteRule
+	re *regexp.Regexp
+}
+
+// Router applies the configured routing table
+type Router struct {
+	mu    sync.RWMutex
+	rules []rule
+	log   *zap.Logger
+}
+
+// NewRouter compiles the routing table from config
+func NewRouter(cfg *config.Config, log *zap.Logger) (*Router, error) {
+	rules, err := compileRules(cfg.Routing.Rules)
+	if err != nil {
+		return nil, err
+	}
+	if len(rules) > 0 {
+		log.Info("Model routing rules loaded", zap.Int("rules", len(rules)), zap.String("file", cfg.Routing.File))
+	}
+	return &Router{rules: rules, log: log}, nil
+}
+
+// Reload swaps in a new routing table; the current one is kept if it does not compile
+func (r *Router) Reload(routeRules []config.RouteRule) error {
+	rules, err := compileRules(routeRules)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.rules = rules
+	r.mu.Unlock()
+	return nil
+}
+
+func compileRules(routeRules []config.RouteRule) ([]rule, error) {
+	rules := make([]rule, 0, len(routeRules))
+	for i, r := range routeRules {
+		switch r.Flavor {
+		case "", FlavorOpenAI, FlavorClaude, FlavorGemini:
+		default:
+			return nil, fmt.Errorf("route %d: unknown flavor %q", i, r.Flavor)
+		}
+		if r.Pattern == "" {
+			return nil, fmt.Errorf("route %d: pattern is required", i)
+		}
+		if _, ok := prompts.Lookup(r.Template); !ok {
+			return nil, fmt.Errorf("route %d: unknown prompt template %q", i, r.Template)
+		}
+
+		compiled := rule{RouteRule: r}
+		switch r.Match {
+		case "", "exact", "prefix":
+		case "regex":
+			re, err := regexp.Compile(r.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("route %d: invalid regex %q: %w", i, r.Pattern, err)
+			}
+			compiled.re = re
+		default:
+			return nil, fmt.Errorf("route %d: unknown match type %q", i, r.Match)
+		}
+		rules = append(rules, compiled)
+	}
+	return rules, nil
+}
+
+// Resolve maps a model name received on the given API flavor to a Route.
+// The first matching rule wins; without a match the model is used as-is.
+func (r *Router) Resolve(flavor string, model string) Route {
+	r.mu.RLock()
+	rules := r.rules
+	r.mu.RUnlock()
+
+	for i, rl := range rules {
+		if rl.Flavor != "" && rl.Flavor != flavor {
+			continue
+		}
+
+		target, ok := rl.match(model)
+		if !ok {
+			continue
+		}
+		if target == "" {
+			target = model
+		}
+
+		route := Route{
+			Model:        target,
+			DeepResearch: isDeepResearchModel(target),
+			Gem:          rl.Gem,
+			SystemPrompt: rl.SystemPrompt,
+			Template:     rl.Template,
+			Rule:         i,
+		}
+		if rl.DeepResearch != nil {
+			route.DeepResearch = *rl.DeepResearch
+		}
+
+		r.log.Debug("Model routed",
+			zap.String("flavor", flavor),
+			zap.String("requested", model),
+			zap.String("resolved", route.Model),
+			zap.Int("rule", i),
+		)
+		return route
+	}
+
+	return Route{
+		Model:        model,
+		DeepResearch: isDeepResearchModel(model),
+		Rule:         -1,
+	}
+}
+
+// match reports whether the rule applies and returns the expanded target
+func (rl rule) match(model string) (string, bool) {
+	switch rl.Match {
+	case "prefix":
+		return rl.Target, strings.HasPrefix(model, rl.Pattern)
+	case "regex":
+		m := rl.re.FindStringSubmatchIndex(model)
+		if m == nil {
+			return "", false
+		}
+		if rl.Target == "" {
+			return "", true
+		}
+		return string(rl.re.ExpandString(nil, rl.Target, model, m)), true
+	default:
+		return rl.Target, model == rl.Pattern
+	}
+}
+
+func isDeepResearchModel(model string) bool {
+	return strings.Contains(model, "deep-research")
+}
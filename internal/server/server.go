@@ -6,9 +6,11 @@ import (
 	"sync"
 	"time"
 
+	"gemini-web-to-api/internal/cache"
 	"gemini-web-to-api/internal/config"
 	"gemini-web-to-api/internal/controllers"
 	"gemini-web-to-api/internal/handlers"
+	"gemini-web-to-api/internal/routing"
 	"gemini-web-to-api/pkg/logger"
 
 	"github.com/gofiber/fiber/v2"
@@ -24,28 +26,33 @@ type Server struct {
 	geminiHandler  *handlers.GeminiHandler
 	openaiHandler  *handlers.OpenAIHandler
 	claudeHandler  *handlers.ClaudeHandler
+	adminHandler   *handlers.AdminHandler
 	cfg            *config.Config
+	store          *config.Store
 	log            *zap.Logger
 	appMu          sync.Mutex
 }
 
-func New(lc fx.Lifecycle, geminiHandler *handlers.GeminiHandler, openaiHandler *handlers.OpenAIHandler, claudeHandler *handlers.ClaudeHandler, cfg *config.Config, log *zap.Logger) (*Server, error) {
+func New(lc fx.Lifecycle, geminiHandler *handlers.GeminiHandler, openaiHandler *handlers.OpenAIHandler, claudeHandler *handlers.ClaudeHandler, adminHandler *handlers.AdminHandler, cfg *config.Config, store *config.Store, log *zap.Logger) (*Server, error) {
 	// Inject logger into handlers
 	geminiHandler.SetLogger(log)
 	openaiHandler.SetLogger(log)
 	claudeHandler.SetLogger(log)
+	adminHandler.SetLogger(log)
 
 	server := &Server{
 		geminiHandler: geminiHandler,
 		openaiHandler: openaiHandler,
 		claudeHandler: claudeHandler,
+		adminHandler:  adminHandler,
 		cfg:           cfg,
+		store:         store,
 		log:           log,
 	}
 
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
-			app := buildApp(log, geminiHandler, openaiHandler, claudeHandler)
+			app := buildApp(log, store, geminiHandler, openaiHandler, claudeHandler, adminHandler)
 			
 			server.appMu.Lock()
 			server.app = app
@@ -90,7 +97,7 @@ func (s *Server) startServerWithFallback() error {
 		s.log.Info("Attempting to start server on alternative port", zap.String("port", altPort))
 		
 		// Create new app instance for each attempt
-		altApp := buildApp(s.log, s.geminiHandler, s.openaiHandler, s.claudeHandler)
+		altApp := buildApp(s.log, s.store, s.geminiHandler, s.openaiHandler, s.claudeHandler, s.adminHandler)
 		
 		if err := altApp.Listen(":" + altPort); err == nil {
 			s.log.Info("Server started successfully on alternative port", zap.String("port", altPort))
@@ -109,35 +116,41 @@ func (s *Server) startServerWithFallback() error {
 }
 
 // buildApp creates and configures a Fiber app with all middleware and routes
-func buildApp(log *zap.Logger, geminiHandler *handlers.GeminiHandler, openaiHandler *handlers.OpenAIHandler, claudeHandler *handlers.ClaudeHandler) *fiber.App {
+func buildApp(log *zap.Logger, store *config.Store, geminiHandler *handlers.GeminiHandler, openaiHandler *handlers.OpenAIHandler, claudeHandler *handlers.ClaudeHandler, adminHandler *handlers.AdminHandler) *fiber.App {
 	app := fiber.New(fiber.Config{
 		AppName: "AI Bridges API",
 	})
 
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-Requested-With, x-api-key, anthropic-version",
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, X-Requested-With, x-api-key, x-goog-api-key, anthropic-version, X-Gemini-Ephemeral, " + handlers.HeaderPriority,
 		AllowMethods: "GET, POST, PUT, DELETE, OPTIONS, PATCH",
+		ExposeHeaders: handlers.HeaderQueueWait + ", " + handlers.HeaderQueuePosition + ", " + handlers.HeaderQueuePriority + ", " + cache.HeaderName + ", " + fiber.HeaderAge + ", " +
+			handlers.HeaderContextTruncated + ", " + handlers.HeaderContextDropped + ", " + handlers.HeaderContextSummarized + ", Retry-After, x-should-retry",
 	}))
 	
 	app.Use(logger.NewMiddleware(log))
 	app.Use(recover.New())
 
 	// --- Gemini routes (prefixed with /gemini) ---
-	geminiGroup := app.Group("/gemini")
+	geminiGroup := app.Group("/gemini", handlers.NewAuthMiddleware(store, routing.FlavorGemini))
 	geminiV1 := geminiGroup.Group("/v1beta")
 	controllers.NewGeminiController(geminiHandler).Register(geminiV1)
 
 	// --- OpenAI routes (prefixed with /openai) ---
-	openaiGroup := app.Group("/openai")
+	openaiGroup := app.Group("/openai", handlers.NewAuthMiddleware(store, routing.FlavorOpenAI))
 	openaiV1 := openaiGroup.Group("/v1")
 	controllers.NewOpenAIController(openaiHandler).Register(openaiV1)
 
 	// --- Claude routes (prefixed with /claude) ---
-	claudeGroup := app.Group("/claude")
+	claudeGroup := app.Group("/claude", handlers.NewAuthMiddleware(store, routing.FlavorClaude))
 	claudeV1 := claudeGroup.Group("/v1")
 	controllers.NewClaudeController(claudeHandler).Register(claudeV1)
 
+	// --- Admin routes (disabled unless admin API keys are configured) ---
+	adminGroup := app.Group("/admin", handlers.NewAdminAuthMiddleware(store))
+	controllers.NewAdminController(adminHandler).Register(adminGroup)
+
 	app.Get("/swagger/*", fiberSwagger.WrapHandler)
 
 	app.Get("/health", func(c *fiber.Ctx) error {
@@ -147,14 +160,19 @@ func buildApp(log *zap.Logger, geminiHandler *handlers.GeminiHandler, openaiHand
 			status = "degraded"
 		}
 
+		geminiStatus := fiber.Map{
+			"healthy": geminiHealthy,
+		}
+		if reason := geminiHandler.UnhealthyReason(); !geminiHealthy && reason != "" {
+			geminiStatus["reason"] = reason
+		}
+
 		health := fiber.Map{
 			"status":    status,
 			"service":   "gemini-web-to-api",
 			"timestamp": time.Now().Unix(),
 			"providers": fiber.Map{
-				"gemini": fiber.Map{
-					"healthy": geminiHealthy,
-				},
+				"gemini": geminiStatus,
 			},
 		}
 		
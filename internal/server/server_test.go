@@ -0,0 +1,616 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gemini-web-to-api/internal/cache"
+	"gemini-web-to-api/internal/coalesce"
+	"gemini-web-to-api/internal/config"
+	"gemini-web-to-api/internal/contextwindow"
+	"gemini-web-to-api/internal/ephemeral"
+	"gemini-web-to-api/internal/handlers"
+	"gemini-web-to-api/internal/providers/gemini"
+	"gemini-web-to-api/internal/providers/gemini/geminitest"
+	"gemini-web-to-api/internal/routing"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/fx/fxtest"
+	"go.uber.org/zap/zaptest"
+)
+
+// newApp builds the full API against a fake Gemini
+func newApp(t *testing.T) (*fiber.App, *geminitest.Server) {
+	t.Helper()
+	fake := geminitest.NewServer()
+	t.Cleanup(fake.Close)
+	fake.Setenv(t)
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatalf("load config: %v", err)
+	}
+	log := zaptest.NewLogger(t)
+	lc := fxtest.NewLifecycle(t)
+
+	client, err := gemini.NewClient(cfg, log)
+	if err != nil {
+		t.Fatalf("new client: %v", err)
+	}
+	if err := client.Init(context.Background()); err != nil {
+		t.Fatalf("init: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	store := config.NewStore(lc, cfg, log)
+	router, err := routing.NewRouter(cfg, log)
+	if err != nil {
+		t.Fatalf("new router: %v", err)
+	}
+	em := ephemeral.NewManager(lc, cfg, client, log)
+	rc, err := cache.New(cfg, log)
+	if err != nil {
+		t.Fatalf("new cache: %v", err)
+	}
+
+	flights := coalesce.NewGroup()
+	window := contextwindow.NewManager(cfg, client, em, log)
+
+	app := buildApp(log, store,
+		handlers.NewGeminiHandler(client, em, rc, flights, window, router, store),
+		handlers.NewOpenAIHandler(client, em, rc, flights, window, router, store),
+		handlers.NewClaudeHandler(client, em, rc, flights, window, router, store),
+		handlers.NewAdminHandler(client),
+	)
+	return app, fake
+}
+
+func post(t *testing.T, app *fiber.App, path, body string) (*http.Response, map[string]interface{}) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("POST %s: %v", path, err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	var decoded map[string]interface{}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("POST %s: invalid JSON %q", path, data)
+	}
+	return resp, decoded
+}
+
+func TestOpenAIChatCompletion(t *testing.T) {
+	app, _ := newApp(t)
+
+	resp, body := post(t, app, "/openai/v1/chat/completions",
+		`{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+	}
+	choices, _ := body["choices"].([]interface{})
+	if len(choices) != 1 {
+		t.Fatalf("choices = %v", body["choices"])
+	}
+	content := choices[0].(map[string]interface{})["message"].(map[string]interface{})["content"]
+	if content != "You said: User: hi" {
+		t.Errorf("content = %q", content)
+	}
+	if resp.Header.Get(handlers.HeaderQueuePosition) == "" {
+		t.Error("queue headers missing")
+	}
+}
+
+func TestClaudeMessageRateLimited(t *testing.T) {
+	app, fake := newApp(t)
+	fake.FailNext(geminitest.Generate, geminitest.UsageLimit())
+
+	resp, body := post(t, app, "/claude/v1/messages",
+		`{"model":"gemini-2.5-flash","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`)
+	if resp.StatusCode != http.StatusTooManyRequests {
+		t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+	}
+	if errType := body["error"].(map[string]interface{})["type"]; errType != "rate_limit_error" {
+		t.Errorf("error type = %v", errType)
+	}
+	if resp.Header.Get("x-should-retry") != "true" {
+		t.Errorf("x-should-retry = %q", resp.Header.Get("x-should-retry"))
+	}
+}
+
+func TestInvalidAPIKeyIsUnauthorized(t *testing.T) {
+	t.Setenv("GEMINI_API_KEYS", "secret")
+	app, _ := newApp(t)
+
+	resp, body := post(t, app, "/gemini/v1beta/models/gemini-2.5-flash:generateContent?key=wrong",
+		`{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`)
+	if resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+	}
+	if status := body["error"].(map[string]interface{})["status"]; status != "UNAUTHENTICATED" {
+		t.Errorf("error status = %v", status)
+	}
+}
+
+func TestGeminiGenerateContentSessionExpired(t *testing.T) {
+	app, fake := newApp(t)
+	fake.ExpireSession()
+	fake.FailNext(geminitest.RotateCookies, geminitest.ServerError())
+
+	resp, body := post(t, app, "/gemini/v1beta/models/gemini-2.5-flash:generateContent",
+		`{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`)
+	// The proxy's session expired, not the caller's key: a retryable 503 rather than a 401
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+	}
+	if status := body["error"].(map[string]interface{})["status"]; status != "UNAVAILABLE" {
+		t.Errorf("error status = %v", status)
+	}
+	if resp.Header.Get("x-should-retry") != "true" {
+		t.Errorf("x-should-retry = %q", resp.Header.Get("x-should-retry"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/health", nil)
+	healthResp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("GET /health: %v", err)
+	}
+	var health struct {
+		Status string `json:"status"`
+	}
+	_ = json.NewDecoder(healthResp.Body).Decode(&health)
+	if health.Status != "degraded" {
+		t.Errorf("health = %q, want degraded", health.Status)
+	}
+}
+
+func TestGeminiConversationErrorsAreClassified(t *testing.T) {
+	app, fake := newApp(t)
+	fake.FailNext(geminitest.BatchExecute, geminitest.RateLimited(time.Hour))
+
+	resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/gemini/v1beta/conversations", nil), -1)
+	if err != nil {
+		t.Fatalf("GET /gemini/v1beta/conversations: %v", err)
+	}
+	var body struct {
+		Error struct {
+			Status string `json:"status"`
+		} `json:"error"`
+	}
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	if resp.StatusCode != http.StatusTooManyRequests || body.Error.Status != "RESOURCE_EXHAUSTED" {
+		t.Errorf("status = %d %q, want 429 RESOURCE_EXHAUSTED", resp.StatusCode, body.Error.Status)
+	}
+	if resp.Header.Get(fiber.HeaderRetryAfter) != "3600" {
+		t.Errorf("Retry-After = %q", resp.Header.Get(fiber.HeaderRetryAfter))
+	}
+}
+
+func TestThinkingContent(t *testing.T) {
+	tests := []struct {
+		name, path, body, bodyWithThinking string
+		thinking                           func(body map[string]interface{}) interface{}
+	}{
+		{
+			name: "claude",
+			path: "/claude/v1/messages",
+			body: `{"model":"gemini-2.5-pro","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`,
+			bodyWithThinking: `{"model":"gemini-2.5-pro","max_tokens":100,"thinking":{"type":"enabled","budget_tokens":1024},` +
+				`"messages":[{"role":"user","content":"hi"}]}`,
+			thinking: func(body map[string]interface{}) interface{} {
+				block := body["content"].([]interface{})[0].(map[string]interface{})
+				if block["type"] != "thinking" {
+					return nil
+				}
+				return block["thinking"]
+			},
+		},
+		{
+			name:             "openai",
+			path:             "/openai/v1/chat/completions",
+			body:             `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}]}`,
+			bodyWithThinking: `{"model":"gemini-2.5-pro","include_reasoning":true,"messages":[{"role":"user","content":"hi"}]}`,
+			thinking: func(body map[string]interface{}) interface{} {
+				choice := body["choices"].([]interface{})[0].(map[string]interface{})
+				return choice["message"].(map[string]interface{})["reasoning_content"]
+			},
+		},
+		{
+			name: "gemini",
+			path: "/gemini/v1beta/models/gemini-2.5-pro:generateContent",
+			body: `{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`,
+			bodyWithThinking: `{"contents":[{"role":"user","parts":[{"text":"hi"}]}],` +
+				`"generationConfig":{"thinkingConfig":{"includeThoughts":true}}}`,
+			thinking: func(body map[string]interface{}) interface{} {
+				candidate := body["candidates"].([]interface{})[0].(map[string]interface{})
+				part := candidate["content"].(map[string]interface{})["parts"].([]interface{})[0].(map[string]interface{})
+				if part["thought"] != true {
+					return nil
+				}
+				return part["text"]
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, fake := newApp(t)
+			fake.SetThinking(func(prompt string) string { return "Thinking about " + prompt })
+
+			resp, body := post(t, app, tt.path, tt.body)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+			}
+			if got := tt.thinking(body); got != nil {
+				t.Errorf("thinking returned without being requested: %v", got)
+			}
+
+			resp, body = post(t, app, tt.path, tt.bodyWithThinking)
+			if resp.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+			}
+			if got := tt.thinking(body); got == nil || !strings.HasPrefix(got.(string), "Thinking about ") {
+				t.Errorf("thinking = %v", got)
+			}
+		})
+	}
+}
+
+func TestClaudeStreamThinking(t *testing.T) {
+	app, fake := newApp(t)
+	fake.SetThinking(func(prompt string) string { return "Thinking about " + prompt })
+
+	req := httptest.NewRequest(http.MethodPost, "/claude/v1/messages", strings.NewReader(
+		`{"model":"gemini-2.5-pro","max_tokens":100,"stream":true,"thinking":{"type":"enabled"},`+
+			`"messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	events := string(data)
+
+	thinking := strings.Index(events, `"type":"thinking_delta"`)
+	text := strings.Index(events, `"type":"text_delta"`)
+	if thinking < 0 || text < thinking {
+		t.Fatalf("want thinking deltas before text deltas, got:\n%s", events)
+	}
+	if !strings.Contains(events, `"content_block":{"type":"text","text":""},"index":1`) {
+		t.Errorf("text block should follow the thinking block at index 1:\n%s", events)
+	}
+}
+
+func TestCitations(t *testing.T) {
+	app, fake := newApp(t)
+	fake.SetReply(func(string) string { return "Café prices rose 5% in 2024 😀 according to the survey." })
+	fake.SetCitations([]geminitest.Source{
+		{Title: "Survey", URL: "https://example.com/survey"},
+		{Title: "News", URL: "https://example.com/news"},
+	}, geminitest.Citation{Text: "according to the survey", Sources: []int{0, 1}})
+
+	_, body := post(t, app, "/gemini/v1beta/models/gemini-2.5-pro:generateContent",
+		`{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`)
+	candidate := body["candidates"].([]interface{})[0].(map[string]interface{})
+	metadata, _ := candidate["groundingMetadata"].(map[string]interface{})
+	if chunks, _ := metadata["groundingChunks"].([]interface{}); len(chunks) != 2 {
+		t.Fatalf("grounding metadata = %v", metadata)
+	}
+	segment := metadata["groundingSupports"].([]interface{})[0].(map[string]interface{})["segment"].(map[string]interface{})
+	if segment["text"] != "according to the survey" {
+		t.Errorf("segment = %v", segment)
+	}
+
+	_, body = post(t, app, "/openai/v1/chat/completions",
+		`{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}]}`)
+	message := body["choices"].([]interface{})[0].(map[string]interface{})["message"].(map[string]interface{})
+	annotations, _ := message["annotations"].([]interface{})
+	if len(annotations) != 2 {
+		t.Fatalf("annotations = %v", message["annotations"])
+	}
+	citation := annotations[0].(map[string]interface{})["url_citation"].(map[string]interface{})
+	text := []rune(message["content"].(string))
+	if got := string(text[int(citation["start_index"].(float64)):int(citation["end_index"].(float64))]); got != "according to the survey" {
+		t.Errorf("annotated span = %q", got)
+	}
+
+	_, body = post(t, app, "/claude/v1/messages",
+		`{"model":"gemini-2.5-pro","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`)
+	blocks := body["content"].([]interface{})
+	if len(blocks) != 3 {
+		t.Fatalf("content = %v", blocks)
+	}
+	cited := blocks[1].(map[string]interface{})
+	citations, _ := cited["citations"].([]interface{})
+	if cited["text"] != "according to the survey" || len(citations) != 2 {
+		t.Errorf("cited block = %v", cited)
+	}
+}
+
+func TestRichContent(t *testing.T) {
+	app, fake := newApp(t)
+	fake.SetReply(func(string) string {
+		return "Running it:\n\n```python\nprint(6 * 7)\n```\n```code_output\n42\n```\n\nThe answer is 42."
+	})
+	fake.SetImages(
+		[]geminitest.Image{{URL: "https://example.com/chart.png", Alt: "chart"}},
+		[]geminitest.Image{{URL: "https://example.com/photo.jpg", Title: "Photo"}},
+	)
+
+	_, body := post(t, app, "/gemini/v1beta/models/gemini-2.5-pro:generateContent",
+		`{"contents":[{"role":"user","parts":[{"text":"hi"}]}]}`)
+	candidate := body["candidates"].([]interface{})[0].(map[string]interface{})
+	var kinds []string
+	for _, p := range candidate["content"].(map[string]interface{})["parts"].([]interface{}) {
+		for key := range p.(map[string]interface{}) {
+			kinds = append(kinds, key)
+		}
+	}
+	if got, want := strings.Join(kinds, ","), "text,executableCode,codeExecutionResult,text,fileData,fileData"; got != want {
+		t.Errorf("gemini parts = %s, want %s", got, want)
+	}
+
+	_, body = post(t, app, "/openai/v1/chat/completions",
+		`{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}]}`)
+	content := body["choices"].([]interface{})[0].(map[string]interface{})["message"].(map[string]interface{})["content"].(string)
+	for _, want := range []string{"```python\nprint(6 * 7)\n```", "```code_output\n42\n```", "![chart](https://example.com/chart.png)", "![Photo](https://example.com/photo.jpg)"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("openai content lacks %q:\n%s", want, content)
+		}
+	}
+	if strings.Contains(content, "image_generation_content") {
+		t.Errorf("image placeholder left in content:\n%s", content)
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	t.Setenv("CACHE_ENABLED", "true")
+	app, fake := newApp(t)
+
+	send := func(body, header, value string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/openai/v1/chat/completions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		resp, err := app.Test(req, -1)
+		if err != nil {
+			t.Fatalf("POST: %v", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d", resp.StatusCode)
+		}
+		return resp
+	}
+
+	steps := []struct {
+		name, body, header, value, want string
+		upstream                        int
+	}{
+		{"first request", `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}]}`, "", "", "MISS", 1},
+		{"same prompt, other whitespace", `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi  \r\n"}]}`, "", "", "HIT", 1},
+		{"client bypass", `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}]}`, "Cache-Control", "no-cache", "BYPASS", 2},
+		{"other model", `{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`, "", "", "MISS", 3},
+		{"sampled", `{"model":"gemini-2.5-pro","temperature":0.7,"messages":[{"role":"user","content":"hi"}]}`, "", "", "BYPASS", 4},
+		{"ephemeral", `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"keep this private"}]}`, ephemeral.HeaderName, "true", "BYPASS", 5},
+		{"after ephemeral", `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"keep this private"}]}`, "", "", "MISS", 6},
+	}
+	for _, step := range steps {
+		resp := send(step.body, step.header, step.value)
+		if got := resp.Header.Get(cache.HeaderName); got != step.want {
+			t.Errorf("%s: %s = %q, want %q", step.name, cache.HeaderName, got, step.want)
+		}
+		if got := fake.Hits(geminitest.Generate); got != step.upstream {
+			t.Errorf("%s: upstream requests = %d, want %d", step.name, got, step.upstream)
+		}
+		if step.want == "HIT" && resp.Header.Get("Age") == "" {
+			t.Errorf("%s: hit without an Age header", step.name)
+		}
+	}
+}
+
+func TestConcurrentIdenticalRequestsAreCoalesced(t *testing.T) {
+	app, fake := newApp(t)
+	fake.SetReply(func(prompt string) string {
+		time.Sleep(300 * time.Millisecond) // long enough for every request to arrive
+		return "Shared answer to " + prompt
+	})
+
+	requests := []struct{ path, body, want string }{
+		{"/openai/v1/chat/completions", `{"model":"gemini-2.5-pro","messages":[{"role":"user","content":"hi"}]}`, `"content":"Shared answer`},
+		{"/openai/v1/chat/completions", `{"model":"gemini-2.5-pro","stream":true,"messages":[{"role":"user","content":"hi"}]}`, `"content":"Shared `},
+		{"/claude/v1/messages", `{"model":"gemini-2.5-pro","max_tokens":100,"messages":[{"role":"user","content":"hi"}]}`, `"text":"Shared answer`},
+		{"/claude/v1/messages", `{"model":"gemini-2.5-pro","max_tokens":100,"stream":true,"messages":[{"role":"user","content":"hi"}]}`, `"text":"Shared `},
+	}
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		queued int
+	)
+	for _, r := range requests {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, r.path, strings.NewReader(r.body))
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := app.Test(req, -1)
+			if err != nil {
+				t.Errorf("POST %s: %v", r.path, err)
+				return
+			}
+			data, _ := io.ReadAll(resp.Body)
+			if !strings.Contains(string(data), r.want) {
+				t.Errorf("POST %s: response lacks %s:\n%s", r.path, r.want, data)
+			}
+			if resp.Header.Get(handlers.HeaderQueuePosition) != "" {
+				mu.Lock()
+				queued++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := fake.Hits(geminitest.Generate); got != 1 {
+		t.Errorf("upstream requests = %d, want 1", got)
+	}
+	// Only the request that went through the queue reports its wait
+	if queued > 1 {
+		t.Errorf("%d responses carry queue headers, want at most the one that queued", queued)
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	long := strings.Repeat("word ", 50)
+	body := `{"model":"gemini-2.5-pro","messages":[` +
+		`{"role":"system","content":"Be brief."},` +
+		`{"role":"user","content":"` + long + `"},` +
+		`{"role":"assistant","content":"ok"},` +
+		`{"role":"user","content":"last question"}]}`
+
+	t.Run("reject", func(t *testing.T) {
+		t.Setenv("CONTEXT_MAX_TOKENS", "30")
+		app, fake := newApp(t)
+
+		resp, decoded := post(t, app, "/openai/v1/chat/completions", body)
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("status = %d, body %v", resp.StatusCode, decoded)
+		}
+		if code := decoded["error"].(map[string]interface{})["code"]; code != "context_length_exceeded" {
+			t.Errorf("code = %v", code)
+		}
+		if got := fake.Hits(geminitest.Generate); got != 0 {
+			t.Errorf("upstream requests = %d, want 0", got)
+		}
+	})
+
+	t.Run("drop oldest", func(t *testing.T) {
+		t.Setenv("CONTEXT_MAX_TOKENS", "30")
+		t.Setenv("CONTEXT_STRATEGY", "drop_oldest")
+		app, _ := newApp(t)
+
+		resp, decoded := post(t, app, "/openai/v1/chat/completions", body)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("status = %d, body %v", resp.StatusCode, decoded)
+		}
+		if got := resp.Header.Get(handlers.HeaderContextTruncated); got != "drop_oldest" {
+			t.Errorf("%s = %q", handlers.HeaderContextTruncated, got)
+		}
+		if got := resp.Header.Get(handlers.HeaderContextDropped); got != "1" {
+			t.Errorf("%s = %q, want 1", handlers.HeaderContextDropped, got)
+		}
+		content := decoded["choices"].([]interface{})[0].(map[string]interface{})["message"].(map[string]interface{})["content"]
+		if content != "You said: System: Be brief.\nModel: ok\nUser: last question" {
+			t.Errorf("content = %q", content)
+		}
+	})
+}
+
+func TestPromptTemplate(t *testing.T) {
+	t.Setenv("PROMPT_TEMPLATE", "xml")
+	app, fake := newApp(t)
+	var prompts []string
+	fake.SetReply(func(prompt string) string {
+		prompts = append(prompts, prompt)
+		return "<model>\nHi there\n</model>"
+	})
+
+	resp, body := post(t, app, "/openai/v1/chat/completions",
+		`{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+	}
+	content := body["choices"].([]interface{})[0].(map[string]interface{})["message"].(map[string]interface{})["content"]
+	if content != "Hi there" {
+		t.Errorf("content = %q, want the reply without echoed tags", content)
+	}
+	if len(prompts) != 1 || !strings.Contains(prompts[0], "<user>\nhi\n</user>") {
+		t.Errorf("prompts = %q", prompts)
+	}
+
+	// The Gemini API uses the configured template too
+	post(t, app, "/gemini/v1beta/models/gemini-2.5-flash:generateContent",
+		`{"contents":[{"role":"user","parts":[{"text":"hello"}]}]}`)
+	if len(prompts) != 2 || !strings.Contains(prompts[1], "<user>\nhello\n</user>") {
+		t.Errorf("prompts = %q", prompts)
+	}
+}
+
+func TestGeminiContentsAreSentAsTheyAreWithoutTemplate(t *testing.T) {
+	app, fake := newApp(t)
+	var prompts []string
+	fake.SetReply(func(prompt string) string {
+		prompts = append(prompts, prompt)
+		return "Hi there"
+	})
+
+	post(t, app, "/gemini/v1beta/models/gemini-2.5-flash:generateContent",
+		`{"contents":[{"role":"user","parts":[{"text":"hello"}]},{"role":"model","parts":[{"text":"hi"}]},{"role":"user","parts":[{"text":"again"}]}]}`)
+	if len(prompts) != 1 || prompts[0] != "hello\nhi\nagain" {
+		t.Errorf("prompts = %q", prompts)
+	}
+
+	// The chat APIs still default to the transcript template
+	post(t, app, "/openai/v1/chat/completions",
+		`{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"},{"role":"assistant","content":"ok"},{"role":"user","content":"bye"}]}`)
+	if len(prompts) != 2 || prompts[1] != "User: hi\nModel: ok\nUser: bye" {
+		t.Errorf("prompts = %q", prompts)
+	}
+}
+
+func TestModelAliasReachesUpstreamAsItsTarget(t *testing.T) {
+	overlay := filepath.Join(t.TempDir(), "models.yaml")
+	if err := os.WriteFile(overlay, []byte("models:\n  - id: gemini-2.5-pro\n    aliases: [gpt-4o]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GEMINI_MODELS_FILE", overlay)
+	app, fake := newApp(t)
+
+	resp, body := post(t, app, "/openai/v1/chat/completions",
+		`{"model":"gpt-4o","messages":[{"role":"user","content":"hi"}]}`)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, body %v", resp.StatusCode, body)
+	}
+	post(t, app, "/claude/v1/messages",
+		`{"model":"gpt-4o","max_tokens":100,"messages":[{"role":"user","content":"hello"}]}`)
+	post(t, app, "/openai/v1/chat/completions",
+		`{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hey"}]}`)
+
+	want := []string{"gemini-2.5-pro", "gemini-2.5-pro", "gemini-2.5-flash"}
+	if got := fake.Models(); strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("upstream models = %q, want %q", got, want)
+	}
+}
+
+func TestCORSExposesResponseHeaders(t *testing.T) {
+	app, _ := newApp(t)
+
+	req := httptest.NewRequest(http.MethodPost, "/openai/v1/chat/completions",
+		strings.NewReader(`{"model":"gemini-2.5-flash","messages":[{"role":"user","content":"hi"}]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Origin", "https://app.example.com")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+
+	exposed := resp.Header.Get("Access-Control-Expose-Headers")
+	for _, header := range []string{
+		handlers.HeaderQueuePosition, cache.HeaderName, "Age",
+		handlers.HeaderContextTruncated, handlers.HeaderContextDropped, handlers.HeaderContextSummarized,
+	} {
+		if !strings.Contains(exposed, header) {
+			t.Errorf("%s is not exposed: %q", header, exposed)
+		}
+	}
+}
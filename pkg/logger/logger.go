@@ -7,6 +7,9 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
+// level is shared by every logger built by New so SetLevel applies at runtime
+var level = zap.NewAtomicLevel()
+
 func New(logLevel string) (*zap.Logger, error) {
 	var zapConfig zap.Config
 	
@@ -22,11 +25,21 @@ func New(logLevel string) (*zap.Logger, error) {
 		zapConfig.EncoderConfig.EncodeName = zapcore.FullNameEncoder
 	}
 
+	level.SetLevel(zapConfig.Level.Level())
 	if logLevel != "" {
-		if level, err := zapcore.ParseLevel(logLevel); err == nil {
-			zapConfig.Level = zap.NewAtomicLevelAt(level)
-		}
+		_ = SetLevel(logLevel)
 	}
+	zapConfig.Level = level
 
 	return zapConfig.Build()
 }
+
+// SetLevel changes the level of the loggers built by New
+func SetLevel(logLevel string) error {
+	l, err := zapcore.ParseLevel(logLevel)
+	if err != nil {
+		return err
+	}
+	level.SetLevel(l)
+	return nil
+}
@@ -23,7 +23,10 @@ func main() {
 	cfg.Gemini.Secure1PSIDCC = os.Getenv("GEMINI_1PSIDCC")
 
 	logger, _ := zap.NewDevelopment()
-	client := gemini.NewClient(cfg, logger)
+	client, err := gemini.NewClient(cfg, logger)
+	if err != nil {
+		log.Fatalf("Failed to create client: %v", err)
+	}
 
 	ctx := context.Background()
 	if err := client.Init(ctx); err != nil {
@@ -19,7 +19,10 @@ func main() {
 	cfg.Gemini.Secure1PSIDCC = os.Getenv("GEMINI_1PSIDCC")
 
 	logger, _ := zap.NewDevelopment()
-	client := gemini.NewClient(cfg, logger)
+	client, err := gemini.NewClient(cfg, logger)
+	if err != nil {
+		log.Fatalf("Failed to create client: %v", err)
+	}
 
 	ctx := context.Background()
 	if err := client.Init(ctx); err != nil {
@@ -42,7 +45,11 @@ func main() {
 		log.Fatalf("Failed to retrieve research: %v", err)
 	}
 
-	fmt.Printf("Research Title/Summary:\n%s\n\n", resp.Text)
+	fmt.Printf("Research Title: %s\n\n", resp.Title)
+	fmt.Printf("Sections: %d, Steps: %d\n", len(resp.Sections), len(resp.Steps))
+	for _, step := range resp.Steps {
+		fmt.Printf("  Step %d: %s (queries: %d, sources: %d)\n", step.Index, step.Description, len(step.Queries), len(step.Sources))
+	}
 	fmt.Printf("References Found: %d\n", len(resp.References))
 	for i, ref := range resp.References {
 		fmt.Printf("[%d] %s\n    URL: %s\n", i+1, ref.Title, ref.URL)